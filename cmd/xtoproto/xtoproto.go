@@ -28,6 +28,7 @@ import (
 	"github.com/google/xtoproto/service"
 	"google.golang.org/protobuf/encoding/prototext"
 
+	rpb "github.com/google/xtoproto/proto/recordtoproto"
 	spb "github.com/google/xtoproto/proto/service"
 )
 
@@ -54,18 +55,22 @@ var (
 type config struct {
 	defaultWorkspaceDir         string
 	csvPath                     string
+	xmlPath                     string
 	codegenRequestPath          string
 	overrideConverterOutputPath string
 	codegenRequestJSON          string
+	previousMappingPath         string
 }
 
 func registerFlags(fs *flag.FlagSet) *config {
 	cfg := &config{}
 	fs.StringVar(&cfg.defaultWorkspaceDir, "default_workspace", "/tmp/example-workspace", "default workspace directory")
 	fs.StringVar(&cfg.csvPath, "csv", "", "path to input csv file")
+	fs.StringVar(&cfg.xmlPath, "xml", "", "path to input xml file; if specified, messages are inferred from it instead of --csv, and only a .proto file is generated")
 	fs.StringVar(&cfg.codegenRequestPath, "codegen_request", "", "if specified, a prototext-encoded GenerateCodeRequest to be issued")
 	fs.StringVar(&cfg.overrideConverterOutputPath, "codegen_convert_go_out", "", "path to output Go file - overrides value in codegen_request")
 	fs.StringVar(&cfg.codegenRequestJSON, "codegen_request_json", "", "JSON request from bazel")
+	fs.StringVar(&cfg.previousMappingPath, "previous_mapping", "", "if specified, a prototext-encoded RecordProtoMapping that the inferred mapping is merged into, keeping its field names and tags")
 	return cfg
 }
 
@@ -84,16 +89,20 @@ func run(ctx context.Context) error {
 		return runConverterCodeGen(ctx, s)
 	}
 
+	format, inputPath := spb.Format_CSV, cfg.csvPath
+	if cfg.xmlPath != "" {
+		format, inputPath = spb.Format_XML, cfg.xmlPath
+	}
 	resp1, err := s.Infer(ctx, &spb.InferRequest{
 		GoPackageName: "example",
 		GoProtoImport: "not/sure",
-		InputFormat:   spb.Format_CSV,
+		InputFormat:   format,
 		MessageName:   "MyMessage",
 		PackageName:   "mypackage",
 		ExampleInputs: []*spb.InputFile{
 			{
 				Spec: &spb.InputFile_InputPath{
-					InputPath: cfg.csvPath,
+					InputPath: inputPath,
 				},
 			},
 		},
@@ -102,8 +111,31 @@ func run(ctx context.Context) error {
 		return err
 	}
 	fmt.Printf("InferResponse:\n%s\n", prototext.Format(resp1))
+	mapping := resp1.GetBestMappingCandidate().GetTopLevelMapping()
+	if cfg.previousMappingPath != "" {
+		data, err := readFile(ctx, cfg.previousMappingPath)
+		if err != nil {
+			return err
+		}
+		previous := &rpb.RecordProtoMapping{}
+		if err := prototext.Unmarshal(data, previous); err != nil {
+			return fmt.Errorf("bad previous mapping %q: %w", cfg.previousMappingPath, err)
+		}
+		evolveResp, err := s.EvolveMapping(ctx, &spb.EvolveMappingRequest{
+			PreviousMapping: previous,
+			InferredMapping: mapping,
+		})
+		if err != nil {
+			return err
+		}
+		for _, c := range evolveResp.GetIncompatibleTypeChanges() {
+			fmt.Fprintf(os.Stderr, "warning: column %q (field %s) was inferred as %s, which is not compatible with its previous type %s; keeping %s\n", c.GetColName(), c.GetProtoName(), c.GetInferredType(), c.GetPreviousType(), c.GetPreviousType())
+		}
+		mapping = evolveResp.GetMapping()
+	}
 	req2 := &spb.GenerateCodeRequest{
-		Mapping: resp1.GetBestMappingCandidate().GetTopLevelMapping(),
+		Mapping:            mapping,
+		AdditionalMappings: resp1.GetBestMappingCandidate().GetAdditionalMappings(),
 		ProtoDefinition: &spb.GenerateCodeRequest_ProtoDefinition{
 			Directory:        "generated",
 			ProtoFileName:    "example.proto",
@@ -115,6 +147,10 @@ func run(ctx context.Context) error {
 			UpdateBuildRules: true,
 		},
 	}
+	if format == spb.Format_XML {
+		// Generated converters parse CSV records.
+		req2.Converter = nil
+	}
 	fmt.Printf("GenerateCodeRequest:\n%s\n", prototext.Format(req2))
 
 	resp2, err := s.GenerateCode(ctx, req2)
@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Program xtoproto_compat checks that a new version of a RecordProtoMapping or .proto file
+// can read data written with an old version.
+//
+// It prints the incompatible changes and exits with status 1 if there are any, so it may be
+// used as a presubmit check. It exits with status 2 if the inputs cannot be read.
+//
+// Usage:
+//
+//	xtoproto_compat -old_mapping old.textproto -new_mapping new.textproto
+//	xtoproto_compat -old_proto old/record.proto -new_proto new/record.proto
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/xtoproto/protocompat"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+var (
+	oldMapping = flag.String("old_mapping", "", "path to the prototext-encoded RecordProtoMapping of the old version")
+	newMapping = flag.String("new_mapping", "", "path to the prototext-encoded RecordProtoMapping of the new version")
+	oldProto   = flag.String("old_proto", "", "path to the .proto file of the old version")
+	newProto   = flag.String("new_proto", "", "path to the .proto file of the new version")
+	protoPath  = flag.String("proto_path", "", "list of directories separated by the OS path list separator in which to search for .proto imports, in addition to the directory of each .proto file")
+	output     = flag.String("output", "json", `output format: "json" or "text"`)
+)
+
+// report is the JSON output of the program.
+type report struct {
+	Compatible bool                   `json:"compatible"`
+	Problems   []*protocompat.Problem `json:"problems"`
+}
+
+func main() {
+	flag.Parse()
+	problems, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal xtoproto_compat error: %v\n", err)
+		os.Exit(2)
+	}
+	if err := printProblems(problems); err != nil {
+		fmt.Fprintf(os.Stderr, "fatal xtoproto_compat error: %v\n", err)
+		os.Exit(2)
+	}
+	if len(problems) != 0 {
+		os.Exit(1)
+	}
+}
+
+func run() ([]*protocompat.Problem, error) {
+	switch {
+	case *oldMapping != "" && *newMapping != "" && *oldProto == "" && *newProto == "":
+		oldM, err := readMapping(*oldMapping)
+		if err != nil {
+			return nil, err
+		}
+		newM, err := readMapping(*newMapping)
+		if err != nil {
+			return nil, err
+		}
+		return protocompat.CompareMappings(oldM, newM)
+	case *oldProto != "" && *newProto != "" && *oldMapping == "" && *newMapping == "":
+		oldFile, err := parseProto(*oldProto)
+		if err != nil {
+			return nil, err
+		}
+		newFile, err := parseProto(*newProto)
+		if err != nil {
+			return nil, err
+		}
+		return protocompat.CompareFiles(oldFile, newFile), nil
+	}
+	return nil, fmt.Errorf("must specify either --old_mapping and --new_mapping or --old_proto and --new_proto")
+}
+
+func readMapping(path string) (*pb.RecordProtoMapping, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &pb.RecordProtoMapping{}
+	if err := prototext.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("bad mapping %q: %w", path, err)
+	}
+	return m, nil
+}
+
+func parseProto(path string) (protoreflect.FileDescriptor, error) {
+	importPaths := append([]string{filepath.Dir(path)}, filepath.SplitList(*protoPath)...)
+	fd, err := protocompat.ParseProtoFile(protoparse.Parser{ImportPaths: importPaths}, filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %q: %w", path, err)
+	}
+	return fd, nil
+}
+
+func printProblems(problems []*protocompat.Problem) error {
+	switch *output {
+	case "json":
+		r := &report{Compatible: len(problems) == 0, Problems: problems}
+		if r.Problems == nil {
+			r.Problems = []*protocompat.Problem{}
+		}
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "text":
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	default:
+		return fmt.Errorf("unknown --output value %q", *output)
+	}
+	return nil
+}
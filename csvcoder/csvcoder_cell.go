@@ -46,11 +46,18 @@ func (c *CellContext) Row() *Row {
 	return c.r
 }
 
-// ParseCell parses a single CSV cell's textual value into dst.
+// ParseCell parses a single CSV cell's textual value into dst using the default
+// Registry.
 func ParseCell(ctx *CellContext, value string, dst interface{}) error {
+	return defaultRegistry.ParseCell(ctx, value, dst)
+}
+
+// ParseCell parses a single CSV cell's textual value into dst using the
+// registry's textcoder.Registry.
+func (r *Registry) ParseCell(ctx *CellContext, value string, dst interface{}) error {
 	outV := reflect.ValueOf(dst)
 	outType := outV.Type()
-	cp, err := getOrCreateCellParserForType(outType)
+	cp, err := r.getOrCreateCellParserForType(outType)
 	if err != nil {
 		return fmt.Errorf("could not parce value %q: %w", value, err)
 	}
@@ -59,8 +66,9 @@ func ParseCell(ctx *CellContext, value string, dst interface{}) error {
 
 // registeredCellParser is used ins
 type registeredCellParser struct {
-	impl    cellParser
-	decoder textcoder.Decoder
+	impl         cellParser
+	decoder      textcoder.Decoder
+	textRegistry *textcoder.Registry
 }
 
 // ParseCSVCell dispatches to the underlying implementation. This indirection
@@ -70,7 +78,7 @@ func (cp *registeredCellParser) ParseCSVCell(ctx *CellContext, value string, fie
 		return cp.impl.ParseCSVCell(ctx, value, field)
 	}
 	if cp.decoder != nil {
-		return cp.decoder.DecodeText(textcoder.NewContext().WithValue("csvcoder.CellContext", ctx), value, field.Interface())
+		return cp.decoder.DecodeText(cp.textRegistry.NewContext().WithValue("csvcoder.CellContext", ctx), value, field.Interface())
 	}
 	panic("internal error in csvcoder: registeredCellParser has no implementation")
 }
@@ -79,26 +87,30 @@ func (cp *registeredCellParser) ParseCSVCell(ctx *CellContext, value string, fie
 // textual CSV cell into an object of that type.
 //
 // The argument is typically a pointer type.
-func getOrCreateCellParserForType(t reflect.Type) (cellParser, error) {
+func (r *Registry) getOrCreateCellParserForType(t reflect.Type) (cellParser, error) {
 	if t.Kind() != reflect.Ptr {
 		return nil, fmt.Errorf("internal error: must only pass pointers to getOrCreateCellParserForType, got %v", t)
 	}
 
-	parser := defaultRegistry.cellParsers[t]
-	if parser == nil {
-		parser = &registeredCellParser{}
-		defaultRegistry.cellParsers[t] = parser
-	}
-	if parser.impl != nil {
+	r.mu.RLock()
+	parser := r.cellParsers[t]
+	r.mu.RUnlock()
+	if parser != nil {
 		return parser, nil
 	}
-	if dec := textcoder.DefaultRegistry().GetDecoder(t.Elem()); dec != nil {
-		parser.decoder = dec
-		return parser, nil
+	dec := r.textRegistry.GetDecoder(t.Elem())
+	if dec == nil {
+		return nil, fmt.Errorf("no cell parser registered for type %v", t)
 	}
 
-	return nil, fmt.Errorf("no cell parser registered for type %v", t)
-
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.cellParsers[t]; existing != nil {
+		return existing, nil
+	}
+	parser = &registeredCellParser{decoder: dec, textRegistry: r.textRegistry}
+	r.cellParsers[t] = parser
+	return parser, nil
 }
 
 type cellParser interface {
@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvcoder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrMissingColumn is the underlying error of a CellError for a column that is absent
+	// from the header.
+	ErrMissingColumn = errors.New("csv file missing required column")
+
+	// ErrMissingValue is the underlying error of a CellError for a row that has fewer values
+	// than the header.
+	ErrMissingValue = errors.New("csv row does not have a value for column")
+)
+
+// ErrorKind classifies the cause of a parsing error.
+type ErrorKind int
+
+const (
+	// InvalidValue indicates that the value of a cell could not be decoded.
+	InvalidValue ErrorKind = iota
+	// MissingColumn indicates that the header does not contain a required column.
+	MissingColumn
+	// MissingValue indicates that a row has no value for a column.
+	MissingValue
+	// MalformedRow indicates that the row could not be read by the csv.Reader.
+	MalformedRow
+)
+
+// String returns a human readable description of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case InvalidValue:
+		return "invalid value"
+	case MissingColumn:
+		return "missing column"
+	case MissingValue:
+		return "missing value"
+	case MalformedRow:
+		return "malformed row"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+}
+
+// CellError describes a failure to parse the value of a single CSV cell into a struct
+// field.
+type CellError struct {
+	// Path is the path of the CSV file, or empty if this information is not available.
+	Path         string
+	RowNumber    RowNumber
+	ColumnNumber ColumnNumber
+	ColumnName   string
+	// Value is the raw value of the cell.
+	Value string
+	// GoType is the type of the struct field the value was parsed into.
+	GoType reflect.Type
+	Kind   ErrorKind
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *CellError) Error() string {
+	pos := NewRow(nil, nil, e.RowNumber, e.Path).PositionString()
+	if e.Kind != InvalidValue {
+		return fmt.Sprintf("%s: %v %q", pos, e.Err, e.ColumnName)
+	}
+	return fmt.Sprintf("%s: column %q: cannot parse %q as %v: %v", pos, e.ColumnName, e.Value, e.GoType, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
+
+// RowError is returned when one or more cells of a row fail to parse. Unlike most errors,
+// a RowError does not stop at the first cell that fails: it describes every cell of the row
+// that could not be parsed.
+type RowError struct {
+	// Path is the path of the CSV file, or empty if this information is not available.
+	Path      string
+	RowNumber RowNumber
+	// CellErrors contains an error for each cell that failed to parse, in field order.
+	CellErrors []*CellError
+}
+
+func (e *RowError) Error() string {
+	if len(e.CellErrors) == 1 {
+		return e.CellErrors[0].Error()
+	}
+	var msgs []string
+	for _, ce := range e.CellErrors {
+		msgs = append(msgs, ce.Error())
+	}
+	pos := NewRow(nil, nil, e.RowNumber, e.Path).PositionString()
+	return fmt.Sprintf("%s: %d cells failed to parse: %s", pos, len(e.CellErrors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the first cell error so errors.As may be used to inspect it.
+func (e *RowError) Unwrap() error {
+	if len(e.CellErrors) == 0 {
+		return nil
+	}
+	return e.CellErrors[0]
+}
+
+// maxSummaryErrors is the number of errors retained by an ErrorSummary.
+const maxSummaryErrors = 100
+
+// ErrorSummary reports the rows skipped by a FileParser created with the SkipInvalidRows
+// option.
+type ErrorSummary struct {
+	// RowsParsed is the number of data rows that were parsed successfully.
+	RowsParsed int
+	// RowsSkipped is the number of data rows that were skipped because of errors.
+	RowsSkipped int
+	// ErrorsByColumn counts the cell errors of each column.
+	ErrorsByColumn map[string]int
+	// ErrorsByKind counts errors by kind. A malformed row counts as a single error.
+	ErrorsByKind map[ErrorKind]int
+	// Errors contains the errors that caused the first 100 skipped rows to be skipped.
+	Errors []error
+}
+
+func newErrorSummary() *ErrorSummary {
+	return &ErrorSummary{
+		ErrorsByColumn: make(map[string]int),
+		ErrorsByKind:   make(map[ErrorKind]int),
+	}
+}
+
+// addSkippedRow records an error that caused a row to be skipped.
+func (s *ErrorSummary) addSkippedRow(err error) {
+	s.RowsSkipped++
+	if len(s.Errors) < maxSummaryErrors {
+		s.Errors = append(s.Errors, err)
+	}
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) {
+		s.ErrorsByKind[MalformedRow]++
+		return
+	}
+	for _, ce := range rowErr.CellErrors {
+		s.ErrorsByColumn[ce.ColumnName]++
+		s.ErrorsByKind[ce.Kind]++
+	}
+}
+
+// String returns a human readable report of the errors.
+func (s *ErrorSummary) String() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "parsed %d rows, skipped %d rows", s.RowsParsed, s.RowsSkipped)
+	var kinds []ErrorKind
+	for k := range s.ErrorsByKind {
+		kinds = append(kinds, k)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	for _, k := range kinds {
+		fmt.Fprintf(b, "\n  %s: %d", k, s.ErrorsByKind[k])
+	}
+	var cols []string
+	for c := range s.ErrorsByColumn {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+	for _, c := range cols {
+		fmt.Fprintf(b, "\n  column %q: %d", c, s.ErrorsByColumn[c])
+	}
+	return b.String()
+}
@@ -79,3 +79,32 @@ Redwood,1200000
 	// record: name = "Redwood", mass = 1200000.000000
 	// record: name = "Blue whale", mass = 200000.000000
 }
+
+func Example_cFileWriting() {
+	type mass float64
+
+	type species struct {
+		Name string `csv:"name"`
+		Mass mass   `csv:"weight_kg"`
+	}
+	csvcoder.RegisterRowStruct(reflect.TypeOf(&species{}))
+
+	out := &strings.Builder{}
+	fw, err := csvcoder.NewFileWriter(csv.NewWriter(out), &species{})
+	if err != nil {
+		fmt.Printf("NewFileWriter error: %v", err)
+		return
+	}
+	if err := fw.WriteAll([]interface{}{
+		&species{"Redwood", 1200000},
+		&species{"Blue whale", 200000.5},
+	}); err != nil {
+		fmt.Printf("WriteAll error: %v", err)
+		return
+	}
+	fmt.Print(out.String())
+	// Output:
+	// name,weight_kg
+	// Redwood,1200000
+	// Blue whale,200000.5
+}
@@ -0,0 +1,267 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvcoder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/xtoproto/textcoder"
+)
+
+// fieldShape describes how the value of a struct field is stored in CSV columns.
+type fieldShape int
+
+const (
+	// scalarField is a field decoded from a single cell.
+	scalarField fieldShape = iota
+	// pointerField is a *T field decoded from a single cell. An empty cell is nil.
+	pointerField
+	// delimitedSliceField is a []T field decoded by splitting a single cell.
+	delimitedSliceField
+	// repeatedSliceField is a []T field decoded from a group of repeated or numbered
+	// columns.
+	repeatedSliceField
+)
+
+// rowField is a struct field backed by one or more CSV columns.
+type rowField struct {
+	columnName string
+	// field is the struct field. Its Index is the path to the field from the row struct,
+	// which has more than one element for fields of nested structs.
+	field     reflect.StructField
+	shape     fieldShape
+	delimiter string
+	// parser parses a single cell into a pointer to a value of valueType().
+	parser       cellParser
+	textRegistry *textcoder.Registry
+}
+
+// valueType returns the type of the values decoded from each cell of the field.
+func (f *rowField) valueType() reflect.Type {
+	if f.shape == scalarField {
+		return f.field.Type
+	}
+	return f.field.Type.Elem()
+}
+
+// inferRowFields returns the fields of struct type t. The column names of the fields are
+// prefixed by prefix, and index is the path from the row struct to t.
+func (r *Registry) inferRowFields(t reflect.Type, prefix string, index []int) ([]*rowField, error) {
+	var fields []*rowField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup("csv-skip"); ok {
+			continue
+		}
+		f.Index = append(append([]int(nil), index...), i)
+		colName, ok := f.Tag.Lookup("csv")
+		if !ok {
+			colName = f.Name
+		}
+		rf := &rowField{columnName: prefix + colName, field: f, textRegistry: r.textRegistry}
+
+		// Unnamed slice types and fields with a csv-delimiter tag are always spread over
+		// columns or split by csvcoder rather than by the textcoder's slice coder.
+		delim, hasDelim := f.Tag.Lookup("csv-delimiter")
+		isSlice := f.Type.Kind() == reflect.Slice && (f.Type.Name() == "" || hasDelim)
+		var err error
+		if !isSlice {
+			if rf.parser, err = r.getOrCreateCellParserForType(reflect.PtrTo(f.Type)); err == nil {
+				fields = append(fields, rf)
+				continue
+			}
+		}
+		switch {
+		case isSlice:
+			rf.shape = repeatedSliceField
+			if hasDelim {
+				if delim == "" {
+					return nil, fmt.Errorf("field %s has an empty csv-delimiter tag", f.Name)
+				}
+				rf.shape, rf.delimiter = delimitedSliceField, delim
+			}
+		case f.Type.Kind() == reflect.Ptr:
+			rf.shape = pointerField
+		case f.Type.Kind() == reflect.Struct:
+			nestedPrefix, ok := f.Tag.Lookup("csv-prefix")
+			if !ok && !f.Anonymous {
+				return nil, err
+			}
+			nested, err := r.inferRowFields(f.Type, prefix+nestedPrefix, f.Index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nested...)
+			continue
+		default:
+			return nil, err
+		}
+		if rf.parser, err = r.getOrCreateCellParserForType(reflect.PtrTo(rf.valueType())); err != nil {
+			return nil, fmt.Errorf("cannot parse elements of field %s: %w", f.Name, err)
+		}
+		fields = append(fields, rf)
+	}
+	return fields, nil
+}
+
+// parse sets the field of dstRow, a pointer to the row struct, from the values of the row.
+func (f *rowField) parse(row *Row, dstRow reflect.Value) []*CellError {
+	dst := dstRow.Elem().FieldByIndex(f.field.Index)
+	cellErr := func(col ColumnNumber, colName, value string, kind ErrorKind, err error) *CellError {
+		return &CellError{row.Path(), row.Number(), col, colName, value, f.field.Type, kind, err}
+	}
+	parseValue := func(col ColumnNumber, colName, value string) (reflect.Value, *CellError) {
+		v := reflect.New(f.valueType())
+		if err := f.parser.ParseCSVCell(NewCellContext(row), value, v); err != nil {
+			return reflect.Value{}, cellErr(col, colName, value, InvalidValue, err)
+		}
+		return v, nil
+	}
+
+	if f.shape == repeatedSliceField {
+		var errs []*CellError
+		slice := reflect.MakeSlice(f.field.Type, 0, 0)
+		for _, idx := range row.Header().repeatedColumnIndexes(f.columnName) {
+			if idx.Offset() >= len(row.Strings()) || row.Strings()[idx.Offset()] == "" {
+				continue
+			}
+			colName := row.Header().ColumnNames()[idx.Offset()]
+			v, err := parseValue(idx, colName, row.Strings()[idx.Offset()])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			slice = reflect.Append(slice, v.Elem())
+		}
+		dst.Set(slice)
+		return errs
+	}
+
+	idx := row.Header().ColumnIndex(f.columnName)
+	if !idx.IsValid() {
+		return []*CellError{cellErr(idx, f.columnName, "", MissingColumn, ErrMissingColumn)}
+	}
+	if idx.Offset() >= len(row.Strings()) {
+		return []*CellError{cellErr(idx, f.columnName, "", MissingValue, ErrMissingValue)}
+	}
+	strValue := row.Strings()[idx.Offset()]
+
+	switch f.shape {
+	case pointerField:
+		if strValue == "" {
+			dst.Set(reflect.Zero(f.field.Type))
+			return nil
+		}
+		v, err := parseValue(idx, f.columnName, strValue)
+		if err != nil {
+			return []*CellError{err}
+		}
+		dst.Set(v)
+	case delimitedSliceField:
+		slice := reflect.MakeSlice(f.field.Type, 0, 0)
+		if strValue != "" {
+			for _, part := range strings.Split(strValue, f.delimiter) {
+				v, err := parseValue(idx, f.columnName, part)
+				if err != nil {
+					return []*CellError{err}
+				}
+				slice = reflect.Append(slice, v.Elem())
+			}
+		}
+		dst.Set(slice)
+	default:
+		if err := f.parser.ParseCSVCell(NewCellContext(row), strValue, dst.Addr()); err != nil {
+			return []*CellError{cellErr(idx, f.columnName, strValue, InvalidValue, err)}
+		}
+	}
+	return nil
+}
+
+// encode sets the values of the columns backing the field of srcRow, a pointer to the row
+// struct. The values are ordered according to the header.
+func (f *rowField) encode(srcRow reflect.Value, header *Header, values []string) error {
+	enc, err := f.encoder()
+	if err != nil {
+		return err
+	}
+	src := srcRow.Elem().FieldByIndex(f.field.Index)
+	encodeValue := func(v reflect.Value) (string, error) {
+		text, err := enc.EncodeText(f.textRegistry.NewContext().WithExactFloats(), v.Interface())
+		if err != nil {
+			return "", fmt.Errorf("error encoding value of column %q: %w", f.columnName, err)
+		}
+		return text, nil
+	}
+
+	if f.shape == repeatedSliceField {
+		indexes := header.repeatedColumnIndexes(f.columnName)
+		if src.Len() > len(indexes) {
+			return fmt.Errorf("column %q has %d values, but the header has %d columns for them", f.columnName, src.Len(), len(indexes))
+		}
+		for i := 0; i < src.Len(); i++ {
+			text, err := encodeValue(src.Index(i))
+			if err != nil {
+				return err
+			}
+			values[indexes[i].Offset()] = text
+		}
+		return nil
+	}
+
+	idx := header.ColumnIndex(f.columnName)
+	if !idx.IsValid() {
+		return nil
+	}
+	var text string
+	switch f.shape {
+	case pointerField:
+		if src.IsNil() {
+			return nil
+		}
+		if text, err = encodeValue(src.Elem()); err != nil {
+			return err
+		}
+	case delimitedSliceField:
+		var parts []string
+		for i := 0; i < src.Len(); i++ {
+			part, err := encodeValue(src.Index(i))
+			if err != nil {
+				return err
+			}
+			if strings.Contains(part, f.delimiter) {
+				return fmt.Errorf("value %q of column %q contains the delimiter %q", part, f.columnName, f.delimiter)
+			}
+			parts = append(parts, part)
+		}
+		text = strings.Join(parts, f.delimiter)
+	default:
+		if text, err = encodeValue(src); err != nil {
+			return err
+		}
+	}
+	values[idx.Offset()] = text
+	return nil
+}
+
+// encoder returns the textcoder.Encoder used to encode the values of the field.
+func (f *rowField) encoder() (textcoder.Encoder, error) {
+	enc := f.textRegistry.GetEncoder(f.valueType())
+	if enc == nil {
+		return nil, fmt.Errorf("no textcoder.Encoder registered for type %v of column %q", f.valueType(), f.columnName)
+	}
+	return enc, nil
+}
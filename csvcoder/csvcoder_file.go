@@ -16,6 +16,7 @@ package csvcoder
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -34,6 +35,9 @@ type FileParser struct {
 	hdr      *Header
 	rowNum   RowNumber
 	fatalErr error
+
+	// summary is non-nil if invalid rows are skipped.
+	summary *ErrorSummary
 }
 
 // NewFileParser returns an object for parsing a set of records from a file.
@@ -42,18 +46,26 @@ type FileParser struct {
 // for error reporting purposes.
 //
 // The type of the recordPrototype should have been registered with a call to
-// RegisterRowStruct.
-func NewFileParser(r *csv.Reader, path string, recordPrototype interface{}) (*FileParser, error) {
-	rt, err := getOrRegisterType(reflect.ValueOf(recordPrototype).Type())
+// RegisterRowStruct. NewFileParser uses the default Registry.
+func NewFileParser(r *csv.Reader, path string, recordPrototype interface{}, opts ...FileParserOption) (*FileParser, error) {
+	return defaultRegistry.NewFileParser(r, path, recordPrototype, opts...)
+}
+
+// NewFileParser is like the package-level NewFileParser function, but it uses row types and
+// cell decoders from the registry.
+func (reg *Registry) NewFileParser(r *csv.Reader, path string, recordPrototype interface{}, opts ...FileParserOption) (*FileParser, error) {
+	rt, err := reg.getOrRegisterType(reflect.ValueOf(recordPrototype).Type())
 	if err != nil {
 		return nil, fmt.Errorf("could not find or infer coder for type %v: %w", reflect.ValueOf(recordPrototype).Type(), err)
 	}
 	fp := &FileParser{
-		r, path, rt,
-		headerOption{expectedColumns: rt.requiredColumnNames},
-		nil,
-		0,
-		nil,
+		r:        r,
+		filePath: path,
+		rt:       rt,
+		hdrOpt:   headerOption{expectedColumns: rt.requiredColumnNames, repeatedColumns: rt.repeatedColumnNames},
+	}
+	for _, opt := range opts {
+		opt(fp)
 	}
 
 	if err := fp.parseHeader(); err != nil {
@@ -64,30 +76,46 @@ func NewFileParser(r *csv.Reader, path string, recordPrototype interface{}) (*Fi
 }
 
 func (fp *FileParser) parseHeader() error {
-	if fp.hdrOpt.noHeader {
-		fp.hdr = fp.hdrOpt.predeterminedHeader
+	fieldsPerRecord := fp.r.FieldsPerRecord
+	if fp.hdrOpt.rowOffset > 0 && fieldsPerRecord == 0 {
+		// Preamble rows need not have the same number of fields as the header.
+		fp.r.FieldsPerRecord = -1
 	}
-	gotHeaderValues, err := fp.r.Read()
-	if err != nil {
-		return fmt.Errorf("error reading header row: %w", err)
-	}
-	fp.rowNum = 1
-	fp.hdr = NewHeader(gotHeaderValues)
-	missing := []string{}
-	for wantCol := range fp.hdrOpt.expectedColumns {
-		if !fp.hdr.ColumnIndex(wantCol).IsValid() {
-			missing = append(missing, fmt.Sprintf("%q", wantCol))
+	for i := 0; i < fp.hdrOpt.rowOffset; i++ {
+		if _, err := fp.r.Read(); err != nil {
+			return fmt.Errorf("error reading preamble row %d: %w", fp.rowNum.Ordinal(), err)
 		}
+		fp.rowNum++
 	}
-	if len(missing) != 0 {
-		sort.Strings(missing)
-		return fmt.Errorf("header row is missing %d columns: %s", len(missing), strings.Join(missing, ", "))
+
+	var gotHeaderValues []string
+	if fp.hdrOpt.noHeader {
+		gotHeaderValues = fp.hdrOpt.predeterminedHeader.ColumnNames()
+	} else {
+		values, err := fp.r.Read()
+		if err != nil {
+			return fmt.Errorf("error reading header row: %w", err)
+		}
+		fp.rowNum++
+		gotHeaderValues = values
+		if fieldsPerRecord == 0 {
+			fieldsPerRecord = len(values)
+		}
 	}
+	fp.r.FieldsPerRecord = fieldsPerRecord
 
+	hdr, err := fp.hdrOpt.resolveHeader(gotHeaderValues)
+	if err != nil {
+		return err
+	}
+	fp.hdr = hdr
 	return nil
 }
 
 // Read parses the next record in the CSV. The header is parsed automatically.
+//
+// If a row fails to parse and the parser was created with the SkipInvalidRows option, the
+// row is skipped and recorded in the ErrorSummary.
 func (fp *FileParser) Read() (interface{}, error) {
 	if fp.hdr == nil {
 		if err := fp.parseHeader(); err != nil {
@@ -95,19 +123,44 @@ func (fp *FileParser) Read() (interface{}, error) {
 		}
 	}
 
+	for {
+		got, err := fp.readRow()
+		if err == io.EOF || fp.summary == nil {
+			return got, err
+		}
+		var rowErr *RowError
+		var csvErr *csv.ParseError
+		if err != nil && (errors.As(err, &rowErr) || errors.As(err, &csvErr)) {
+			fp.summary.addSkippedRow(err)
+			continue
+		}
+		if err == nil {
+			fp.summary.RowsParsed++
+		}
+		return got, err
+	}
+}
+
+func (fp *FileParser) readRow() (interface{}, error) {
 	rowVals, err := fp.r.Read()
 	if err == io.EOF {
 		return nil, err
 	}
 	row := NewRow(rowVals, fp.hdr, fp.rowNum, fp.filePath)
+	fp.rowNum++
 	if err != nil {
 		return nil, row.errorf("csv.Reader error: %w", err)
 	}
-	fp.rowNum++
 
 	return fp.rt.parseRow(row)
 }
 
+// ErrorSummary returns a report of the rows that have been skipped because they failed to
+// parse, or nil if the parser was not created with the SkipInvalidRows option.
+func (fp *FileParser) ErrorSummary() *ErrorSummary {
+	return fp.summary
+}
+
 // ReadAll calls Read() until the end of the file and calls cb for each value.
 func (fp *FileParser) ReadAll(callback func(interface{}) error) error {
 	for {
@@ -124,29 +177,174 @@ func (fp *FileParser) ReadAll(callback func(interface{}) error) error {
 	}
 }
 
-// headerOption is an argument passed to ParseRecords
-//
-// TODO(reddaly): Export this?
+// FileParserOption customizes the behavior of a FileParser.
+type FileParserOption func(fp *FileParser)
+
+// Dialect describes the syntax of a CSV file.
+type Dialect struct {
+	// Comma is the field delimiter. If zero, ',' is used.
+	Comma rune
+	// Comment, if not zero, is the comment character. Lines beginning with the comment
+	// character are ignored.
+	Comment rune
+	// LazyQuotes allows quotes to appear in unquoted fields and non-doubled quotes to
+	// appear in quoted fields.
+	LazyQuotes bool
+}
+
+// Apply configures a csv.Reader to read files in the dialect.
+func (d Dialect) Apply(r *csv.Reader) {
+	if d.Comma != 0 {
+		r.Comma = d.Comma
+	}
+	r.Comment = d.Comment
+	r.LazyQuotes = d.LazyQuotes
+}
+
+// WithDialect returns an option that configures the parser's csv.Reader to read files in
+// the given dialect.
+func WithDialect(d Dialect) FileParserOption {
+	return func(fp *FileParser) {
+		d.Apply(fp.r)
+	}
+}
+
+// WithPredeterminedHeader returns an option for parsing files that do not begin with a
+// header row. The columns of each row are named by the given column names, in order.
+func WithPredeterminedHeader(columnNames []string) FileParserOption {
+	return func(fp *FileParser) {
+		fp.hdrOpt.noHeader = true
+		fp.hdrOpt.predeterminedHeader = NewHeader(columnNames)
+	}
+}
+
+// WithHeaderRowOffset returns an option that skips the given number of preamble rows
+// before the header row, or before the first data row if there is no header row.
+func WithHeaderRowOffset(rows int) FileParserOption {
+	return func(fp *FileParser) {
+		fp.hdrOpt.rowOffset = rows
+	}
+}
+
+// IgnoreColumnCaseAndSpace returns an option that matches header values to column names
+// without regard to case or whitespace. For example, a column named "first_name" matches a
+// header value of " First_Name".
+func IgnoreColumnCaseAndSpace() FileParserOption {
+	return func(fp *FileParser) {
+		fp.hdrOpt.normalize = normalizeCaseAndSpace
+	}
+}
+
+// WithColumnAliases returns an option that allows a column to appear in the header under
+// alternative names. The keys of the map are column names of the record type, and the values
+// are the alternative names of each column.
+func WithColumnAliases(aliases map[string][]string) FileParserOption {
+	return func(fp *FileParser) {
+		if fp.hdrOpt.aliases == nil {
+			fp.hdrOpt.aliases = make(map[string][]string)
+		}
+		for col, names := range aliases {
+			fp.hdrOpt.aliases[col] = append(fp.hdrOpt.aliases[col], names...)
+		}
+	}
+}
+
+// StrictColumns returns an option that causes NewFileParser to return an error if the
+// header contains columns that do not correspond to a column of the record type. By default,
+// extra columns are ignored.
+func StrictColumns() FileParserOption {
+	return func(fp *FileParser) {
+		fp.hdrOpt.strict = true
+	}
+}
+
+// SkipInvalidRows returns an option that causes the FileParser to skip rows that fail to
+// parse instead of returning an error. The skipped rows are reported by ErrorSummary.
+func SkipInvalidRows() FileParserOption {
+	return func(fp *FileParser) {
+		fp.summary = newErrorSummary()
+	}
+}
+
+// headerOption describes how the header of a file is read and matched to the columns of the
+// record type.
 type headerOption struct {
-	expectedColumns     map[string]struct{}
+	expectedColumns map[string]struct{}
+	// repeatedColumns are optional columns that may be repeated or numbered.
+	repeatedColumns     map[string]struct{}
 	noHeader            bool
 	predeterminedHeader *Header
+	rowOffset           int
+	// normalize, if non-nil, is applied to column names before they are compared.
+	normalize func(string) string
+	aliases   map[string][]string
+	strict    bool
 }
 
-// expectedHeaderUnordered returns a HeaderOption to use that requires the
-// provided set of column names in any order.
-func expectedHeaderUnordered(columns []string) headerOption {
-	m := make(map[string]struct{})
-	for _, c := range columns {
-		m[c] = struct{}{}
+// resolveHeader returns a Header in which each value that matches an expected column,
+// possibly through an alias or after normalization, is replaced by the expected column name.
+func (o *headerOption) resolveHeader(values []string) (*Header, error) {
+	normalize := o.normalize
+	if normalize == nil {
+		normalize = func(s string) string { return s }
+	}
+	canonical := make(map[string]string)
+	for col := range o.expectedColumns {
+		canonical[normalize(col)] = col
+	}
+	for col, names := range o.aliases {
+		for _, name := range names {
+			canonical[normalize(name)] = col
+		}
+	}
+	canonicalRepeated := make(map[string]string)
+	for col := range o.repeatedColumns {
+		canonicalRepeated[normalize(col)] = col
 	}
-	return headerOption{expectedColumns: m}
-}
 
-// noHeader returns a HeaderOption that asserts that no header
-func noHeader(predeterminedHeader *Header) headerOption {
-	if predeterminedHeader == nil {
-		panic("nil predeterminedHeader")
+	resolved := make([]string, len(values))
+	matchedBy := make(map[string]string)
+	var extra []string
+	for i, v := range values {
+		col, ok := canonical[normalize(v)]
+		if !ok {
+			resolved[i] = v
+			if col, ok := canonicalRepeated[normalize(v)]; ok {
+				resolved[i] = col
+				continue
+			}
+			if base, n, ok := splitNumberedColumnName(v); ok {
+				if col, ok := canonicalRepeated[normalize(base)]; ok {
+					resolved[i] = fmt.Sprintf("%s_%d", col, n)
+					continue
+				}
+			}
+			extra = append(extra, fmt.Sprintf("%q", v))
+			continue
+		}
+		if prev, dup := matchedBy[col]; dup && prev != v {
+			return nil, fmt.Errorf("header values %q and %q both match column %q", prev, v, col)
+		}
+		matchedBy[col] = v
+		resolved[i] = col
 	}
-	return headerOption{noHeader: true, predeterminedHeader: predeterminedHeader}
+
+	missing := []string{}
+	for wantCol := range o.expectedColumns {
+		if _, ok := matchedBy[wantCol]; !ok {
+			missing = append(missing, fmt.Sprintf("%q", wantCol))
+		}
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("header row is missing %d columns: %s", len(missing), strings.Join(missing, ", "))
+	}
+	if o.strict && len(extra) != 0 {
+		return nil, fmt.Errorf("header row has %d unexpected columns: %s", len(extra), strings.Join(extra, ", "))
+	}
+	return NewHeader(resolved), nil
+}
+
+func normalizeCaseAndSpace(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), ""))
 }
@@ -0,0 +1,59 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvcoder
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/google/xtoproto/textcoder"
+)
+
+var defaultRegistry = NewRegistry(textcoder.DefaultRegistry())
+
+// Registry is a set of registered row struct types. Each Registry decodes and encodes
+// cells using a textcoder.Registry, so libraries that need different textual forms of the
+// same Go type may use separate registries.
+//
+// The package-level functions use the default registry. A Registry is safe for concurrent
+// use by multiple goroutines.
+type Registry struct {
+	textRegistry *textcoder.Registry
+
+	mu                 sync.RWMutex
+	cellParsers        map[reflect.Type]*registeredCellParser
+	registeredRowTypes map[reflect.Type]*registeredType
+}
+
+// NewRegistry returns a new Registry that decodes and encodes cells using the given
+// textcoder.Registry.
+func NewRegistry(textRegistry *textcoder.Registry) *Registry {
+	return &Registry{
+		textRegistry:       textRegistry,
+		cellParsers:        make(map[reflect.Type]*registeredCellParser),
+		registeredRowTypes: make(map[reflect.Type]*registeredType),
+	}
+}
+
+// DefaultRegistry returns the registry used by the package-level functions. It uses
+// textcoder.DefaultRegistry().
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// TextRegistry returns the textcoder.Registry used to decode and encode cells.
+func (r *Registry) TextRegistry() *textcoder.Registry {
+	return r.textRegistry
+}
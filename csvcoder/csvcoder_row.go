@@ -37,22 +37,26 @@ package csvcoder
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
-)
-
-// Registered row types.
-var (
-	defaultRegistry = newRegistry()
 )
 
 // ParseRow returns an error if the row fails to parse.
 //
 // If the destination object has a `ParseCSVRow(*Row) error` method, that method
-// will be called on the destination object.
-//
+// will be called on the destination object. Otherwise, every field is parsed
+// even if an earlier field fails, and the returned error is a *RowError that
+// describes each cell that failed to parse.
 //
+// ParseRow uses the default Registry.
 func ParseRow(row *Row, destination interface{}) error {
+	return defaultRegistry.ParseRow(row, destination)
+}
+
+// ParseRow is like the package-level ParseRow function, but it uses row types
+// and cell decoders from the registry.
+func (r *Registry) ParseRow(row *Row, destination interface{}) error {
 	type parsable interface {
 		ParseCSVRow(row *Row) error
 	}
@@ -65,14 +69,12 @@ func ParseRow(row *Row, destination interface{}) error {
 		return nil
 	}
 	t := reflect.ValueOf(destination).Type()
-	p, err := getRegisteredTypeOrErr(t)
+	p, err := r.getRegisteredTypeOrErr(t)
 	if err != nil {
 		return row.errorf("failed to parse CSV row into destination %v: %w", destination, err)
 	}
-	if err := p.parser.ParseCSVRow(row, destination); err != nil {
-		return row.errorf("%w", err)
-	}
-	return nil
+	// The error is a *RowError, which includes the position of the row.
+	return p.parser.ParseCSVRow(row, destination)
 }
 
 // Row is passed to Unmarshal
@@ -145,17 +147,48 @@ func (r *Row) errorf(format string, a ...interface{}) error {
 type Header struct {
 	m      map[string]ColumnNumber
 	values []string
+	// repeated maps a column name to the columns with that name or with that name followed
+	// by "_N", ordered by N.
+	repeated map[string][]ColumnNumber
 }
 
 // NewHeader returns a Header based on the given values.
 func NewHeader(values []string) *Header {
-	h := &Header{make(map[string]ColumnNumber), values}
+	h := &Header{make(map[string]ColumnNumber), values, make(map[string][]ColumnNumber)}
+	numbers := make(map[ColumnNumber]int)
 	for i, s := range values {
 		h.m[s] = ColumnNumber(i)
+		h.repeated[s] = append(h.repeated[s], ColumnNumber(i))
+		if base, n, ok := splitNumberedColumnName(s); ok {
+			h.repeated[base] = append(h.repeated[base], ColumnNumber(i))
+			numbers[ColumnNumber(i)] = n
+		}
+	}
+	for _, cols := range h.repeated {
+		sort.SliceStable(cols, func(i, j int) bool { return numbers[cols[i]] < numbers[cols[j]] })
 	}
 	return h
 }
 
+// repeatedColumnIndexes returns the indexes of the columns named col or numbered columns
+// named col_1, col_2, etc.
+func (h *Header) repeatedColumnIndexes(col string) []ColumnNumber {
+	return h.repeated[col]
+}
+
+// splitNumberedColumnName splits a column name like "tag_2" into its base name and number.
+func splitNumberedColumnName(name string) (string, int, bool) {
+	i := strings.LastIndexByte(name, '_')
+	if i <= 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 || strconv.Itoa(n) != name[i+1:] {
+		return "", 0, false
+	}
+	return name[:i], n, true
+}
+
 // ColumnIndex returns the index of the column with the given name.
 func (h *Header) ColumnIndex(col string) ColumnNumber {
 	cn, ok := h.m[col]
@@ -188,19 +221,56 @@ type RegisterOption struct {
 //
 // 3. Let FT be the Go type of the field. If there is a registered decoder for
 // *FT, that decoder will be used to decode the string value of the field
-// with the name from step 2 into the field of a row being parsed. If there is
-// no registered decoder for *FT, RegisterRowStruct will panic and
+// with the name from step 2 into the field of a row being parsed. Fields of
+// unnamed slice types such as []string and fields with a `csv-delimiter` tag
+// skip this step and are handled by steps 5 and 6; other slice types use the
+// textcoder's delimited slice coder.
+//
+// 4. Otherwise, if FT is a pointer type *T, the cell is decoded as a T. An empty
+// cell leaves the field nil.
+//
+// 5. Otherwise, if FT is a slice type []T and the field has a `csv-delimiter`
+// tag, the cell is split on the delimiter and each part is decoded as a T. An
+// empty cell is an empty slice.
+//
+// 6. Otherwise, if FT is a slice type []T, the slice contains the non-empty
+// values of every column with the name from step 2, followed by the values of
+// numbered columns such as "tag_1", "tag_2", in order of their number. These
+// columns are optional.
+//
+// 7. Otherwise, if FT is a struct type and the field has a `csv-prefix` tag or is
+// embedded, the fields of the struct are treated as fields of the row struct.
+// Their column names are prefixed by the value of the `csv-prefix` tag, so a
+// field with `csv-prefix:"billing_"` and a nested field named "city" is
+// backed by the "billing_city" column.
+//
+// If none of these rules applies, RegisterRowStruct will panic and
 // SafeRegisterRowStruct returns an error.
+//
+// RegisterRowStruct registers the type with the default Registry.
 func RegisterRowStruct(t reflect.Type, opt ...RegisterOption) {
-	if err := SafeRegisterRowStruct(t, opt...); err != nil {
+	defaultRegistry.RegisterRowStruct(t, opt...)
+}
+
+// SafeRegisterRowStruct calls RegisterRowStruct but returns an error instead of
+// panicking if there are any issues.
+func SafeRegisterRowStruct(t reflect.Type, opt ...RegisterOption) error {
+	return defaultRegistry.SafeRegisterRowStruct(t, opt...)
+}
+
+// RegisterRowStruct is like the package-level RegisterRowStruct function, but it
+// registers the type with the registry. Fields are decoded using the registry's
+// textcoder.Registry.
+func (r *Registry) RegisterRowStruct(t reflect.Type, opt ...RegisterOption) {
+	if err := r.SafeRegisterRowStruct(t, opt...); err != nil {
 		panic(fmt.Errorf("RegisterStruct failed: %w", err))
 	}
 }
 
 // SafeRegisterRowStruct calls RegisterRowStruct but returns an error instead of
 // panicking if there are any issues.
-func SafeRegisterRowStruct(t reflect.Type, opt ...RegisterOption) error {
-	_, err := getOrRegisterType(t, opt...)
+func (r *Registry) SafeRegisterRowStruct(t reflect.Type, opt ...RegisterOption) error {
+	_, err := r.getOrRegisterType(t, opt...)
 	return err
 }
 
@@ -211,8 +281,13 @@ type rowParser interface {
 type registeredType struct {
 	t                   reflect.Type
 	requiredColumnNames map[string]struct{}
+	// repeatedColumnNames are the names of slice fields gathered from repeated or numbered
+	// columns, which need not be present in the header.
+	repeatedColumnNames map[string]struct{}
 	parser              *structParser
 	makeZero            func() interface{}
+	// fields are the fields of the struct backed by columns, in field order.
+	fields []*rowField
 }
 
 func (rt *registeredType) parseRow(row *Row) (interface{}, error) {
@@ -221,112 +296,91 @@ func (rt *registeredType) parseRow(row *Row) (interface{}, error) {
 	return v, err
 }
 
-func getRegisteredType(t reflect.Type) *registeredType {
-	var rt *registeredType
-	func() {
-		defaultRegistry.registeredRowTypesLock.RLock()
-		defer defaultRegistry.registeredRowTypesLock.RUnlock()
-		rt = defaultRegistry.registeredRowTypes[t]
-	}()
-	return rt
+func (r *Registry) getRegisteredType(t reflect.Type) *registeredType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.registeredRowTypes[t]
 }
 
-func getRegisteredTypeOrErr(t reflect.Type) (*registeredType, error) {
-	rt := getRegisteredType(t)
+func (r *Registry) getRegisteredTypeOrErr(t reflect.Type) (*registeredType, error) {
+	rt := r.getRegisteredType(t)
 	if rt == nil {
 		var typeStrings []string
-		for _, rt := range defaultRegistry.registeredRowTypes {
-			typeStrings = append(typeStrings, fmt.Sprintf("%v", rt))
+		r.mu.RLock()
+		for rt := range r.registeredRowTypes {
+			typeStrings = append(typeStrings, rt.String())
 		}
+		r.mu.RUnlock()
+		sort.Strings(typeStrings)
 		return nil, fmt.Errorf("no CSV row parser registered for type %v; registered types: [%s]", t, strings.Join(typeStrings, ", "))
 	}
 	return rt, nil
 }
 
-func getOrRegisterType(t reflect.Type, opt ...RegisterOption) (*registeredType, error) {
-	if rt := getRegisteredType(t); rt != nil {
+func (r *Registry) getOrRegisterType(t reflect.Type, opt ...RegisterOption) (*registeredType, error) {
+	if rt := r.getRegisteredType(t); rt != nil {
 		return rt, nil
 	}
-	rt, err := inferRegisteredType(t, opt...)
+	rt, err := r.inferRegisteredType(t, opt...)
 	if err != nil {
 		return nil, err
 	}
-	defaultRegistry.registeredRowTypesLock.Lock()
-	defer defaultRegistry.registeredRowTypesLock.Unlock()
-	defaultRegistry.registeredRowTypes[t] = rt
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Another goroutine may have registered the type while it was being inferred.
+	if existing := r.registeredRowTypes[t]; existing != nil {
+		return existing, nil
+	}
+	r.registeredRowTypes[t] = rt
 	return rt, nil
 }
 
-func inferRegisteredType(t reflect.Type, opt ...RegisterOption) (*registeredType, error) {
+func (r *Registry) inferRegisteredType(t reflect.Type, opt ...RegisterOption) (*registeredType, error) {
 	if !(t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct) {
 		return nil, fmt.Errorf("type %v is not a pointer to a struct, so could not infer a CSV row parser", t)
 	}
 
+	fields, err := r.inferRowFields(t.Elem(), "", nil)
+	if err != nil {
+		return nil, err
+	}
 	requiredColumns := make(map[string]struct{})
-	var valueExtractors []func(row *Row, dst reflect.Value) error
-	for i := 0; i < t.Elem().NumField(); i++ {
-		f := t.Elem().FieldByIndex([]int{i})
-		if _, ok := f.Tag.Lookup("csv-skip"); ok {
-			continue
-		}
-		colName, ok := f.Tag.Lookup("csv")
-		if !ok {
-			colName = f.Name
+	repeatedColumns := make(map[string]struct{})
+	var fieldParsers []func(row *Row, dst reflect.Value) []*CellError
+	for _, f := range fields {
+		if f.shape == repeatedSliceField {
+			repeatedColumns[f.columnName] = struct{}{}
+		} else {
+			requiredColumns[f.columnName] = struct{}{}
 		}
-		requiredColumns[colName] = struct{}{}
-
-		cellParser, err := getOrCreateCellParserForType(reflect.PtrTo(f.Type))
-		if err != nil {
-			return nil, err
-		}
-
-		valueExtractors = append(valueExtractors, func(row *Row, dstRow reflect.Value) error {
-			idx := row.Header().ColumnIndex(colName)
-			if !idx.IsValid() {
-				return fmt.Errorf("csv file missing required column %q", colName)
-			}
-			if idx.Offset() >= len(row.Strings()) {
-				return fmt.Errorf("csv row does not have a value for column %q", colName)
-			}
-			strValue := row.Strings()[idx.Offset()]
-			return cellParser.ParseCSVCell(NewCellContext(row), strValue, dstRow.Elem().FieldByIndex(f.Index).Addr())
-		})
-
+		fieldParsers = append(fieldParsers, f.parse)
 	}
 	return &registeredType{
-		t,
-		requiredColumns,
-		&structParser{valueExtractors},
-		func() interface{} {
+		t:                   t,
+		requiredColumnNames: requiredColumns,
+		repeatedColumnNames: repeatedColumns,
+		parser:              &structParser{fieldParsers},
+		makeZero: func() interface{} {
 			return reflect.New(t.Elem()).Interface()
 		},
+		fields: fields,
 	}, nil
 }
 
 type structParser struct {
-	fieldParsers []func(row *Row, dstRow reflect.Value) error
+	fieldParsers []func(row *Row, dstRow reflect.Value) []*CellError
 }
 
+// ParseCSVRow parses every field of dst. If any fields fail to parse, the returned error is a
+// *RowError describing each of them.
 func (p *structParser) ParseCSVRow(row *Row, dst interface{}) error {
 	dstReflect := reflect.ValueOf(dst)
+	var cellErrs []*CellError
 	for _, fp := range p.fieldParsers {
-		if err := fp(row, dstReflect); err != nil {
-			return row.errorf("error parsing struct row: %w", err)
-		}
+		cellErrs = append(cellErrs, fp(row, dstReflect)...)
 	}
-	return nil
-}
-
-type registry struct {
-	cellParsers            map[reflect.Type]*registeredCellParser
-	registeredRowTypes     map[reflect.Type]*registeredType
-	registeredRowTypesLock sync.RWMutex
-}
-
-func newRegistry() *registry {
-	return &registry{
-		make(map[reflect.Type]*registeredCellParser),
-		make(map[reflect.Type]*registeredType),
-		sync.RWMutex{},
+	if len(cellErrs) != 0 {
+		return &RowError{row.Path(), row.Number(), cellErrs}
 	}
+	return nil
 }
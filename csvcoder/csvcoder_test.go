@@ -16,12 +16,15 @@ package csvcoder
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/xtoproto/textcoder"
@@ -31,6 +34,8 @@ func init() {
 	RegisterRowStruct(reflect.TypeOf(&abee{}))
 	RegisterRowStruct(reflect.TypeOf(&implicitFields{}))
 	RegisterRowStruct(reflect.TypeOf(&measurements{}))
+	RegisterRowStruct(reflect.TypeOf(&order{}))
+	RegisterRowStruct(reflect.TypeOf(&scored{}))
 }
 
 type abee struct {
@@ -45,9 +50,37 @@ type implicitFields struct {
 type measurements struct {
 	// Both fields are backed by the same column.
 	Dist  distance
-	Dist2 *distance `csv-skip:"true"`
+	Dist2 *distance `csv:"Dist"`
 }
 
+type address struct {
+	Street string `csv:"street"`
+	City   string `csv:"city"`
+}
+
+type Audit struct {
+	CreatedBy string `csv:"created_by"`
+}
+
+type order struct {
+	ID       int      `csv:"id"`
+	Discount *float64 `csv:"discount"`
+	Labels   []string `csv:"labels" csv-delimiter:"|"`
+	Tags     []string `csv:"tag"`
+	Billing  address  `csv-prefix:"billing_"`
+	Audit
+}
+
+type scoreList []int
+
+type scored struct {
+	Name   string            `csv:"name"`
+	Scores scoreList         `csv:"scores"`
+	Attrs  map[string]string `csv:"attrs"`
+}
+
+func float64Ptr(v float64) *float64 { return &v }
+
 type distance float64 // in meters
 
 func (p *distance) UnmarshalText(textBytes []byte) error {
@@ -165,6 +198,7 @@ func TestFileParser(t *testing.T) {
 		prototype               interface{}
 		want                    []interface{}
 		wantNewErr, wantReadErr *regexp.Regexp
+		opts                    []FileParserOption
 	}
 	for _, tt := range []example{
 		{
@@ -177,6 +211,7 @@ func TestFileParser(t *testing.T) {
 			},
 			nil,
 			nil,
+			nil,
 		},
 		{
 			"abee - not enough columns",
@@ -185,23 +220,216 @@ func TestFileParser(t *testing.T) {
 			[]interface{}{},
 			regexp.MustCompile(`header row is missing.*"Bee"`),
 			nil,
+			nil,
 		},
 		{
 			"measurements",
 			joinWithNewlines(`Dist,extra`, `50  ,x`, ` 50 km,`),
 			&measurements{},
 			[]interface{}{
-				// TODO(reddaly): Restore support for pointer fields.
-				&measurements{Dist: 50, Dist2: nil /* distancePtr(50) */},
-				&measurements{Dist: 50000, Dist2: nil /* distancePtr(50000) */},
+				&measurements{Dist: 50, Dist2: distancePtr(50)},
+				&measurements{Dist: 50000, Dist2: distancePtr(50000)},
+			},
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"semicolon dialect",
+			joinWithNewlines(`# comment`, `A;Bee`, `"x;y";42`, `6"6;45`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "x;y", B: 42},
+				&abee{A: `6"6`, B: 45},
+			},
+			nil,
+			nil,
+			[]FileParserOption{WithDialect(Dialect{Comma: ';', Comment: '#', LazyQuotes: true})},
+		},
+		{
+			"predetermined header",
+			joinWithNewlines(`xy,42`, `66,45`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+				&abee{A: "66", B: 45},
+			},
+			nil,
+			nil,
+			[]FileParserOption{WithPredeterminedHeader([]string{"A", "Bee"})},
+		},
+		{
+			"predetermined header - missing column",
+			joinWithNewlines(`xy,42`, `66,45`),
+			&abee{},
+			[]interface{}{},
+			regexp.MustCompile(`header row is missing.*"Bee"`),
+			nil,
+			[]FileParserOption{WithPredeterminedHeader([]string{"A", "B"})},
+		},
+		{
+			"header row offset",
+			joinWithNewlines(`Exported by system X`, `on 2020-01-01,at noon,UTC`, `A,Bee`, `xy,42`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+			},
+			nil,
+			nil,
+			[]FileParserOption{WithHeaderRowOffset(2)},
+		},
+		{
+			"header row offset with predetermined header",
+			joinWithNewlines(`preamble`, `xy,42`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+			},
+			nil,
+			nil,
+			[]FileParserOption{WithHeaderRowOffset(1), WithPredeterminedHeader([]string{"A", "Bee"})},
+		},
+		{
+			"case and space insensitive - missing column",
+			joinWithNewlines(` a ,Bees`, `xy,42`),
+			&abee{},
+			nil,
+			regexp.MustCompile(`header row is missing 1 columns: "Bee"`),
+			nil,
+			[]FileParserOption{IgnoreColumnCaseAndSpace()},
+		},
+		{
+			"case and space insensitive - all columns",
+			joinWithNewlines(` a ,B ee`, `xy,42`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+			},
+			nil,
+			nil,
+			[]FileParserOption{IgnoreColumnCaseAndSpace()},
+		},
+		{
+			"aliases",
+			joinWithNewlines(`A,bee count`, `xy,42`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+			},
+			nil,
+			nil,
+			[]FileParserOption{WithColumnAliases(map[string][]string{"Bee": {"Bees", "Bee Count"}}), IgnoreColumnCaseAndSpace()},
+		},
+		{
+			"aliases - ambiguous",
+			joinWithNewlines(`A,Bee,Bees`, `xy,42,43`),
+			&abee{},
+			nil,
+			regexp.MustCompile(`header values "Bee" and "Bees" both match column "Bee"`),
+			nil,
+			[]FileParserOption{WithColumnAliases(map[string][]string{"Bee": {"Bees"}})},
+		},
+		{
+			"strict - extra columns",
+			joinWithNewlines(`A,Bee,C`, `xy,42,1`),
+			&abee{},
+			nil,
+			regexp.MustCompile(`header row has 1 unexpected columns: "C"`),
+			nil,
+			[]FileParserOption{StrictColumns()},
+		},
+		{
+			"strict - exact columns",
+			joinWithNewlines(`Bee,A`, `42,xy`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "xy", B: 42},
+			},
+			nil,
+			nil,
+			[]FileParserOption{StrictColumns()},
+		},
+		{
+			"pointer, slice and nested fields",
+			joinWithNewlines(
+				`id,discount,labels,tag_2,tag_1,billing_street,billing_city,created_by`,
+				`1,,a|b,y,x,1 Main St,Springfield,ann`,
+				`2,0.5,,,z,,,bob`),
+			&order{},
+			[]interface{}{
+				&order{ID: 1, Labels: []string{"a", "b"}, Tags: []string{"x", "y"}, Billing: address{"1 Main St", "Springfield"}, Audit: Audit{"ann"}},
+				&order{ID: 2, Discount: float64Ptr(.5), Labels: []string{}, Tags: []string{"z"}, Audit: Audit{"bob"}},
+			},
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"named slice and map fields",
+			joinWithNewlines(`name,scores,attrs`, `a,"1,2",k=v;k2=v2`, `b,,`),
+			&scored{},
+			[]interface{}{
+				&scored{Name: "a", Scores: scoreList{1, 2}, Attrs: map[string]string{"k": "v", "k2": "v2"}},
+				&scored{Name: "b", Scores: scoreList{}, Attrs: map[string]string{}},
+			},
+			nil,
+			nil,
+			nil,
+		},
+		{
+			"repeated columns",
+			joinWithNewlines(`id,discount,labels,tag,tag,billing_street,billing_city,created_by`, `1,,,x,y,,,`),
+			&order{},
+			[]interface{}{
+				&order{ID: 1, Labels: []string{}, Tags: []string{"x", "y"}},
+			},
+			nil,
+			nil,
+			[]FileParserOption{StrictColumns()},
+		},
+		{
+			"nested fields - missing prefixed column",
+			joinWithNewlines(`id,discount,labels,street,city,created_by`, `1,,,,,`),
+			&order{},
+			nil,
+			regexp.MustCompile(`header row is missing 2 columns: "billing_city", "billing_street"`),
+			nil,
+			nil,
+		},
+		{
+			"invalid pointer value",
+			joinWithNewlines(`id,discount,labels,billing_street,billing_city,created_by`, `1,x,,,,`),
+			&order{},
+			nil,
+			nil,
+			regexp.MustCompile(`column "discount": cannot parse "x" as \*float64`),
+			nil,
+		},
+		{
+			"invalid value",
+			joinWithNewlines(`A,Bee`, `xy,42`, `66,4x5`),
+			&abee{},
+			nil,
+			nil,
+			regexp.MustCompile(`^test\.csv:3: column "Bee": cannot parse "4x5" as int`),
+			nil,
+		},
+		{
+			"skip invalid rows",
+			joinWithNewlines(`A,Bee`, `xy,4x2`, `66,45`, `too,many,values`, `77,46`),
+			&abee{},
+			[]interface{}{
+				&abee{A: "66", B: 45},
+				&abee{A: "77", B: 46},
 			},
 			nil,
 			nil,
+			[]FileParserOption{SkipInvalidRows()},
 		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			cr := csv.NewReader(strings.NewReader(tt.csvIn))
-			fp, err := NewFileParser(cr, "test.csv", tt.prototype)
+			fp, err := NewFileParser(cr, "test.csv", tt.prototype, tt.opts...)
 			checkErr(t, err, tt.wantNewErr, "NewFileParser")
 			if err != nil {
 				return
@@ -223,6 +451,180 @@ func TestFileParser(t *testing.T) {
 	}
 }
 
+func TestParseRowReportsAllCellErrors(t *testing.T) {
+	type pair struct {
+		X int     `csv:"x"`
+		Y float64 `csv:"y"`
+		Z string  `csv:"z"`
+	}
+	RegisterRowStruct(reflect.TypeOf(&pair{}))
+	err := ParseRow(NewRow([]string{"1x", "2y"}, NewHeader([]string{"x", "y"}), 4, "test.csv"), &pair{})
+	var rowErr *RowError
+	if !errors.As(err, &rowErr) {
+		t.Fatalf("ParseRow returned %v, want a *RowError", err)
+	}
+	var got []string
+	for _, ce := range rowErr.CellErrors {
+		got = append(got, fmt.Sprintf("%s:%d:%d:%s:%q:%v:%v", ce.Path, ce.RowNumber, ce.ColumnNumber, ce.ColumnName, ce.Value, ce.GoType, ce.Kind))
+	}
+	want := []string{
+		`test.csv:4:0:x:"1x":int:invalid value`,
+		`test.csv:4:1:y:"2y":float64:invalid value`,
+		`test.csv:4:-1:z:"":string:missing column`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected cell errors (-want, +got):\n%s", diff)
+	}
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("errors.Is(%v, strconv.ErrSyntax) = false, want true", err)
+	}
+	if got, want := err.Error(), "test.csv:5: 3 cells failed to parse: "; !strings.HasPrefix(got, want) {
+		t.Errorf("got error %q, want prefix %q", got, want)
+	}
+}
+
+func TestFileParserErrorSummary(t *testing.T) {
+	in := joinWithNewlines(`A,Bee`, `xy,4x2`, `66,45`, `too,many,values`, `77,4y6`, `88,47`)
+	fp, err := NewFileParser(csv.NewReader(strings.NewReader(in)), "test.csv", &abee{}, SkipInvalidRows())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fp.ReadAll(func(interface{}) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	summary := fp.ErrorSummary()
+	if got, want := summary.String(), joinWithNewlines(
+		`parsed 2 rows, skipped 3 rows`,
+		`  invalid value: 2`,
+		`  malformed row: 1`,
+		`  column "Bee": 2`); got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if got, want := len(summary.Errors), 3; got != want {
+		t.Errorf("got %d errors, want %d", got, want)
+	}
+}
+
+func TestFileWriterRowStructShapes(t *testing.T) {
+	records := []interface{}{
+		&order{ID: 1, Labels: []string{"a", "b"}, Tags: []string{"x", "y"}, Billing: address{"1 Main St", "Springfield"}, Audit: Audit{"ann"}},
+		&order{ID: 2, Discount: float64Ptr(.5), Labels: []string{}, Tags: []string{}, Audit: Audit{"bob"}},
+	}
+	columns := []string{"id", "discount", "labels", "tag_1", "tag_2", "billing_street", "billing_city", "created_by"}
+	out := &strings.Builder{}
+	fw, err := NewFileWriter(csv.NewWriter(out), &order{}, WithColumns(columns))
+	if err != nil {
+		t.Fatalf("NewFileWriter error: %v", err)
+	}
+	if err := fw.WriteAll(records); err != nil {
+		t.Fatalf("WriteAll error: %v", err)
+	}
+	want := joinWithNewlines(
+		`id,discount,labels,tag_1,tag_2,billing_street,billing_city,created_by`,
+		`1,,a|b,x,y,1 Main St,Springfield,ann`,
+		`2,0.5,,,,,,bob`,
+		``)
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+	}
+
+	fp, err := NewFileParser(csv.NewReader(strings.NewReader(out.String())), "test.csv", &order{})
+	if err != nil {
+		t.Fatalf("NewFileParser error: %v", err)
+	}
+	var got []interface{}
+	if err := fp.ReadAll(func(v interface{}) error {
+		got = append(got, v)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadAll error: %v", err)
+	}
+	if diff := cmp.Diff(records, got); diff != "" {
+		t.Errorf("unexpected round trip diff (-want, +got):\n%s", diff)
+	}
+
+	_, err = EncodeRow(&order{Tags: []string{"x"}}, nil)
+	checkErr(t, err, regexp.MustCompile(`column "tag" has 1 values, but the header has 0 columns for them`), "EncodeRow")
+}
+
+func TestRegistriesAreIndependent(t *testing.T) {
+	type reading struct {
+		When time.Time `csv:"when"`
+	}
+	newRegistry := func(layout string) *Registry {
+		tr := textcoder.NewRegistry()
+		if err := tr.Register(reflect.TypeOf(time.Time{}),
+			func(v time.Time) (string, error) { return v.Format(layout), nil },
+			func(s string, dst *time.Time) error {
+				v, err := time.Parse(layout, s)
+				*dst = v
+				return err
+			}); err != nil {
+			t.Fatal(err)
+		}
+		reg := NewRegistry(tr)
+		reg.RegisterRowStruct(reflect.TypeOf(&reading{}))
+		return reg
+	}
+	iso, european := newRegistry("2006-01-02"), newRegistry("02/01/2006")
+	want := &reading{time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)}
+	for _, tt := range []struct {
+		reg  *Registry
+		text string
+	}{
+		{iso, "2020-03-04"},
+		{european, "04/03/2020"},
+	} {
+		got := &reading{}
+		if err := tt.reg.ParseRow(NewRow([]string{tt.text}, NewHeader([]string{"when"}), 1, "test.csv"), got); err != nil {
+			t.Fatalf("ParseRow(%q) error: %v", tt.text, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("ParseRow(%q) unexpected diff (-want, +got):\n%s", tt.text, diff)
+		}
+		values, err := tt.reg.EncodeRow(got, nil)
+		if err != nil {
+			t.Fatalf("EncodeRow error: %v", err)
+		}
+		if diff := cmp.Diff([]string{tt.text}, values); diff != "" {
+			t.Errorf("EncodeRow unexpected diff (-want, +got):\n%s", diff)
+		}
+	}
+	// The default registry decodes time.Time values using UnmarshalText, which expects RFC 3339.
+	RegisterRowStruct(reflect.TypeOf(&reading{}))
+	if err := ParseRow(NewRow([]string{"2020-03-04"}, NewHeader([]string{"when"}), 1, "test.csv"), &reading{}); err == nil {
+		t.Errorf("default registry parsed a value using the layout of another registry")
+	}
+}
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	type row struct {
+		A string  `csv:"A"`
+		B int     `csv:"Bee"`
+		C *string `csv:"C"`
+	}
+	reg := NewRegistry(textcoder.DefaultRegistry())
+	in := joinWithNewlines(`A,Bee,C`, `xy,42,z`, `66,45,`)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, r := range []*Registry{reg, DefaultRegistry()} {
+				fp, err := r.NewFileParser(csv.NewReader(strings.NewReader(in)), "test.csv", &row{})
+				if err != nil {
+					t.Errorf("NewFileParser error: %v", err)
+					return
+				}
+				if err := fp.ReadAll(func(interface{}) error { return nil }); err != nil {
+					t.Errorf("ReadAll error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func checkErr(t *testing.T, err error, wantErr *regexp.Regexp, prefix string) {
 	if gotErr, wantErr := err != nil, wantErr != nil; gotErr != wantErr {
 		t.Fatalf("%s: got err %v, wantErr = %v", prefix, err, wantErr)
@@ -263,3 +665,124 @@ func Test_ParseCell(t *testing.T) {
 		t.Errorf("got %v, want %v", myX, 55)
 	}
 }
+
+func TestFileWriterRoundTrip(t *testing.T) {
+	type reading struct {
+		Station  string    `csv:"station"`
+		Temp     float64   `csv:"temp_c"`
+		Humidity float32   `csv:"humidity"`
+		Count    int64     `csv:"count"`
+		Valid    bool      `csv:"valid"`
+		Dist     distance  `csv:"dist"`
+		Note     string    `csv-skip:""`
+		Speed    windSpeed `csv:"wind"`
+	}
+	RegisterRowStruct(reflect.TypeOf(&reading{}))
+
+	in := joinWithNewlines(
+		`station,temp_c,humidity,count,valid,dist,wind`,
+		`"Oslo, NO",-3.1415926535,0.55,9007199254740993,true,1250,12kn`,
+		`"quote ""q""",1e-07,0.1,-1,false,0.001,0kn`,
+		``)
+	fp, err := NewFileParser(csv.NewReader(strings.NewReader(in)), "in.csv", &reading{})
+	if err != nil {
+		t.Fatalf("NewFileParser() error: %v", err)
+	}
+	var records []interface{}
+	if err := fp.ReadAll(func(v interface{}) error {
+		records = append(records, v)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadAll() error: %v", err)
+	}
+
+	out := &strings.Builder{}
+	fw, err := NewFileWriter(csv.NewWriter(out), &reading{})
+	if err != nil {
+		t.Fatalf("NewFileWriter() error: %v", err)
+	}
+	if err := fw.WriteAll(records); err != nil {
+		t.Fatalf("WriteAll() error: %v", err)
+	}
+
+	fp2, err := NewFileParser(csv.NewReader(strings.NewReader(out.String())), "out.csv", &reading{})
+	if err != nil {
+		t.Fatalf("NewFileParser() error: %v", err)
+	}
+	var got []interface{}
+	if err := fp2.ReadAll(func(v interface{}) error {
+		got = append(got, v)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadAll() error: %v", err)
+	}
+	if diff := cmp.Diff(records, got); diff != "" {
+		t.Errorf("records changed after round trip (-want, +got):\n%s\noutput:\n%s", diff, out.String())
+	}
+}
+
+func TestEncodeRow(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		src     interface{}
+		header  []string
+		want    []string
+		wantErr *regexp.Regexp
+	}{
+		{"default header", &abee{A: "xy", B: 42}, nil, []string{"xy", "42"}, nil},
+		{"custom header", &abee{A: "xy", B: 42}, []string{"Bee", "extra", "A"}, []string{"42", "", "xy"}, nil},
+		{"nil record", (*abee)(nil), nil, nil, regexp.MustCompile("cannot encode nil")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var hdr *Header
+			if tt.header != nil {
+				hdr = NewHeader(tt.header)
+			}
+			got, err := EncodeRow(tt.src, hdr)
+			checkErr(t, err, tt.wantErr, "EncodeRow")
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// windSpeed is a speed in knots that implements encoding.TextMarshaler with a pointer
+// receiver.
+type windSpeed int
+
+func (w *windSpeed) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%dkn", int(*w))), nil
+}
+
+func (w *windSpeed) UnmarshalText(text []byte) error {
+	v, err := strconv.Atoi(strings.TrimSuffix(string(text), "kn"))
+	*w = windSpeed(v)
+	return err
+}
+
+func TestFileWriterOptions(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		opts    []FileWriterOption
+		want    string
+		wantErr *regexp.Regexp
+	}{
+		{"default", nil, joinWithNewlines(`A,Bee`, `xy,42`, ``), nil},
+		{"columns", []FileWriterOption{WithColumns([]string{"Bee", "unused", "A"})}, joinWithNewlines(`Bee,unused,A`, `42,,xy`, ``), nil},
+		{"without header row", []FileWriterOption{WithoutHeaderRow()}, joinWithNewlines(`xy,42`, ``), nil},
+		{"missing column", []FileWriterOption{WithColumns([]string{"A"})}, "", regexp.MustCompile(`header is missing column "Bee"`)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &strings.Builder{}
+			fw, err := NewFileWriter(csv.NewWriter(out), &abee{}, tt.opts...)
+			checkErr(t, err, tt.wantErr, "NewFileWriter")
+			if err := fw.WriteAll([]interface{}{&abee{A: "xy", B: 42}}); err != nil {
+				t.Fatalf("WriteAll() error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, out.String()); diff != "" {
+				t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
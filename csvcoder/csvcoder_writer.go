@@ -0,0 +1,189 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvcoder
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+)
+
+// RowHeader returns the header of a CSV file containing values of the given registered row
+// struct type. The column names are those used to parse the struct, in field order.
+func RowHeader(recordPrototype interface{}) (*Header, error) {
+	return defaultRegistry.RowHeader(recordPrototype)
+}
+
+// RowHeader is like the package-level RowHeader function, but it uses row types from the
+// registry.
+func (r *Registry) RowHeader(recordPrototype interface{}) (*Header, error) {
+	rt, err := r.getOrRegisterType(reflect.TypeOf(recordPrototype))
+	if err != nil {
+		return nil, fmt.Errorf("could not find or infer coder for type %v: %w", reflect.TypeOf(recordPrototype), err)
+	}
+	return rt.header(), nil
+}
+
+// EncodeRow returns the textual values of a registered row struct, ordered according to
+// the columns of the header. Columns that are not backed by a field of the struct are left
+// empty. If header is nil, the header returned by RowHeader is used.
+//
+// Each field is encoded using the textcoder Encoder for the type of the field, so values
+// written by EncodeRow can be parsed by ParseRow. Fields are encoded with a
+// textcoder.Context that has exact floats (see textcoder.Context.WithExactFloats), so
+// float values survive the round trip.
+func EncodeRow(src interface{}, header *Header) ([]string, error) {
+	return defaultRegistry.EncodeRow(src, header)
+}
+
+// EncodeRow is like the package-level EncodeRow function, but it uses row types and cell
+// encoders from the registry.
+func (r *Registry) EncodeRow(src interface{}, header *Header) ([]string, error) {
+	rt, err := r.getOrRegisterType(reflect.TypeOf(src))
+	if err != nil {
+		return nil, fmt.Errorf("could not find or infer coder for type %v: %w", reflect.TypeOf(src), err)
+	}
+	if header == nil {
+		header = rt.header()
+	}
+	return rt.encodeRow(src, header)
+}
+
+// FileWriter is an object used to write an entire CSV file.
+type FileWriter struct {
+	w             *csv.Writer
+	rt            *registeredType
+	hdr           *Header
+	omitHeaderRow bool
+}
+
+// NewFileWriter returns an object for writing a set of records to a file. The header row
+// is written immediately unless the WithoutHeaderRow option is given.
+//
+// The type of the recordPrototype should have been registered with a call to
+// RegisterRowStruct, and each of its fields must have a registered textcoder.Encoder.
+// NewFileWriter uses the default Registry.
+func NewFileWriter(w *csv.Writer, recordPrototype interface{}, opts ...FileWriterOption) (*FileWriter, error) {
+	return defaultRegistry.NewFileWriter(w, recordPrototype, opts...)
+}
+
+// NewFileWriter is like the package-level NewFileWriter function, but it uses row types and
+// cell encoders from the registry.
+func (r *Registry) NewFileWriter(w *csv.Writer, recordPrototype interface{}, opts ...FileWriterOption) (*FileWriter, error) {
+	rt, err := r.getOrRegisterType(reflect.TypeOf(recordPrototype))
+	if err != nil {
+		return nil, fmt.Errorf("could not find or infer coder for type %v: %w", reflect.TypeOf(recordPrototype), err)
+	}
+	fw := &FileWriter{w: w, rt: rt, hdr: rt.header()}
+	for _, opt := range opts {
+		opt(fw)
+	}
+	for _, f := range rt.fields {
+		if _, err := f.encoder(); err != nil {
+			return nil, err
+		}
+		if f.shape != repeatedSliceField && !fw.hdr.ColumnIndex(f.columnName).IsValid() {
+			return nil, fmt.Errorf("header is missing column %q of %v", f.columnName, rt.t)
+		}
+	}
+	if fw.omitHeaderRow {
+		return fw, nil
+	}
+	if err := w.Write(fw.hdr.ColumnNames()); err != nil {
+		return nil, fmt.Errorf("error writing header row: %w", err)
+	}
+	return fw, nil
+}
+
+// FileWriterOption customizes the behavior of a FileWriter.
+type FileWriterOption func(fw *FileWriter)
+
+// WithColumns returns an option that sets the columns written by the FileWriter and their
+// order. Every column of the record type must be included. Columns that do not correspond to
+// a field of the record type are left empty.
+func WithColumns(columnNames []string) FileWriterOption {
+	return func(fw *FileWriter) {
+		fw.hdr = NewHeader(columnNames)
+	}
+}
+
+// WithoutHeaderRow returns an option that causes the FileWriter to write only data rows, for
+// files that are parsed using WithPredeterminedHeader.
+func WithoutHeaderRow() FileWriterOption {
+	return func(fw *FileWriter) {
+		fw.omitHeaderRow = true
+	}
+}
+
+// Header returns the columns written by the FileWriter.
+func (fw *FileWriter) Header() *Header {
+	return fw.hdr
+}
+
+// Write writes a record to the file. The record must be of the same type as the prototype
+// passed to NewFileWriter.
+func (fw *FileWriter) Write(record interface{}) error {
+	if got := reflect.TypeOf(record); got != fw.rt.t {
+		return fmt.Errorf("FileWriter for %v cannot write a record of type %v", fw.rt.t, got)
+	}
+	values, err := fw.rt.encodeRow(record, fw.hdr)
+	if err != nil {
+		return err
+	}
+	return fw.w.Write(values)
+}
+
+// WriteAll writes each of the records to the file and flushes the underlying csv.Writer.
+func (fw *FileWriter) WriteAll(records []interface{}) error {
+	for _, r := range records {
+		if err := fw.Write(r); err != nil {
+			return err
+		}
+	}
+	return fw.Flush()
+}
+
+// Flush writes any buffered data to the underlying io.Writer and returns any error that
+// occurred during a previous write or flush.
+func (fw *FileWriter) Flush() error {
+	fw.w.Flush()
+	return fw.w.Error()
+}
+
+func (rt *registeredType) header() *Header {
+	var names []string
+	seen := make(map[string]bool)
+	for _, f := range rt.fields {
+		if f.shape != repeatedSliceField && !seen[f.columnName] {
+			seen[f.columnName] = true
+			names = append(names, f.columnName)
+		}
+	}
+	return NewHeader(names)
+}
+
+func (rt *registeredType) encodeRow(src interface{}, header *Header) ([]string, error) {
+	srcValue := reflect.ValueOf(src)
+	if srcValue.IsNil() {
+		return nil, fmt.Errorf("cannot encode nil %v", rt.t)
+	}
+	values := make([]string, len(header.ColumnNames()))
+	for _, f := range rt.fields {
+		if err := f.encode(srcValue, header, values); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
@@ -18,27 +18,102 @@
 package csvinfer
 
 import (
-	"encoding/csv"
+	"bufio"
+	"fmt"
+	"io"
 	"strings"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/xtoproto/recordinfer"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
 )
 
 // InferProto returns a guess at the schema of a provided CSV sample. The input
-// may be a full CSV file, but users should note that values are kept in memory during
-// inference.
+// may be a full CSV file. To avoid holding a large file in memory, use InferProtoFromReader.
 func InferProto(csvLines string, opts *recordinfer.Options) (*recordinfer.InferredProto, error) {
-	reader := csv.NewReader(strings.NewReader(csvLines))
-	rows, err := reader.ReadAll()
+	return InferProtoFromReader(strings.NewReader(csvLines), opts)
+}
+
+// InferProtoFromReader is like InferProto but reads CSV records from r one at a time.
+// Inference state is updated incrementally, so memory use does not grow with the number of
+// records. Reading stops early once opts.MaxRows records have been inspected.
+func InferProtoFromReader(r io.Reader, opts *recordinfer.Options) (*recordinfer.InferredProto, error) {
+	b, err := newInferrer(r, opts)
 	if err != nil {
 		return nil, err
 	}
+	return b.Build()
+}
 
-	b := recordinfer.NewRecordBasedInferrer(opts)
+// InferProtoCandidates is like InferProto but returns up to n alternative schemas, ordered
+// from most to least likely. See recordinfer.RecordBasedInferrer.BuildCandidates.
+func InferProtoCandidates(csvLines string, n int, opts *recordinfer.Options) ([]*recordinfer.InferredProto, error) {
+	return InferProtoCandidatesFromReader(strings.NewReader(csvLines), n, opts)
+}
 
-	for _, row := range rows {
-		b.AddRow(row)
+// InferProtoCandidatesFromReader is like InferProtoCandidates but reads CSV records from r one
+// at a time. See InferProtoFromReader.
+func InferProtoCandidatesFromReader(r io.Reader, n int, opts *recordinfer.Options) ([]*recordinfer.InferredProto, error) {
+	b, err := newInferrer(r, opts)
+	if err != nil {
+		return nil, err
 	}
+	return b.BuildCandidates(n)
+}
 
-	return b.Build()
+func newInferrer(r io.Reader, opts *recordinfer.Options) (*recordinfer.RecordBasedInferrer, error) {
+	if opts == nil {
+		opts = &recordinfer.Options{}
+	}
+	if opts.CSVDialect == nil {
+		br := bufio.NewReaderSize(r, sniffSampleSize)
+		sample, err := br.Peek(sniffSampleSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		r = br
+		if d := SniffDialect(string(sample)); !proto.Equal(d, &pb.CsvDialect{}) {
+			optsWithDialect := *opts
+			optsWithDialect.CSVDialect = d
+			opts = &optsWithDialect
+		}
+	}
+	reader := NewCSVReader(r, opts.CSVDialect)
+	reader.ReuseRecord = true
+
+	b := recordinfer.NewRecordBasedInferrer(opts)
+	if opts.CSVDialect.GetNoHeader() {
+		// Rows are added after the synthesized header below.
+		row, err := reader.Read()
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var header []string
+		for i := range row {
+			header = append(header, fmt.Sprintf("column_%d", i+1))
+		}
+		if err := b.AddRow(header); err != nil {
+			return nil, err
+		}
+		if err := b.AddRow(row); err != nil {
+			return nil, err
+		}
+	}
+	for !b.Done() {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := b.AddRow(row); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
 }
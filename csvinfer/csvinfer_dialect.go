@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvinfer
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+// sniffSampleSize is the number of bytes at the start of an input used to detect its
+// dialect.
+const sniffSampleSize = 64 * 1024
+
+// maxSniffRows is the maximum number of rows of the sample used to detect the header row.
+const maxSniffRows = 100
+
+var (
+	candidateDelimiters = []rune{',', '\t', ';', '|'}
+	candidateComments   = []rune{'#'}
+)
+
+// SniffDialect guesses the syntax of a CSV file from a sample of its first lines. The
+// sample may end with a partial line, which is ignored.
+//
+// The delimiter is the candidate that splits the most rows into the same number of fields,
+// the comment character is detected from a leading comment banner, and the first row is
+// assumed to be a header unless its values look like the values in the rows that follow.
+func SniffDialect(sample string) *pb.CsvDialect {
+	if i := strings.LastIndexByte(sample, '\n'); i != -1 && i != len(sample)-1 {
+		sample = sample[:i+1]
+	}
+	d := &pb.CsvDialect{}
+	for _, c := range candidateComments {
+		if strings.HasPrefix(strings.TrimLeft(sample, "\r\n"), string(c)) {
+			d.Comment = string(c)
+		}
+	}
+
+	bestConsistency, bestFields := 0.0, 0
+	var bestRows [][]string
+	for _, delim := range candidateDelimiters {
+		trial := &pb.CsvDialect{Delimiter: string(delim), Comment: d.Comment}
+		rows, err := readSample(sample, trial)
+		if err != nil {
+			trial.LazyQuotes = true
+			if rows, err = readSample(sample, trial); err != nil {
+				continue
+			}
+		}
+		fields, consistency := modalFieldCount(rows)
+		if fields < 2 {
+			continue
+		}
+		if consistency > bestConsistency || (consistency == bestConsistency && fields > bestFields) {
+			bestConsistency, bestFields, bestRows = consistency, fields, rows
+			d.Delimiter, d.LazyQuotes = trial.Delimiter, trial.LazyQuotes
+		}
+	}
+	if d.Delimiter == "," {
+		d.Delimiter = ""
+	}
+	d.NoHeader = !looksLikeHeader(bestRows)
+	return d
+}
+
+// NewCSVReader returns a csv.Reader configured to read files in the given dialect. A nil
+// dialect reads files using the csv.Reader defaults.
+func NewCSVReader(r io.Reader, d *pb.CsvDialect) *csv.Reader {
+	reader := csv.NewReader(r)
+	if delim, _ := utf8.DecodeRuneInString(d.GetDelimiter()); delim != utf8.RuneError {
+		reader.Comma = delim
+	}
+	if comment, _ := utf8.DecodeRuneInString(d.GetComment()); comment != utf8.RuneError {
+		reader.Comment = comment
+	}
+	reader.LazyQuotes = d.GetLazyQuotes()
+	return reader
+}
+
+func readSample(sample string, d *pb.CsvDialect) ([][]string, error) {
+	reader := NewCSVReader(strings.NewReader(sample), d)
+	reader.FieldsPerRecord = -1
+	var rows [][]string
+	for len(rows) < maxSniffRows {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// modalFieldCount returns the most common number of fields in the rows and the share of
+// rows with that number of fields.
+func modalFieldCount(rows [][]string) (int, float64) {
+	counts := make(map[int]int)
+	for _, row := range rows {
+		counts[len(row)]++
+	}
+	mode := 0
+	for fields, count := range counts {
+		if count > counts[mode] || (count == counts[mode] && fields > mode) {
+			mode = fields
+		}
+	}
+	if len(rows) == 0 {
+		return 0, 0
+	}
+	return mode, float64(counts[mode]) / float64(len(rows))
+}
+
+// looksLikeHeader reports whether the first row is a header. Each column votes based on
+// whether its first value differs from the rest of its values in type or length, similar to
+// Python's csv.Sniffer.has_header. Ties are resolved in favor of a header.
+func looksLikeHeader(rows [][]string) bool {
+	if len(rows) < 2 {
+		return true
+	}
+	header, data := rows[0], rows[1:]
+	votes := 0
+	for col, name := range header {
+		allNumbers, sameLength := true, true
+		length := -1
+		nonEmpty := 0
+		for _, row := range data {
+			if col >= len(row) || row[col] == "" {
+				continue
+			}
+			nonEmpty++
+			if !isNumber(row[col]) {
+				allNumbers = false
+			}
+			if length == -1 {
+				length = len(row[col])
+			} else if len(row[col]) != length {
+				sameLength = false
+			}
+		}
+		switch {
+		case nonEmpty == 0:
+		case allNumbers:
+			if isNumber(name) {
+				votes--
+			} else {
+				votes++
+			}
+		case sameLength:
+			if len(name) == length {
+				votes--
+			} else {
+				votes++
+			}
+		}
+	}
+	return votes >= 0
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvinfer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/xtoproto/recordinfer"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+func TestSniffDialect(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		sample string
+		want   *pb.CsvDialect
+	}{
+		{
+			"comma",
+			"name,age\nbob,4\nalice,32\n",
+			&pb.CsvDialect{},
+		},
+		{
+			"tab",
+			"name\tcity\tage\nbob\tParis, France\t4\nalice\tRome, Italy\t32\n",
+			&pb.CsvDialect{Delimiter: "\t"},
+		},
+		{
+			"semicolon with decimal commas",
+			"name;price\nbread;2,50\nmilk;1,05\n",
+			&pb.CsvDialect{Delimiter: ";"},
+		},
+		{
+			"pipe with partial last line",
+			"a|b|c\n1|2|3\n4|5|6\n7|8",
+			&pb.CsvDialect{Delimiter: "|"},
+		},
+		{
+			"comment banner",
+			"# exported 2020-01-01\n# by system x\nname,age\nbob,4\n",
+			&pb.CsvDialect{Comment: "#"},
+		},
+		{
+			"headerless",
+			"bob,4\nalice,32\nchristopher,7\n",
+			&pb.CsvDialect{NoHeader: true},
+		},
+		{
+			"lazy quotes",
+			"name,height\nbob,5'11\"\nalice,5'4\"\n",
+			&pb.CsvDialect{LazyQuotes: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := SniffDialect(tc.sample)
+			if diff := cmp.Diff(tc.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("SniffDialect(%q) unexpected diff (-want, +got):\n%s", tc.sample, diff)
+			}
+		})
+	}
+}
+
+func TestInferProtoDialect(t *testing.T) {
+	ip, err := InferProtoFromReader(strings.NewReader("# banner\nbob;4\nalice;32\nchristopher;7\n"), &recordinfer.Options{MessageName: "Row"})
+	if err != nil {
+		t.Fatalf("InferProtoFromReader() error: %v", err)
+	}
+	m := ip.Mapping()
+	if diff := cmp.Diff(&pb.CsvDialect{Delimiter: ";", Comment: "#", NoHeader: true}, m.GetCsvDialect(), protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected csv_dialect (-want, +got):\n%s", diff)
+	}
+	type column struct{ Name, Type string }
+	var got []column
+	for _, c2f := range m.GetColumnToFieldMappings() {
+		got = append(got, column{c2f.GetColName(), c2f.GetProtoType()})
+	}
+	want := []column{{"column_1", "string"}, {"column_2", "int64"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected columns (-want, +got):\n%s", diff)
+	}
+}
@@ -15,11 +15,19 @@
 package csvinfer
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/xtoproto/recordinfer"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/testing/protocmp"
 
 	pb "github.com/google/xtoproto/proto/recordtoproto"
@@ -177,3 +185,102 @@ func TestInferProto(t *testing.T) {
 		}
 	}
 }
+
+func TestInferProtoFromReader(t *testing.T) {
+	var lines []string
+	lines = append(lines, "id,status,score")
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, fmt.Sprintf("%d,%s,%d.5", i, []string{"open", "closed", "NA"}[i%3], i%7))
+	}
+	largeCSV := strings.Join(lines, "\n") + "\n"
+
+	for _, tc := range []struct {
+		name    string
+		csvText string
+		opts    *recordinfer.Options
+		want    []string
+	}{
+		{
+			"all rows",
+			largeCSV,
+			&recordinfer.Options{MessageName: "Row"},
+			[]string{"int64", "string", "float"},
+		},
+		{
+			"stops reading after MaxRows",
+			"a,b\n1,2\n3,4\n\"unterminated,5\n",
+			&recordinfer.Options{MessageName: "Row", MaxRows: 2},
+			[]string{"int64", "int64"},
+		},
+		{
+			"sample",
+			largeCSV,
+			&recordinfer.Options{MessageName: "Row", SampleSize: 100, SampleSeed: 42},
+			[]string{"int64", "string", "float"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ip, err := InferProtoFromReader(strings.NewReader(tc.csvText), tc.opts)
+			if err != nil {
+				t.Fatalf("InferProtoFromReader() error: %v", err)
+			}
+			var got []string
+			for _, c2f := range ip.Mapping().GetColumnToFieldMappings() {
+				got = append(got, c2f.GetProtoType())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected proto types (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestInferProtoFromReaderMatchesInMemoryInference checks that streaming inference returns
+// the mappings in testdata/inmemory, which were produced by the implementation of InferProto
+// that held all records in memory.
+func TestInferProtoFromReaderMatchesInMemoryInference(t *testing.T) {
+	csvFiles, err := filepath.Glob(filepath.Join("testdata", "inmemory", "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(csvFiles) == 0 {
+		t.Fatal("no test cases found in testdata/inmemory")
+	}
+	for _, csvFile := range csvFiles {
+		csvText, err := ioutil.ReadFile(csvFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mappingText, err := ioutil.ReadFile(strings.TrimSuffix(csvFile, ".csv") + ".textproto")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &pb.RecordProtoMapping{}
+		if err := prototext.Unmarshal(mappingText, want); err != nil {
+			t.Fatalf("error parsing mapping of %s: %v", csvFile, err)
+		}
+		for _, tc := range []struct {
+			name string
+			r    io.Reader
+			opts *recordinfer.Options
+		}{
+			{"reader", bytes.NewReader(csvText), &recordinfer.Options{}},
+			{"one byte reader", iotest.OneByteReader(bytes.NewReader(csvText)), &recordinfer.Options{}},
+			// A sample larger than the input contains every row.
+			{"sample", bytes.NewReader(csvText), &recordinfer.Options{SampleSize: 100000}},
+		} {
+			t.Run(fmt.Sprintf("%s/%s", filepath.Base(csvFile), tc.name), func(t *testing.T) {
+				tc.opts.MessageName = "Row"
+				tc.opts.PackageName = "rows"
+				tc.opts.EnumOptions = recordinfer.DefaultEnumOptions
+				got, err := InferProtoFromReader(tc.r, tc.opts)
+				if err != nil {
+					t.Fatalf("InferProtoFromReader() error: %v", err)
+				}
+				if diff := cmp.Diff(want, got.Mapping(), protocmp.Transform()); diff != "" {
+					t.Errorf("InferProtoFromReader() differs from in-memory inference (-want, +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
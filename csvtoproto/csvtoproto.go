@@ -22,13 +22,46 @@ import (
 
 	"github.com/golang/glog"
 	wordwrap "github.com/mitchellh/go-wordwrap"
+	"github.com/stoewer/go-strcase"
 
 	pb "github.com/google/xtoproto/proto/recordtoproto"
 )
 
+// GeneratedCodeMarker is the first line of the generated .proto and .go files. It follows
+// the Go convention for marking generated files.
+const GeneratedCodeMarker = "// Code generated by xtoproto. DO NOT EDIT."
+
+// legacyGeneratedCodeMarker is the first line of files generated by older versions of
+// xtoproto.
+const legacyGeneratedCodeMarker = "// This file was generated using xtoproto."
+
+// HasGeneratedCodeMarker reports whether a .proto or .go file was generated by xtoproto,
+// so it may be overwritten when regenerating it. As in the Go convention, the marker must
+// be a line of its own before the first line that is not blank or a // comment. Markers
+// of other generators are not accepted.
+func HasGeneratedCodeMarker(contents []byte) bool {
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == GeneratedCodeMarker || line == legacyGeneratedCodeMarker:
+			return true
+		case strings.TrimSpace(line) != "" && !strings.HasPrefix(line, "//"):
+			return false
+		}
+	}
+	return false
+}
+
 // GenerateCode returns a .proto file based on the RecordProtoMapping.
 func GenerateCode(mapping *pb.RecordProtoMapping, genProto, genGo bool) (string, string, error) {
-	cg := &codeGenerator{mapping}
+	return GenerateCodeWithAdditionalMappings(mapping, nil, genProto, genGo)
+}
+
+// GenerateCodeWithAdditionalMappings is like GenerateCode, but the .proto file also defines
+// the messages and enums of additional mappings, such as the nested messages of a mapping
+// inferred from XML. The converter is generated for the first mapping only.
+func GenerateCodeWithAdditionalMappings(mapping *pb.RecordProtoMapping, additionalMappings []*pb.RecordProtoMapping, genProto, genGo bool) (string, string, error) {
+	cg := &codeGenerator{mapping, additionalMappings}
 	protoCode, goCode := "", ""
 	if genGo {
 		var err error
@@ -45,14 +78,40 @@ func GenerateCode(mapping *pb.RecordProtoMapping, genProto, genGo bool) (string,
 
 type codeGenerator struct {
 	mapping *pb.RecordProtoMapping
+	// additionalMappings are mappings of other messages defined in the .proto file.
+	additionalMappings []*pb.RecordProtoMapping
 }
 
 const fieldIndent = 2
 
 func (cg *codeGenerator) protoCode() string {
+	var imports []string
+	var definitions []string
+	for _, mapping := range append([]*pb.RecordProtoMapping{cg.mapping}, cg.additionalMappings...) {
+		g := &codeGenerator{mapping: mapping}
+		code, messageImports := g.messageCode()
+		definitions = append(definitions, g.enumsCode()+code)
+		imports = append(imports, messageImports...)
+	}
+
+	return fmt.Sprintf(`%s
+
+syntax = "proto3";
+
+package %s;
+
+%s
+
+%s`, GeneratedCodeMarker, cg.mapping.PackageName, importStatements(imports), strings.Join(definitions, "\n"))
+}
+
+// messageCode returns the .proto definition of the mapping's message and the imports it
+// needs.
+func (cg *codeGenerator) messageCode() (string, []string) {
 	var imports []string
 	fieldPrefix := strings.Repeat(" ", fieldIndent)
 	var fieldDefs []*pb.FieldDefinition
+	optionalFields := map[string]bool{}
 	for _, field := range cg.mapping.ColumnToFieldMappings {
 		if field.Ignored {
 			continue
@@ -69,25 +128,105 @@ func (cg *codeGenerator) protoCode() string {
 			ProtoTag:     field.ProtoTag,
 			ProtoType:    field.ProtoType,
 		})
+		if isOptionalScalar(field) {
+			optionalFields[field.ProtoName] = true
+		}
 	}
 	fieldDefs = append(fieldDefs, cg.mapping.ExtraFieldDefinitions...)
 	var fieldCodeSections []string
 	for _, field := range fieldDefs {
-		section := fmt.Sprintf("%s%s%s %s = %d;", formatProtoComment(field.Comment, fieldIndent), fieldPrefix, field.ProtoType, field.ProtoName, field.ProtoTag)
+		label := ""
+		if field.Repeated {
+			label = "repeated "
+		} else if optionalFields[field.ProtoName] {
+			label = "optional "
+		}
+		section := fmt.Sprintf("%s%s%s%s %s = %d;", formatProtoComment(field.Comment, fieldIndent), fieldPrefix, label, field.ProtoType, field.ProtoName, field.ProtoTag)
 		imports = append(imports, field.ProtoImports...)
+		if imp, ok := wellKnownTypeImports[field.ProtoType]; ok {
+			imports = append(imports, imp)
+		}
 		fieldCodeSections = append(fieldCodeSections, section)
 	}
 
-	return fmt.Sprintf(`syntax = "proto3";
+	return fmt.Sprintf(`message %s {
+%s%s
+}
+`, cg.mapping.MessageName, cg.reservedCode(), strings.Join(fieldCodeSections, "\n\n")), imports
+}
 
-package %s;
+// isOptionalScalar reports whether the field of a column is declared optional, which is
+// the case for scalar fields of columns with null values so that a null cell can be told
+// apart from a zero value. Message fields already have presence, and enum fields leave
+// the zero value of the enum for null cells.
+func isOptionalScalar(c2f *pb.ColumnToFieldMapping) bool {
+	if len(c2f.GetNullValues()) == 0 {
+		return false
+	}
+	switch c2f.GetProtoType() {
+	case "int32", "int64", "uint32", "uint64", "float", "double", "bool", "string":
+		return true
+	}
+	return false
+}
 
-%s
+// reservedCode returns the reserved statements for the removed fields of the message,
+// followed by a blank line, or the empty string if no fields were removed.
+func (cg *codeGenerator) reservedCode() string {
+	fieldPrefix := strings.Repeat(" ", fieldIndent)
+	out := ""
+	if tags := cg.mapping.GetReservedTags(); len(tags) != 0 {
+		var strs []string
+		for _, tag := range tags {
+			strs = append(strs, fmt.Sprintf("%d", tag))
+		}
+		out += fmt.Sprintf("%sreserved %s;\n", fieldPrefix, strings.Join(strs, ", "))
+	}
+	if names := cg.mapping.GetReservedNames(); len(names) != 0 {
+		var quoted []string
+		for _, name := range names {
+			quoted = append(quoted, fmt.Sprintf("%q", name))
+		}
+		out += fmt.Sprintf("%sreserved %s;\n", fieldPrefix, strings.Join(quoted, ", "))
+	}
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
 
-message %s {
-%s
+// enumsCode returns the .proto definitions of the mapping's enums, each followed by a blank
+// line.
+func (cg *codeGenerator) enumsCode() string {
+	fieldPrefix := strings.Repeat(" ", fieldIndent)
+	out := ""
+	for _, enum := range cg.mapping.GetEnumDefinitions() {
+		valueSections := []string{fmt.Sprintf("%s%s = 0;", fieldPrefix, enumZeroValueName(enum))}
+		for _, v := range enum.GetValues() {
+			var quoted []string
+			for _, raw := range v.GetRawValues() {
+				quoted = append(quoted, fmt.Sprintf("%q", raw))
+			}
+			comment := fmt.Sprintf("csv values: %s", strings.Join(quoted, ", "))
+			valueSections = append(valueSections, fmt.Sprintf("%s%s%s = %d;", formatProtoComment(comment, fieldIndent), fieldPrefix, v.GetProtoName(), v.GetNumber()))
+		}
+		out += fmt.Sprintf("%senum %s {\n%s\n}\n\n", formatProtoComment(enum.GetComment(), 0), enum.GetEnumName(), strings.Join(valueSections, "\n\n"))
+	}
+	return out
+}
+
+// enumDefinition returns the enum definition with the given name or nil.
+func (cg *codeGenerator) enumDefinition(name string) *pb.EnumDefinition {
+	for _, enum := range cg.mapping.GetEnumDefinitions() {
+		if enum.GetEnumName() == name {
+			return enum
+		}
+	}
+	return nil
 }
-`, cg.mapping.PackageName, importStatements(imports), cg.mapping.MessageName, strings.Join(fieldCodeSections, "\n\n"))
+
+func enumZeroValueName(enum *pb.EnumDefinition) string {
+	return strcase.UpperSnakeCase(enum.GetEnumName()) + "_UNSPECIFIED"
 }
 
 const protoWrapColumn = 80
@@ -117,6 +256,13 @@ func formatProtoComment(comment string, indent int) string {
 	return out
 }
 
+// wellKnownTypeImports are the imports of the well-known types supported by the code
+// generator. They are imported even if a mapping omits them from proto_imports.
+var wellKnownTypeImports = map[string]string{
+	"google.protobuf.Timestamp": "google/protobuf/timestamp.proto",
+	"google.protobuf.Duration":  "google/protobuf/duration.proto",
+}
+
 func importStatements(paths []string) string {
 	paths = sortImports(paths)
 
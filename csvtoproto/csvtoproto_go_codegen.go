@@ -17,8 +17,11 @@ package csvtoproto
 import (
 	"fmt"
 	"go/format"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+	"unicode/utf8"
 
 	pb "github.com/google/xtoproto/proto/recordtoproto"
 
@@ -26,7 +29,9 @@ import (
 )
 
 var goFileTemplate = template.Must(template.New("classdef").Parse(
-	`package {{.package}}
+	`{{.generated_code_marker}}
+
+package {{.package}}
 
 import (
 	"encoding/csv"
@@ -78,10 +83,18 @@ type Reader struct {
 }
 
 // NewReader returns a {{.message_type}} reader based on the given generic CSV reader.
+// Options of type csvcoder.FileParserOption, such as csvcoder.SkipInvalidRows(), are
+// applied to the underlying csvcoder.FileParser.
 func NewReader(r io.Reader, options... csvtoprotoparse.ReaderOption) (*Reader, error) {
 	reader := csv.NewReader(r)
 
-	fileParser, err := csvcoder.NewFileParser(reader, "input.csv", newRecord())
+	parserOptions := []csvcoder.FileParserOption{ {{- .file_parser_options -}} }
+	for _, opt := range options {
+		if o, ok := opt.(csvcoder.FileParserOption); ok {
+			parserOptions = append(parserOptions, o)
+		}
+	}
+	fileParser, err := csvcoder.NewFileParser(reader, "input.csv", newRecord(), parserOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -109,10 +122,20 @@ func (r *Reader) Read() (*{{.message_type}}, error) {
 		}
 	}
 
-	if len(errs) != 0 {
+	switch len(errs) {
+	case 0:
+		return msg, nil
+	case 1:
 		return msg, errs[0]
+	default:
+		return msg, csvtoprotoparse.Errors(errs)
 	}
-	return msg, nil
+}
+
+// ErrorSummary returns a report of the rows skipped because they failed to parse, or nil
+// unless csvcoder.SkipInvalidRows() was passed to NewReader.
+func (r *Reader) ErrorSummary() *csvcoder.ErrorSummary {
+	return r.fileParser.ErrorSummary()
 }
 
 
@@ -139,6 +162,50 @@ func (r *Reader) ReadMessage() (proto.Message, error) {
 func NewMessageReader(r io.Reader, options... csvtoprotoparse.ReaderOption) (protocp.MessageReader, error) {
   return NewReader(r, options...)
 }
+
+// Writer is a layer on top of csv.Writer for {{.message_type}} messages. It writes CSV
+// files that Reader parses back into the same messages.
+type Writer struct {
+	fileWriter *csvcoder.FileWriter
+}
+
+// NewWriter returns a {{.message_type}} writer that writes CSV to w. The header row, if
+// any, is written immediately.
+func NewWriter(w io.Writer) (*Writer, error) {
+	writer := csv.NewWriter(w){{.csv_writer_setup}}
+
+	fileWriter, err := csvcoder.NewFileWriter(writer, newRecord(){{.file_writer_options}})
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{fileWriter}, nil
+}
+
+// Write writes a {{.message_type}} as a CSV record. Records are buffered; call Flush to
+// ensure they are written to the underlying io.Writer.
+func (w *Writer) Write(msg *{{.message_type}}) error {
+	rec, err := newRecordFromProto(msg)
+	if err != nil {
+		return err
+	}
+	return w.fileWriter.Write(rec)
+}
+
+// WriteAll writes each of the {{.message_type}} values as CSV records and flushes the
+// writer.
+func (w *Writer) WriteAll(msgs []*{{.message_type}}) error {
+	for _, msg := range msgs {
+		if err := w.Write(msg); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// Flush writes any buffered records to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.fileWriter.Flush()
+}
 `))
 
 func (cg *codeGenerator) recordStructTypeName() string {
@@ -160,6 +227,12 @@ func (cg *codeGenerator) goCode() (string, error) {
 	params["record_struct_definition"] = structCode.structDef
 	params["to_proto_impl"] = "return nil, fmt.Errorf(`problem`)"
 	params["struct_name"] = cg.recordStructTypeName()
+	fileParserOptions, err := cg.fileParserOptionsCode()
+	if err != nil {
+		return "", err
+	}
+	params["file_parser_options"] = fileParserOptions
+	params["csv_writer_setup"], params["file_writer_options"] = cg.fileWriterOptionsCode()
 	if err := goFileTemplate.Execute(strBuilder, params); err != nil {
 		return "", err
 	}
@@ -174,6 +247,76 @@ func (cg *codeGenerator) goCode() (string, error) {
 	return string(formatted), nil
 }
 
+// fileParserOptionsCode returns a comma-separated list of the csvcoder.FileParserOption
+// values needed to parse files in the mapping's CSV dialect.
+func (cg *codeGenerator) fileParserOptionsCode() (string, error) {
+	d := cg.mapping.GetCsvDialect()
+	var opts []string
+	var dialectFields []string
+	for _, f := range []struct{ name, value string }{
+		{"Comma", d.GetDelimiter()},
+		{"Comment", d.GetComment()},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if utf8.RuneCountInString(f.value) != 1 {
+			return "", fmt.Errorf("csv_dialect field for %s must be a single character, got %q", f.name, f.value)
+		}
+		r, _ := utf8.DecodeRuneInString(f.value)
+		dialectFields = append(dialectFields, fmt.Sprintf("%s: %s", f.name, strconv.QuoteRune(r)))
+	}
+	if d.GetLazyQuotes() {
+		dialectFields = append(dialectFields, "LazyQuotes: true")
+	}
+	if len(dialectFields) != 0 {
+		opts = append(opts, fmt.Sprintf("csvcoder.WithDialect(csvcoder.Dialect{%s})", strings.Join(dialectFields, ", ")))
+	}
+	if d.GetNoHeader() {
+		opts = append(opts, fmt.Sprintf("csvcoder.WithPredeterminedHeader(%s)", goStringSliceLiteral(cg.columnNamesByIndex())))
+	}
+	return strings.Join(opts, ", "), nil
+}
+
+// fileWriterOptionsCode returns statements that configure the csv.Writer named writer
+// and the csvcoder.FileWriterOption arguments, each preceded by a comma, needed to write
+// files in the mapping's CSV dialect. Columns are written in the order of their
+// column_index.
+func (cg *codeGenerator) fileWriterOptionsCode() (string, string) {
+	d := cg.mapping.GetCsvDialect()
+	setup := ""
+	if r, _ := utf8.DecodeRuneInString(d.GetDelimiter()); r != utf8.RuneError {
+		setup = fmt.Sprintf("\nwriter.Comma = %s", strconv.QuoteRune(r))
+	}
+	opts := []string{fmt.Sprintf("csvcoder.WithColumns(%s)", goStringSliceLiteral(cg.columnNamesByIndex()))}
+	if d.GetNoHeader() {
+		opts = append(opts, "csvcoder.WithoutHeaderRow()")
+	}
+	return setup, optionArgsCode(opts)
+}
+
+// columnNamesByIndex returns the names of the mapping's columns, including ignored
+// columns, ordered by column_index. Indexes without a column have an empty name.
+func (cg *codeGenerator) columnNamesByIndex() []string {
+	var names []string
+	for _, c2f := range cg.mapping.GetColumnToFieldMappings() {
+		for int(c2f.GetColumnIndex()) >= len(names) {
+			names = append(names, "")
+		}
+		names[c2f.GetColumnIndex()] = c2f.GetColName()
+	}
+	return names
+}
+
+func optionArgsCode(opts []string) string {
+	var out strings.Builder
+	for _, opt := range opts {
+		out.WriteString(", ")
+		out.WriteString(opt)
+	}
+	return out.String()
+}
+
 func (cg *codeGenerator) sharedTemplateParams() (map[string]string, error) {
 	if cg.mapping.GetGoOptions() == nil {
 		return nil, fmt.Errorf("must specify go_options field in CSVProtoMapping")
@@ -182,10 +325,11 @@ func (cg *codeGenerator) sharedTemplateParams() (map[string]string, error) {
 		return nil, fmt.Errorf("must specify non-empty package in go_options field of CSVProtoMapping")
 	}
 	return map[string]string{
-		"package":      cg.mapping.GoOptions.GoPackageName,
-		"proto_import": cg.mapping.GoOptions.ProtoImport,
-		"message_type": fmt.Sprintf("pb.%s", cg.mapping.MessageName),
-		"struct_name":  cg.recordStructTypeName(),
+		"package":               cg.mapping.GoOptions.GoPackageName,
+		"generated_code_marker": GeneratedCodeMarker,
+		"proto_import":          cg.mapping.GoOptions.ProtoImport,
+		"message_type":          fmt.Sprintf("pb.%s", cg.mapping.MessageName),
+		"struct_name":           cg.recordStructTypeName(),
 	}, nil
 }
 
@@ -202,7 +346,7 @@ func (cg *codeGenerator) makeStructCode() (*structCode, error) {
 
 	topLevelLines := []string{}
 	fieldLines := []string{""}
-	var toProtoInitStatements, protoFieldLiterals []string
+	var toProtoInitStatements, protoFieldLiterals, fromProtoStatements []string
 
 	for i, c2f := range cg.mapping.ColumnToFieldMappings {
 		if c2f.Ignored {
@@ -210,27 +354,57 @@ func (cg *codeGenerator) makeStructCode() (*structCode, error) {
 		}
 
 		fieldName := strcase.UpperCamelCase(c2f.ProtoName)
-		fieldType, err := getFieldTypeCode(c2f)
+		fieldType, err := cg.fieldTypeCode(c2f)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate code for mapping[%d] = %v: %w", i, c2f, err)
 		}
 		if fieldType.topLevelCode != "" {
 			topLevelLines = append(topLevelLines, fieldType.topLevelCode)
 		}
+		inExpr := fmt.Sprintf("r.%s", fieldName)
+		valueTypeName := fieldType.typeName
+		if len(c2f.GetNullValues()) != 0 {
+			fieldType, err = nullableFieldTypeCode(c2f, fieldType)
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate code for mapping[%d] = %v: %w", i, c2f, err)
+			}
+			topLevelLines = append(topLevelLines, fieldType.topLevelCode)
+			inExpr += ".value"
+		}
 		fieldLines = append(fieldLines, fmt.Sprintf("%s %s `csv:%q`", fieldName, fieldType.typeName, c2f.GetColName()))
 
-		expr, err := getGoToProtoFieldExpression(
-			fmt.Sprintf("r.%s", fieldName),
-			strcase.LowerCamelCase("parsed_"+c2f.GetProtoName()),
-			c2f.GetProtoType())
+		outVar := strcase.LowerCamelCase("parsed_" + c2f.GetProtoName())
+		expr, err := cg.goToProtoFieldExpression(inExpr, outVar, c2f.GetProtoType())
 		if err != nil {
 			return nil, fmt.Errorf("failed to handle proto field %q", c2f.GetProtoName())
 		}
+		if isOptionalScalar(c2f) {
+			// Optional scalar fields are left unset when the cell is null.
+			expr = &transformExpr{
+				fmt.Sprintf("var %s *%s\nif r.%s.valid {\nv := %s\n%s = &v\n}\n", outVar, scalarGoType(c2f.GetProtoType()), fieldName, expr.valueExpr, outVar),
+				outVar,
+				"",
+			}
+		} else if len(c2f.GetNullValues()) != 0 && expr.parseStatements != "" {
+			// Message-typed fields are left nil when the cell is null. Enum fields are
+			// left at their zero value, which the value field of the wrapper already holds.
+			expr.parseStatements += fmt.Sprintf("if !r.%s.valid {\n%s = nil\n}\n", fieldName, outVar)
+		}
 		if expr.parseStatements != "" {
 			toProtoInitStatements = append(toProtoInitStatements, expr.parseStatements)
 		}
 
 		protoFieldLiterals = append(protoFieldLiterals, fmt.Sprintf("%s: %s,", strcase.UpperCamelCase(c2f.ProtoName), expr.valueExpr))
+
+		getter := fmt.Sprintf("msg.Get%s()", strcase.UpperCamelCase(c2f.GetProtoName()))
+		reverse, err := cg.protoToGoFieldExpression(getter, valueTypeName, c2f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to handle proto field %q: %w", c2f.GetProtoName(), err)
+		}
+		if isOptionalScalar(c2f) {
+			reverse.presentCond = fmt.Sprintf("msg.%s != nil", fieldName)
+		}
+		fromProtoStatements = append(fromProtoStatements, reverse.assignmentCode(fieldName, fieldType.typeName, c2f))
 	}
 
 	structDef := fmt.Sprintf("type %s struct{%s\n}", structName, strings.Join(fieldLines, "\n  "))
@@ -238,6 +412,7 @@ func (cg *codeGenerator) makeStructCode() (*structCode, error) {
 	params["parse_section"] = strings.Join(toProtoInitStatements, "\n")
 	params["field_type_declarations"] = strings.Join(topLevelLines, "\n")
 	params["field_literals_section"] = strings.Join(protoFieldLiterals, "\n")
+	params["from_proto_section"] = strings.Join(fromProtoStatements, "\n")
 
 	b := &strings.Builder{}
 	if err := toProtoTemplate.Execute(b, params); err != nil {
@@ -257,6 +432,14 @@ func (r *{{.struct_name}}) Proto() (*{{.message_type}}, error) {
 	}, err
 }
 
+// newRecordFromProto returns the record for a {{.message_type}}. It is the inverse of
+// Proto.
+func newRecordFromProto(msg *{{.message_type}}) (*{{.struct_name}}, error) {
+	r := newRecord()
+	{{.from_proto_section}}
+	return r, nil
+}
+
 {{.field_type_declarations}}
 
 func init() {
@@ -270,18 +453,117 @@ type fieldTypeCode struct {
 	topLevelCode, typeName string
 }
 
+// fieldTypeCode returns the Go type of the record struct field for a column,
+// including enums defined in the mapping.
+func (cg *codeGenerator) fieldTypeCode(c2f *pb.ColumnToFieldMapping) (*fieldTypeCode, error) {
+	enum := cg.enumDefinition(c2f.GetProtoType())
+	if enum == nil {
+		return getFieldTypeCode(c2f)
+	}
+	typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Enum")
+	enumType := fmt.Sprintf("pb.%s", enum.GetEnumName())
+	var valueLiterals, nameLiterals []string
+	for _, v := range enum.GetValues() {
+		if len(v.GetRawValues()) == 0 {
+			return nil, fmt.Errorf("enum value %s has no raw_values", v.GetProtoName())
+		}
+		goValue := fmt.Sprintf("pb.%s_%s", enum.GetEnumName(), v.GetProtoName())
+		for _, raw := range v.GetRawValues() {
+			valueLiterals = append(valueLiterals, fmt.Sprintf("%q: %s,", raw, goValue))
+		}
+		nameLiterals = append(nameLiterals, fmt.Sprintf("%s: %q,", goValue, v.GetRawValues()[0]))
+	}
+	code, err := templateExecString(enumTypeTemplate, map[string]string{
+		"T":         typeName,
+		"enum_type": enumType,
+		"values":    strings.Join(valueLiterals, "\n"),
+		"names":     strings.Join(nameLiterals, "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fieldTypeCode{code, typeName}, nil
+}
+
+// goToProtoFieldExpression is like getGoToProtoFieldExpression but also
+// handles enums defined in the mapping.
+func (cg *codeGenerator) goToProtoFieldExpression(inExpr, outVar, protoType string) (*transformExpr, error) {
+	if enum := cg.enumDefinition(protoType); enum != nil {
+		return &transformExpr{"", fmt.Sprintf("pb.%s(%s)", enum.GetEnumName(), inExpr), ""}, nil
+	}
+	return getGoToProtoFieldExpression(inExpr, outVar, protoType)
+}
+
+var enumTypeTemplate = template.Must(template.New("enumType").Parse(`
+type {{.T}} {{.enum_type}}
+
+func init() {
+	values := map[string]{{.enum_type}}{
+		{{.values}}
+	}
+	names := map[{{.enum_type}}]string{
+		{{.names}}
+	}
+	textcoder.Register(
+		reflect.TypeOf({{.T}}(0)),
+		func(v {{.T}}) (string, error) {
+			s, ok := names[{{.enum_type}}(v)]
+			if !ok {
+				return "", fmt.Errorf("no CSV value for {{.enum_type}} %v", {{.enum_type}}(v))
+			}
+			return s, nil
+		},
+		func(s string, dst *{{.T}}) error {
+			v, ok := values[s]
+			if !ok {
+				return fmt.Errorf("unknown {{.enum_type}} value %q", s)
+			}
+			*dst = {{.T}}(v)
+			return nil
+		},
+	)
+}
+`))
+
 func getFieldTypeCode(c2f *pb.ColumnToFieldMapping) (*fieldTypeCode, error) {
 	switch protoType := c2f.GetProtoType(); protoType {
-	case "int32":
-		return &fieldTypeCode{"", "int32"}, nil
-	case "int64":
-		return &fieldTypeCode{"", "int64"}, nil
-	case "float":
-		return &fieldTypeCode{"", "float32"}, nil
-	case "double":
-		return &fieldTypeCode{"", "float64"}, nil
+	case "int32", "int64", "uint32", "uint64", "float", "double":
+		nt := numberTypes[protoType]
+		if c2f.GetNumberFormat() == nil {
+			return &fieldTypeCode{"", nt.goType}, nil
+		}
+		typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Number")
+		code, err := templateExecString(numberTypeTemplate, map[string]string{
+			"T":           typeName,
+			"go_type":     nt.goType,
+			"format":      numberFormatLiteral(c2f.GetNumberFormat()),
+			"parse_func":  nt.parseFunc,
+			"format_expr": nt.formatExpr,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &fieldTypeCode{code, typeName}, nil
 	case "string":
 		return &fieldTypeCode{"", "string"}, nil
+	case "bool":
+		if c2f.GetBoolFormat() == nil {
+			return &fieldTypeCode{"", "bool"}, nil
+		}
+		trueValues, falseValues := c2f.GetBoolFormat().GetTrueValues(), c2f.GetBoolFormat().GetFalseValues()
+		if len(trueValues) == 0 || len(falseValues) == 0 {
+			return nil, fmt.Errorf("bool_format must specify at least one true value and one false value")
+		}
+		typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Bool")
+		code, err := templateExecString(boolTypeTemplate, map[string]string{
+			"T":            typeName,
+			"true_values":  goStringSliceLiteral(trueValues),
+			"false_values": goStringSliceLiteral(falseValues),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &fieldTypeCode{code, typeName}, nil
 	case "google.protobuf.Timestamp":
 		typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Time")
 		tz := c2f.GetTimeFormat().GetTimeZoneName()
@@ -299,9 +581,13 @@ func getFieldTypeCode(c2f *pb.ColumnToFieldMapping) (*fieldTypeCode, error) {
 		return &fieldTypeCode{code, typeName}, nil
 	case "google.protobuf.Duration":
 		typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Duration")
+		format, err := durationFormatLiteral(c2f.GetDurationFormat())
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %w", c2f.GetColName(), err)
+		}
 		code, err := templateExecString(durationTypeTemplate, map[string]string{
-			"T":    typeName,
-			"unit": c2f.GetTimeFormat().GetGoLayout(),
+			"T":      typeName,
+			"format": format,
 		})
 		if err != nil {
 			return nil, err
@@ -341,6 +627,89 @@ func init() {
 }
 `))
 
+var boolTypeTemplate = template.Must(template.New("boolType").Parse(`
+type {{.T}} bool
+
+func init() {
+	trueValues := {{.true_values}}
+	falseValues := {{.false_values}}
+	textcoder.Register(
+		reflect.TypeOf({{.T}}(false)),
+		func(b {{.T}}) (string, error) {
+			if b {
+				return trueValues[0], nil
+			}
+			return falseValues[0], nil
+		},
+		func(s string, dst *{{.T}}) error {
+			b, err := csvtoprotoparse.ParseBool(s, trueValues, falseValues)
+			if err != nil {
+				return fmt.Errorf("error parsing {{.T}}: %w", err)
+			}
+			*dst = {{.T}}(b)
+			return nil
+		},
+	)
+}
+`))
+
+// numberType describes the Go representation of a numeric proto type.
+type numberType struct {
+	// goType is the Go type of the proto field.
+	goType string
+	// parseFunc is the csvtoprotoparse.NumberFormat method that parses the type.
+	parseFunc string
+	// formatExpr formats v, a value of the type, using format, a
+	// *csvtoprotoparse.NumberFormat.
+	formatExpr string
+}
+
+var numberTypes = map[string]*numberType{
+	"int32":  {"int32", "ParseInt32", "format.FormatInt(int64(v))"},
+	"int64":  {"int64", "ParseInt64", "format.FormatInt(int64(v))"},
+	"uint32": {"uint32", "ParseUint32", "format.FormatUint(uint64(v))"},
+	"uint64": {"uint64", "ParseUint64", "format.FormatUint(uint64(v))"},
+	"float":  {"float32", "ParseFloat", "format.FormatFloat(float64(v), 32)"},
+	"double": {"float64", "ParseDouble", "format.FormatFloat(float64(v), 64)"},
+}
+
+// scalarGoType returns the Go type of the proto field of a scalar, non-enum proto type.
+func scalarGoType(protoType string) string {
+	if nt, ok := numberTypes[protoType]; ok {
+		return nt.goType
+	}
+	return protoType
+}
+
+// numberFormatLiteral returns a Go expression for a *csvtoprotoparse.NumberFormat
+// equivalent to f.
+func numberFormatLiteral(f *pb.NumberFormat) string {
+	return fmt.Sprintf("&csvtoprotoparse.NumberFormat{ThousandsSeparator: %q, DecimalMark: %q, Prefix: %q, Suffix: %q, ParenthesizedNegatives: %t, TrimSpace: %t}",
+		f.GetThousandsSeparator(), f.GetDecimalMark(), f.GetPrefix(), f.GetSuffix(), f.GetParenthesizedNegatives(), f.GetTrimSpace())
+}
+
+var numberTypeTemplate = template.Must(template.New("numberType").Parse(`
+type {{.T}} {{.go_type}}
+
+func init() {
+	format := {{.format}}
+	textcoder.Register(
+		reflect.TypeOf({{.T}}(0)),
+		func(v {{.T}}) (string, error) {
+			return {{.format_expr}}, nil
+		},
+		func(s string, dst *{{.T}}) error {
+			v, err := format.{{.parse_func}}(s)
+			if err != nil {
+				return fmt.Errorf("error parsing {{.T}}: %w", err)
+			}
+			*dst = {{.T}}(v)
+			return nil
+		},
+	)
+}
+`))
+
 var durationTypeTemplate = template.Must(template.New("durationType").Parse(`
 type {{.T}} time.Duration
 
@@ -350,20 +719,100 @@ func (d {{.T}}) duration() time.Duration {
 }
 
 func init() {
+	format := {{.format}}
 	textcoder.Register(
-		reflect.TypeOf({{.T}}{}),
+		reflect.TypeOf({{.T}}(0)),
 		func(d {{.T}}) (string, error) {
-			return d.Duration().String(), nil
+			return format.Format(d.duration())
 		},
 		func(s string, dst *{{.T}}) error {
-			d, err := csvtoprotoparse.ParseDuration(s, unit)
+			d, err := format.Parse(s)
 			if err != nil {
 				return fmt.Errorf("error parsing {{.T}}: %w", err)
 			}
 			*dst = {{.T}}(d)
 			return nil
 		},
+	)
+}
+`))
+
+// durationSyntaxes maps the syntaxes of the mapping to their csvtoprotoparse constants.
+var durationSyntaxes = map[pb.DurationFormat_Syntax]string{
+	pb.DurationFormat_GO:       "csvtoprotoparse.GoDurationSyntax",
+	pb.DurationFormat_CLOCK:    "csvtoprotoparse.ClockDurationSyntax",
+	pb.DurationFormat_ISO_8601: "csvtoprotoparse.ISO8601DurationSyntax",
+}
+
+// durationFormatLiteral returns a Go expression for a *csvtoprotoparse.DurationFormat
+// equivalent to f, which may be nil.
+func durationFormatLiteral(f *pb.DurationFormat) (string, error) {
+	syntax, ok := durationSyntaxes[f.GetSyntax()]
+	if !ok {
+		return "", fmt.Errorf("unsupported duration syntax %v", f.GetSyntax())
+	}
+	if f.GetGoUnitSuffix() != "" {
+		if f.GetSyntax() != pb.DurationFormat_GO {
+			return "", fmt.Errorf("go_unit_suffix %q may only be used with the GO duration syntax", f.GetGoUnitSuffix())
+		}
+		if u, err := time.ParseDuration("1" + f.GetGoUnitSuffix()); err != nil || u <= 0 {
+			return "", fmt.Errorf("invalid go_unit_suffix %q", f.GetGoUnitSuffix())
+		}
+	}
+	return fmt.Sprintf("&csvtoprotoparse.DurationFormat{Syntax: %s, GoUnitSuffix: %q}", syntax, f.GetGoUnitSuffix()), nil
+}
+
+// nullableFieldTypeCode returns a wrapper around a field type that records
+// whether the cell held one of the column's null values.
+func nullableFieldTypeCode(c2f *pb.ColumnToFieldMapping, valueType *fieldTypeCode) (*fieldTypeCode, error) {
+	typeName := strcase.LowerCamelCase(c2f.GetProtoName() + "Nullable")
+	var nullValueLiterals []string
+	for _, nv := range c2f.GetNullValues() {
+		nullValueLiterals = append(nullValueLiterals, fmt.Sprintf("%q: true,", nv))
+	}
+	code, err := templateExecString(nullableTypeTemplate, map[string]string{
+		"T":           typeName,
+		"V":           valueType.typeName,
+		"null_values": strings.Join(nullValueLiterals, "\n"),
+		"null_text":   fmt.Sprintf("%q", c2f.GetNullValues()[0]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &fieldTypeCode{code, typeName}, nil
+}
 
+var nullableTypeTemplate = template.Must(template.New("nullableType").Parse(`
+// {{.T}} is a {{.V}} that may be missing from the CSV record.
+type {{.T}} struct {
+	value {{.V}}
+	// valid is false if the cell contained a null value.
+	valid bool
+}
+
+func init() {
+	nullValues := map[string]bool{
+		{{.null_values}}
+	}
+	textcoder.Register(
+		reflect.TypeOf({{.T}}{}),
+		func(ctx *textcoder.Context, v {{.T}}) (string, error) {
+			if !v.valid {
+				return {{.null_text}}, nil
+			}
+			return textcoder.MarshalContext(ctx, v.value)
+		},
+		func(ctx *textcoder.Context, s string, dst *{{.T}}) error {
+			if nullValues[s] {
+				*dst = {{.T}}{}
+				return nil
+			}
+			if err := textcoder.UnmarshalContext(ctx, s, &dst.value); err != nil {
+				return err
+			}
+			dst.valid = true
+			return nil
+		},
 	)
 }
 `))
@@ -374,14 +823,21 @@ type transformExpr struct {
 	// Go code that may be used where the an expression is needed with the same
 	// type as the output type.
 	valueExpr string
+	// Go condition that is true if the input has a value. Empty if the input
+	// always has a value.
+	presentCond string
 }
 
 // inExpr is an expression of the input value. outVar is a variable the
 // transformExpr may use to store the output
 func getGoToProtoFieldExpression(inExpr, outVar, protoType string) (*transformExpr, error) {
 	switch protoType {
-	case "int32", "int64", "float", "double", "string":
-		return &transformExpr{"", inExpr}, nil
+	case "int32", "int64", "uint32", "uint64", "float", "double":
+		return &transformExpr{"", fmt.Sprintf("%s(%s)", numberTypes[protoType].goType, inExpr), ""}, nil
+	case "string":
+		return &transformExpr{"", inExpr, ""}, nil
+	case "bool":
+		return &transformExpr{"", fmt.Sprintf("bool(%s)", inExpr), ""}, nil
 	case "google.protobuf.Timestamp":
 		return &transformExpr{
 			fmt.Sprintf(`
@@ -391,6 +847,7 @@ if err != nil {
 }
 `, outVar, inExpr),
 			outVar,
+			"",
 		}, nil
 	case "google.protobuf.Duration":
 		return &transformExpr{
@@ -401,12 +858,66 @@ if err != nil {
 }
 `, outVar, inExpr),
 			outVar,
+			"",
 		}, nil
 	default:
 		return nil, fmt.Errorf("unexpected type: %q", protoType)
 	}
 }
 
+// protoToGoFieldExpression returns a transformExpr that converts getter, an expression
+// of the proto field's Go type, to the record struct type valueTypeName. It is the
+// inverse of goToProtoFieldExpression.
+func (cg *codeGenerator) protoToGoFieldExpression(getter, valueTypeName string, c2f *pb.ColumnToFieldMapping) (*transformExpr, error) {
+	if enum := cg.enumDefinition(c2f.GetProtoType()); enum != nil {
+		return &transformExpr{"", fmt.Sprintf("%s(%s)", valueTypeName, getter), getter + " != 0"}, nil
+	}
+	var convertFn string
+	switch protoType := c2f.GetProtoType(); protoType {
+	case "int32", "int64", "uint32", "uint64", "float", "double", "string", "bool":
+		return &transformExpr{"", fmt.Sprintf("%s(%s)", valueTypeName, getter), ""}, nil
+	case "google.protobuf.Timestamp":
+		convertFn = "csvtoprotoparse.TimestampToTime"
+	case "google.protobuf.Duration":
+		convertFn = "csvtoprotoparse.DurationProtoToDuration"
+	default:
+		return nil, fmt.Errorf("unexpected type: %q", protoType)
+	}
+	return &transformExpr{
+		fmt.Sprintf(`
+v, err := %s(%s)
+if err != nil {
+	return nil, fmt.Errorf("error converting field %s: %%w", err)
+}
+`, convertFn, getter, c2f.GetProtoName()),
+		fmt.Sprintf("%s(v)", valueTypeName),
+		getter + " != nil",
+	}, nil
+}
+
+// assignmentCode returns a block of Go statements that sets field fieldName of the record
+// struct r from the proto.
+func (e *transformExpr) assignmentCode(fieldName, fieldTypeName string, c2f *pb.ColumnToFieldMapping) string {
+	if len(c2f.GetNullValues()) == 0 {
+		return fmt.Sprintf("{\n%sr.%s = %s\n}", e.parseStatements, fieldName, e.valueExpr)
+	}
+	assign := fmt.Sprintf("r.%s = %s{value: %s, valid: true}\n", fieldName, fieldTypeName, e.valueExpr)
+	if e.presentCond == "" {
+		return fmt.Sprintf("{\n%s%s}", e.parseStatements, assign)
+	}
+	// Fields without a value are written as the column's first null value.
+	return fmt.Sprintf("if %s {\n%s%s}", e.presentCond, e.parseStatements, assign)
+}
+
+// goStringSliceLiteral returns a Go []string literal with the given values.
+func goStringSliceLiteral(values []string) string {
+	var quoted []string
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+	return fmt.Sprintf("[]string{%s}", strings.Join(quoted, ", "))
+}
+
 func templateExecString(t *template.Template, data interface{}) (string, error) {
 	b := &strings.Builder{}
 	if err := t.Execute(b, data); err != nil {
@@ -0,0 +1,425 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvtoproto
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/cmd/protoc-gen-go/internal_gengo"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/pluginpb"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+
+	// Register the well-known types that generated protos may import.
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var updateGolden = flag.Bool("update_golden", false, "rewrite the want.textproto and want.csv files of the golden tests")
+
+const (
+	// goldenModule is the path of the temporary module in which golden converters are
+	// compiled.
+	goldenModule = "xtoproto.test/golden"
+
+	// goldenRecordsMessage is the name of the message whose repeated "records" field holds
+	// the records of a golden test.
+	goldenRecordsMessage = "GoldenRecords"
+)
+
+// goldenCase is a directory of testdata/golden with the files
+//
+//   - mapping.textproto: a RecordProtoMapping. Its go_options are ignored.
+//   - input.csv: the input of the generated reader.
+//   - want.textproto: a GoldenRecords message with the records read from input.csv.
+//   - want.csv: the output of the generated writer for those records.
+//
+// Run "go test ./csvtoproto -run TestGolden -update_golden" to rewrite the want files after
+// an intended change to the generated code.
+type goldenCase struct {
+	name, dir string
+	mapping   *pb.RecordProtoMapping
+	// files are the descriptors of the generated .proto file and its dependencies,
+	// followed by the descriptor of the GoldenRecords message's file.
+	files []*descriptorpb.FileDescriptorProto
+}
+
+// TestGolden generates the code of each mapping in testdata/golden, compiles it in a
+// temporary module, runs the generated converter on the input CSV and compares the
+// resulting records and rewritten CSV to the golden files.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping compilation of generated code in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Fatalf("the go tool is needed to compile generated code; run with -short to skip this test: %v", err)
+	}
+	repoRoot, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirs, err := filepath.Glob(filepath.Join("testdata", "golden", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("no golden test cases found in testdata/golden")
+	}
+
+	moduleDir := t.TempDir()
+	if err := writeGoldenModule(moduleDir, repoRoot); err != nil {
+		t.Fatal(err)
+	}
+	var cases []*goldenCase
+	for _, dir := range dirs {
+		gc, err := prepareGoldenCase(dir, moduleDir)
+		if err != nil {
+			t.Fatalf("error preparing golden case %s: %v", dir, err)
+		}
+		cases = append(cases, gc)
+	}
+
+	binDir := t.TempDir()
+	build := exec.Command(goTool, "build", "-o", binDir+string(filepath.Separator), "./...")
+	build.Dir = moduleDir
+	// The module requires the same versions as the repository's go.mod, all of which are
+	// in the module cache after building this test, so the go tool may not download
+	// anything.
+	build.Env = append(os.Environ(), "GOFLAGS=-mod=readonly", "GOPROXY=off", "GOWORK=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("error compiling generated code: %v\n%s", err, out)
+	}
+
+	for _, gc := range cases {
+		t.Run(gc.name, func(t *testing.T) {
+			gc.run(t, filepath.Join(binDir, gc.name))
+		})
+	}
+}
+
+// writeGoldenModule writes the go.mod and go.sum files of a module that uses the
+// xtoproto packages in repoRoot. The module requires the same dependency versions as
+// repoRoot.
+func writeGoldenModule(moduleDir, repoRoot string) error {
+	repoGoMod, err := ioutil.ReadFile(filepath.Join(repoRoot, "go.mod"))
+	if err != nil {
+		return err
+	}
+	const repoModule = "module github.com/google/xtoproto\n"
+	if !bytes.HasPrefix(repoGoMod, []byte(repoModule)) {
+		return fmt.Errorf("%s/go.mod does not start with %q", repoRoot, repoModule)
+	}
+	goMod := fmt.Sprintf(`module %s
+%s
+require github.com/google/xtoproto v0.0.0
+
+replace github.com/google/xtoproto => %s
+`, goldenModule, repoGoMod[len(repoModule):], filepath.ToSlash(repoRoot))
+	if err := ioutil.WriteFile(filepath.Join(moduleDir, "go.mod"), []byte(goMod), 0644); err != nil {
+		return err
+	}
+	goSum, err := ioutil.ReadFile(filepath.Join(repoRoot, "go.sum"))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(moduleDir, "go.sum"), goSum, 0644)
+}
+
+// prepareGoldenCase generates the code of the golden case in dir and writes it to a
+// directory of the module, along with a main package that runs the converter.
+func prepareGoldenCase(dir, moduleDir string) (*goldenCase, error) {
+	gc := &goldenCase{name: filepath.Base(dir), dir: dir, mapping: &pb.RecordProtoMapping{}}
+	if strings.ContainsAny(gc.name, "-. ") {
+		return nil, fmt.Errorf("golden case name %q must be a valid Go package name", gc.name)
+	}
+	text, err := ioutil.ReadFile(filepath.Join(dir, "mapping.textproto"))
+	if err != nil {
+		return nil, err
+	}
+	if err := prototext.Unmarshal(text, gc.mapping); err != nil {
+		return nil, fmt.Errorf("error parsing mapping: %w", err)
+	}
+	casePath := goldenModule + "/" + gc.name
+	gc.mapping.GoOptions = &pb.GoOptions{
+		GoPackageName: "converter",
+		ProtoImport:   casePath + "/pb",
+	}
+	protoCode, goCode, err := GenerateCode(gc.mapping, true, true)
+	if err != nil {
+		return nil, fmt.Errorf("error generating code: %w", err)
+	}
+
+	pbGo, err := gc.compileProto(protoCode)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{
+		"pb/record.pb.go":        pbGo,
+		"converter/converter.go": goCode,
+		"main.go":                fmt.Sprintf(goldenMainCode, casePath+"/converter"),
+	}
+	for name, contents := range files {
+		path := filepath.Join(moduleDir, gc.name, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return gc, nil
+}
+
+// compileProto parses the generated .proto file, records the descriptors needed to read
+// golden records, and returns the Go code that protoc-gen-go would generate for it.
+func (gc *goldenCase) compileProto(protoCode string) (string, error) {
+	const protoFileName = "record.proto"
+	parser := protoparse.Parser{
+		Accessor:              protoparse.FileContentsFromMap(map[string]string{protoFileName: protoCode}),
+		LookupImport:          desc.LoadFileDescriptor,
+		IncludeSourceCodeInfo: true,
+	}
+	fds, err := parser.ParseFiles(protoFileName)
+	if err != nil {
+		return "", fmt.Errorf("error parsing generated .proto file: %w\n%s", err, protoCode)
+	}
+	fd := fds[0]
+	var deps []*descriptorpb.FileDescriptorProto
+	seen := map[string]bool{}
+	var addDeps func(fd *desc.FileDescriptor)
+	addDeps = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dep := range fd.GetDependencies() {
+			addDeps(dep)
+		}
+		deps = append(deps, fd.AsFileDescriptorProto())
+	}
+	addDeps(fd)
+
+	recordProto := proto.Clone(deps[len(deps)-1]).(*descriptorpb.FileDescriptorProto)
+	if recordProto.Options == nil {
+		recordProto.Options = &descriptorpb.FileOptions{}
+	}
+	recordProto.Options.GoPackage = proto.String(gc.mapping.GetGoOptions().GetProtoImport())
+	deps[len(deps)-1] = recordProto
+
+	plugin, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{protoFileName},
+		ProtoFile:      deps,
+	})
+	if err != nil {
+		return "", err
+	}
+	// internal_gengo is the code generator of protoc-gen-go. It is not a stable API,
+	// but it is the only way to run protoc-gen-go in process, and the generated code is
+	// compiled against the same google.golang.org/protobuf version pinned in go.mod. It
+	// may need changes when that version is upgraded.
+	for _, f := range plugin.Files {
+		if f.Generate {
+			internal_gengo.GenerateFile(plugin, f)
+		}
+	}
+	resp := plugin.Response()
+	if resp.Error != nil {
+		return "", fmt.Errorf("error generating Go code for the .proto file: %s", resp.GetError())
+	}
+	if len(resp.GetFile()) != 1 {
+		return "", fmt.Errorf("got %d generated Go files for the .proto file, want 1", len(resp.GetFile()))
+	}
+
+	msg := fd.FindMessage(qualifiedName(gc.mapping.GetPackageName(), gc.mapping.GetMessageName()))
+	if msg == nil {
+		return "", fmt.Errorf("generated .proto file has no message %s", gc.mapping.GetMessageName())
+	}
+	records, err := builder.NewFile("golden_records.proto").
+		SetPackageName(gc.mapping.GetPackageName()).
+		SetProto3(true).
+		AddMessage(builder.NewMessage(goldenRecordsMessage).
+			AddField(builder.NewField("records", builder.FieldTypeImportedMessage(msg)).SetNumber(1).SetRepeated())).
+		Build()
+	if err != nil {
+		return "", err
+	}
+	gc.files = append(deps, records.AsFileDescriptorProto())
+	return resp.GetFile()[0].GetContent(), nil
+}
+
+// run runs the compiled converter of the golden case and compares its output to the
+// golden files.
+func (gc *goldenCase) run(t *testing.T, binary string) {
+	gotCSVPath := filepath.Join(t.TempDir(), "out.csv")
+	cmd := exec.Command(binary, filepath.Join(gc.dir, "input.csv"), gotCSVPath)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("error running the generated converter: %v\n%s", err, stderr.String())
+	}
+	gotCSV, err := ioutil.ReadFile(gotCSVPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordsType, err := gc.recordsType()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := recordsType.New().Interface()
+	if err := proto.Unmarshal(stdout.Bytes(), got); err != nil {
+		t.Fatalf("error parsing the records written by the generated converter: %v", err)
+	}
+
+	wantRecordsPath, wantCSVPath := filepath.Join(gc.dir, "want.textproto"), filepath.Join(gc.dir, "want.csv")
+	if *updateGolden {
+		text, err := (prototext.MarshalOptions{Multiline: true}).Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(wantRecordsPath, text, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(wantCSVPath, gotCSV, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	wantText, err := ioutil.ReadFile(wantRecordsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := recordsType.New().Interface()
+	if err := prototext.Unmarshal(wantText, want); err != nil {
+		t.Fatalf("error parsing %s: %v", wantRecordsPath, err)
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected records (-want, +got):\n%s", diff)
+	}
+	wantCSV, err := ioutil.ReadFile(wantCSVPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(wantCSV), string(gotCSV)); diff != "" {
+		t.Errorf("unexpected CSV written by the generated writer (-want, +got):\n%s", diff)
+	}
+}
+
+// recordsType returns a dynamic type for the GoldenRecords message of the golden case.
+func (gc *goldenCase) recordsType() (protoreflect.MessageType, error) {
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: gc.files})
+	if err != nil {
+		return nil, err
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(qualifiedName(gc.mapping.GetPackageName(), goldenRecordsMessage)))
+	if err != nil {
+		return nil, err
+	}
+	return dynamicpb.NewMessageType(d.(protoreflect.MessageDescriptor)), nil
+}
+
+// qualifiedName returns the full name of a message in a package, which may be empty.
+func qualifiedName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// goldenMainCode is the main package of a golden case. It reads the CSV file named by the
+// first argument, writes the records as a GoldenRecords message in wire format to stdout
+// and writes them as CSV to the file named by the second argument.
+const goldenMainCode = `package main
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	"%s"
+)
+
+func main() {
+	if err := run(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(inPath, outPath string) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := converter.NewReader(in)
+	if err != nil {
+		return err
+	}
+	recs, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := converter.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteAll(recs); err != nil {
+		return err
+	}
+
+	var records []byte
+	for _, rec := range recs {
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		records = protowire.AppendTag(records, 1, protowire.BytesType)
+		records = protowire.AppendBytes(records, b)
+	}
+	_, err = os.Stdout.Write(records)
+	return err
+}
+`
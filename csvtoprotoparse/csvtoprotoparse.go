@@ -22,6 +22,7 @@ package csvtoprotoparse
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
@@ -53,6 +54,33 @@ func ParseInt64(rawValue string) (int64, error) {
 	return int64(v), err
 }
 
+// ParseUint32 returns a uint32 parsed from a CSV field.
+func ParseUint32(rawValue string) (uint32, error) {
+	v, err := strconv.ParseUint(rawValue, 10, 32)
+	return uint32(v), err
+}
+
+// ParseUint64 returns a uint64 parsed from a CSV field.
+func ParseUint64(rawValue string) (uint64, error) {
+	return strconv.ParseUint(rawValue, 10, 64)
+}
+
+// ParseBool returns a bool from a CSV field. The value is compared case
+// insensitively against trueValues and falseValues.
+func ParseBool(rawValue string, trueValues, falseValues []string) (bool, error) {
+	for _, v := range trueValues {
+		if strings.EqualFold(v, rawValue) {
+			return true, nil
+		}
+	}
+	for _, v := range falseValues {
+		if strings.EqualFold(v, rawValue) {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("unsupported bool value %q; want one of %q or %q", rawValue, trueValues, falseValues)
+}
+
 // ParseString parses a string value from a CSV field.
 //
 // This function has a strange signature for the convenience of the generated
@@ -95,9 +123,42 @@ func DurationToDurationProto(d time.Duration) (*dpb.Duration, error) {
 	return ptypes.DurationProto(d), nil
 }
 
+// TimestampToTime returns the time of a Timestamp proto. It returns an error if the
+// timestamp is nil or out of range.
+func TimestampToTime(t *ts.Timestamp) (time.Time, error) {
+	return ptypes.Timestamp(t)
+}
+
+// DurationProtoToDuration returns the time.Duration of a Duration proto. It
+// returns an error if the duration is nil or out of range.
+func DurationProtoToDuration(d *dpb.Duration) (time.Duration, error) {
+	return ptypes.Duration(d)
+}
+
 // ReaderOption is used to specify a custom argument to csvtoproto readers at construction time.
+// Generated readers apply options of type csvcoder.FileParserOption to the parser of the file.
 type ReaderOption interface{}
 
+// Errors is an error made up of several errors, such as the errors returned while parsing a
+// row and by the row hooks of a generated reader.
+type Errors []error
+
+func (e Errors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the first error.
+func (e Errors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0]
+}
+
 // MustLoadLocation returns a time.Location or panics.
 func MustLoadLocation(name string) *time.Location {
 	tz, err := time.LoadLocation(name)
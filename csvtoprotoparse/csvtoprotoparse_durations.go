@@ -0,0 +1,253 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvtoprotoparse
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	clockDurationPattern   = regexp.MustCompile(`^([-+]?)(\d+):([0-5]\d):([0-5]\d(?:\.\d+)?)$`)
+	iso8601DurationPattern = regexp.MustCompile(`^([-+]?)P(?:(\d+(?:[.,]\d+)?)W)?(?:(\d+(?:[.,]\d+)?)D)?(?:T(?:(\d+(?:[.,]\d+)?)H)?(?:(\d+(?:[.,]\d+)?)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+)
+
+// DurationSyntax identifies how durations are written in a CSV field. It mirrors the Syntax
+// enum of the mapping's DurationFormat message.
+type DurationSyntax int
+
+// Duration syntaxes.
+const (
+	// GoDurationSyntax is time.ParseDuration syntax, such as "1h30m".
+	GoDurationSyntax DurationSyntax = iota
+	// ClockDurationSyntax is HH:MM:SS with optional fractional seconds, such as "01:30:00".
+	ClockDurationSyntax
+	// ISO8601DurationSyntax is ISO 8601 syntax without years or months, such as "PT1H30M".
+	ISO8601DurationSyntax
+)
+
+// DurationFormat describes how durations are written in a CSV field. The zero value
+// accepts time.ParseDuration syntax like "1h30m".
+type DurationFormat struct {
+	Syntax DurationSyntax
+	// GoUnitSuffix is appended to values of GoDurationSyntax before parsing, so "150" is
+	// 150 milliseconds if the suffix is "ms". Values are formatted as plain numbers in
+	// this unit.
+	GoUnitSuffix string
+}
+
+// Parse returns a duration parsed from a CSV field.
+func (f *DurationFormat) Parse(rawValue string) (time.Duration, error) {
+	switch f.Syntax {
+	case ClockDurationSyntax:
+		return ParseClockDuration(rawValue)
+	case ISO8601DurationSyntax:
+		return ParseISO8601Duration(rawValue)
+	}
+	return ParseGoDuration(rawValue, f.GoUnitSuffix)
+}
+
+// Format returns the textual form of a duration. It returns an error if the unit suffix
+// is invalid.
+func (f *DurationFormat) Format(d time.Duration) (string, error) {
+	switch f.Syntax {
+	case ClockDurationSyntax:
+		return FormatClockDuration(d), nil
+	case ISO8601DurationSyntax:
+		return FormatISO8601Duration(d), nil
+	}
+	return FormatGoDuration(d, f.GoUnitSuffix)
+}
+
+// ParseGoDuration returns a duration parsed with time.ParseDuration after appending the
+// unit suffix, which may be empty. For example, "150" with the unit "ms" is 150
+// milliseconds.
+func ParseGoDuration(rawValue, unit string) (time.Duration, error) {
+	return time.ParseDuration(rawValue + unit)
+}
+
+// ParseClockDuration returns a duration written as hours, minutes and seconds separated by
+// colons, such as "01:30:00" or "-00:00:01.5". The number of hours is not limited to 24.
+func ParseClockDuration(rawValue string) (time.Duration, error) {
+	m := clockDurationPattern.FindStringSubmatch(rawValue)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q; want HH:MM:SS with optional fractional seconds", rawValue)
+	}
+	return sumDurationComponents(rawValue, m[1], []string{m[2], m[3], m[4]}, []time.Duration{time.Hour, time.Minute, time.Second})
+}
+
+// ParseISO8601Duration returns a duration written in ISO 8601 syntax, such as "PT5M" or
+// "P1DT2H30.5S". A day is 24 hours and a week is 7 days. Years and months are not
+// supported.
+func ParseISO8601Duration(rawValue string) (time.Duration, error) {
+	m := iso8601DurationPattern.FindStringSubmatch(rawValue)
+	if m == nil || strings.HasSuffix(rawValue, "T") || (m[2] == "" && m[3] == "" && m[4] == "" && m[5] == "" && m[6] == "") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q; want a value like \"P1DT2H30M\" without years or months", rawValue)
+	}
+	return sumDurationComponents(rawValue, m[1], m[2:7], []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second})
+}
+
+// FormatGoDuration returns the textual form of a duration accepted by ParseGoDuration with
+// the same unit. If the unit is empty, it returns d.String(), such as "1h30m0s"; otherwise it
+// returns the number of units, such as "1.5" for 1500ms in the unit "s".
+func FormatGoDuration(d time.Duration, unit string) (string, error) {
+	if unit == "" {
+		return d.String(), nil
+	}
+	u, err := time.ParseDuration("1" + unit)
+	if err != nil || u <= 0 {
+		return "", fmt.Errorf("invalid duration unit %q", unit)
+	}
+	if d%u == 0 {
+		return strconv.FormatInt(int64(d/u), 10), nil
+	}
+	return strconv.FormatFloat(float64(d)/float64(u), 'f', -1, 64), nil
+}
+
+// FormatClockDuration returns the textual form of a duration accepted by
+// ParseClockDuration, such as "01:30:00" or "00:00:01.5".
+func FormatClockDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+	}
+	u := absDuration(d)
+	h, m, s, frac := u/hour, u%hour/minute, u%minute/second, u%second
+	return fmt.Sprintf("%s%02d:%02d:%02d%s", sign, h, m, s, fractionalSeconds(frac))
+}
+
+// FormatISO8601Duration returns the textual form of a duration accepted by
+// ParseISO8601Duration, such as "PT1H30M" or "-PT0.5S". Days are not used, since a day in
+// a calendar is not always 24 hours.
+func FormatISO8601Duration(d time.Duration) string {
+	if d == 0 {
+		return "PT0S"
+	}
+	var b strings.Builder
+	if d < 0 {
+		b.WriteString("-")
+	}
+	b.WriteString("PT")
+	u := absDuration(d)
+	if h := u / hour; h != 0 {
+		fmt.Fprintf(&b, "%dH", h)
+	}
+	if m := u % hour / minute; m != 0 {
+		fmt.Fprintf(&b, "%dM", m)
+	}
+	if s, frac := u%minute/second, u%second; s != 0 || frac != 0 {
+		fmt.Fprintf(&b, "%d%sS", s, fractionalSeconds(frac))
+	}
+	return b.String()
+}
+
+// Units of the absolute values returned by absDuration.
+const (
+	second = uint64(time.Second)
+	minute = uint64(time.Minute)
+	hour   = uint64(time.Hour)
+)
+
+// absDuration returns the absolute value of d as a uint64, which holds the absolute value
+// of math.MinInt64.
+func absDuration(d time.Duration) uint64 {
+	if d < 0 {
+		return uint64(-(d + 1)) + 1
+	}
+	return uint64(d)
+}
+
+// fractionalSeconds returns the fractional part of a second, such as ".25" for 250ms, or
+// "" if it is zero.
+func fractionalSeconds(frac uint64) string {
+	if frac == 0 {
+		return ""
+	}
+	return strings.TrimRight(fmt.Sprintf(".%09d", frac), "0")
+}
+
+// sumDurationComponents returns the sum of each component, a possibly empty decimal
+// number, times its unit, negated if sign is "-". The result is rounded to the nearest
+// nanosecond.
+func sumDurationComponents(rawValue, sign string, components []string, units []time.Duration) (time.Duration, error) {
+	limit := uint64(math.MaxInt64)
+	if sign == "-" {
+		limit++
+	}
+	var total uint64
+	for i, c := range components {
+		if c == "" {
+			continue
+		}
+		v, ok := durationComponentNanos(c, uint64(units[i]))
+		if !ok || v > limit-total {
+			return 0, fmt.Errorf("duration %q is out of range", rawValue)
+		}
+		total += v
+	}
+	if sign == "-" {
+		return time.Duration(-int64(total-1) - 1), nil
+	}
+	return time.Duration(total), nil
+}
+
+// maxFractionDigits is the number of fractional digits of a duration component that are
+// used. A component can be a week, so 18 digits keep it well below a nanosecond.
+const maxFractionDigits = 18
+
+// durationComponentNanos returns a decimal number such as "1.5" or "1,5" times unit,
+// rounded to the nearest nanosecond. It returns false if the result does not fit in a
+// uint64.
+func durationComponentNanos(c string, unit uint64) (uint64, bool) {
+	intPart, fracPart := c, ""
+	if i := strings.IndexAny(c, ".,"); i >= 0 {
+		intPart, fracPart = c[:i], c[i+1:]
+	}
+	n, err := strconv.ParseUint(intPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	hi, v := bits.Mul64(n, unit)
+	if hi != 0 {
+		return 0, false
+	}
+	if len(fracPart) > maxFractionDigits {
+		fracPart = fracPart[:maxFractionDigits]
+	}
+	if fracPart == "" {
+		return v, true
+	}
+	frac, err := strconv.ParseUint(fracPart, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	// frac < scale, so the quotient of frac*unit/scale fits in a uint64.
+	scale := uint64(1)
+	for range fracPart {
+		scale *= 10
+	}
+	hi, lo := bits.Mul64(frac, unit)
+	q, r := bits.Div64(hi, lo, scale)
+	if 2*r >= scale {
+		q++
+	}
+	sum, carry := bits.Add64(v, q, 0)
+	return sum, carry == 0
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvtoprotoparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat describes how numbers are written in a CSV field. It mirrors the
+// NumberFormat message of the mapping. The zero value accepts plain decimal numbers
+// like "-12.5".
+type NumberFormat struct {
+	// ThousandsSeparator separates groups of three digits in the integer part. Grouping
+	// is optional when parsing.
+	ThousandsSeparator string
+	// DecimalMark separates the integer and fractional parts. Empty means ".".
+	DecimalMark string
+	// Prefix and Suffix surround the number, as in "$12" or "45%". They are optional
+	// when parsing.
+	Prefix, Suffix string
+	// ParenthesizedNegatives is true if negative numbers are written like "(12)".
+	ParenthesizedNegatives bool
+	// TrimSpace is true if leading and trailing whitespace is ignored.
+	TrimSpace bool
+}
+
+// ParseInt32 returns an int32 parsed from a CSV field.
+func (f *NumberFormat) ParseInt32(rawValue string) (int32, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	return int32(v), err
+}
+
+// ParseInt64 returns an int64 parsed from a CSV field.
+func (f *NumberFormat) ParseInt64(rawValue string) (int64, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// ParseUint32 returns a uint32 parsed from a CSV field.
+func (f *NumberFormat) ParseUint32(rawValue string) (uint32, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
+
+// ParseUint64 returns a uint64 parsed from a CSV field.
+func (f *NumberFormat) ParseUint64(rawValue string) (uint64, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// ParseFloat returns a float parsed from a CSV field.
+func (f *NumberFormat) ParseFloat(rawValue string) (float32, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(s, 32)
+	return float32(v), err
+}
+
+// ParseDouble returns a double parsed from a CSV field.
+func (f *NumberFormat) ParseDouble(rawValue string) (float64, error) {
+	s, err := f.Normalize(rawValue)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// FormatInt returns the textual form of an integer.
+func (f *NumberFormat) FormatInt(v int64) string {
+	return f.format(strconv.FormatInt(v, 10))
+}
+
+// FormatUint returns the textual form of an unsigned integer.
+func (f *NumberFormat) FormatUint(v uint64) string {
+	return f.format(strconv.FormatUint(v, 10))
+}
+
+// FormatFloat returns the textual form of a floating point number of the given bit
+// size, 32 or 64, with the fewest digits that parse back to the same value.
+func (f *NumberFormat) FormatFloat(v float64, bitSize int) string {
+	return f.format(strconv.FormatFloat(v, 'f', -1, bitSize))
+}
+
+// Normalize returns rawValue in the form accepted by strconv, as in "-1234.5" for
+// "($1,234.50)". It returns an error if the value is not written in this format.
+func (f *NumberFormat) Normalize(rawValue string) (string, error) {
+	s := rawValue
+	if f.TrimSpace {
+		s = strings.TrimSpace(s)
+	}
+	negative := false
+	if f.ParenthesizedNegatives && len(s) > 2 && strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s, negative = s[1:len(s)-1], true
+	}
+	sign := ""
+	takeSign := func() {
+		if sign == "" && (strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+")) {
+			sign, s = s[:1], s[1:]
+		}
+	}
+	takeSign()
+	if f.Prefix != "" {
+		s = strings.TrimPrefix(s, f.Prefix)
+	}
+	takeSign()
+	if f.Suffix != "" {
+		s = strings.TrimSuffix(s, f.Suffix)
+	}
+	if negative {
+		if sign != "" {
+			return "", fmt.Errorf("number %q has both parentheses and a sign", rawValue)
+		}
+		sign = "-"
+	}
+
+	decimalMark := f.DecimalMark
+	if decimalMark == "" {
+		decimalMark = "."
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, decimalMark)
+	if f.ThousandsSeparator != "" && strings.Contains(intPart, f.ThousandsSeparator) {
+		groups := strings.Split(intPart, f.ThousandsSeparator)
+		for i, g := range groups {
+			if (i == 0 && (len(g) < 1 || len(g) > 3)) || (i > 0 && len(g) != 3) || !isDigits(g) {
+				return "", fmt.Errorf("number %q has invalid digit grouping", rawValue)
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+	if !isDigits(intPart) || (hasFrac && !isDigits(fracPart)) || (intPart == "" && fracPart == "") {
+		return "", fmt.Errorf("invalid number %q", rawValue)
+	}
+	if hasFrac {
+		return sign + intPart + "." + fracPart, nil
+	}
+	return sign + intPart, nil
+}
+
+// format returns the textual form of a number formatted by strconv.
+func (f *NumberFormat) format(s string) string {
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+	if f.ThousandsSeparator != "" {
+		var groups []string
+		for len(intPart) > 3 {
+			groups = append([]string{intPart[len(intPart)-3:]}, groups...)
+			intPart = intPart[:len(intPart)-3]
+		}
+		intPart = strings.Join(append([]string{intPart}, groups...), f.ThousandsSeparator)
+	}
+	s = intPart
+	if hasFrac {
+		decimalMark := f.DecimalMark
+		if decimalMark == "" {
+			decimalMark = "."
+		}
+		s += decimalMark + fracPart
+	}
+	s = f.Prefix + s + f.Suffix
+	switch {
+	case negative && f.ParenthesizedNegatives:
+		return "(" + s + ")"
+	case negative:
+		return "-" + s
+	}
+	return s
+}
+
+// isDigits reports whether s consists only of ASCII digits. The empty string is
+// considered digits.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
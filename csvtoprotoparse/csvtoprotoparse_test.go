@@ -0,0 +1,296 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csvtoprotoparse
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNumberFormatNormalize(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		format  NumberFormat
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"plain", NumberFormat{}, "-12.5", "-12.5", false},
+		{"plus sign", NumberFormat{}, "+7", "+7", false},
+		{"leading decimal mark", NumberFormat{}, ".5", ".5", false},
+		{"grouping", NumberFormat{ThousandsSeparator: ","}, "1,234,567", "1234567", false},
+		{"grouping is optional", NumberFormat{ThousandsSeparator: ","}, "1234567", "1234567", false},
+		{"bad group size", NumberFormat{ThousandsSeparator: ","}, "12,34", "", true},
+		{"empty leading group", NumberFormat{ThousandsSeparator: ","}, ",123", "", true},
+		{"long leading group", NumberFormat{ThousandsSeparator: ","}, "1234,567", "", true},
+		{"decimal comma", NumberFormat{ThousandsSeparator: ".", DecimalMark: ","}, "1.234,5", "1234.5", false},
+		{"decimal comma rejects point", NumberFormat{DecimalMark: ","}, "1.5", "", true},
+		{"affixes", NumberFormat{Prefix: "$", Suffix: " USD"}, "$12 USD", "12", false},
+		{"affixes are optional", NumberFormat{Prefix: "$", Suffix: "%"}, "12", "12", false},
+		{"sign before prefix", NumberFormat{Prefix: "$"}, "-$12", "-12", false},
+		{"sign after prefix", NumberFormat{Prefix: "$"}, "$-12", "-12", false},
+		{"accounting negative", NumberFormat{ThousandsSeparator: ",", Prefix: "$", ParenthesizedNegatives: true}, "($1,234.50)", "-1234.50", false},
+		{"parentheses and sign", NumberFormat{ParenthesizedNegatives: true}, "(-12)", "", true},
+		{"parentheses not enabled", NumberFormat{}, "(12)", "", true},
+		{"empty parentheses", NumberFormat{ParenthesizedNegatives: true}, "()", "", true},
+		{"trim space", NumberFormat{TrimSpace: true}, " 12 ", "12", false},
+		{"space without trim", NumberFormat{}, " 12", "", true},
+		{"empty", NumberFormat{}, "", "", true},
+		{"sign only", NumberFormat{}, "-", "", true},
+		{"decimal mark only", NumberFormat{}, ".", "", true},
+		{"letters", NumberFormat{}, "12a", "", true},
+		{"exponent", NumberFormat{}, "1e3", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.format.Normalize(tt.in)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("Normalize(%q) got error %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberFormatFormat(t *testing.T) {
+	accounting := NumberFormat{ThousandsSeparator: ",", Prefix: "$", ParenthesizedNegatives: true}
+	european := NumberFormat{ThousandsSeparator: ".", DecimalMark: ",", Suffix: " €"}
+	for _, tt := range []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"plain int", (&NumberFormat{}).FormatInt(-1234), "-1234"},
+		{"grouped int", (&NumberFormat{ThousandsSeparator: ","}).FormatInt(1234567), "1,234,567"},
+		{"three digits are not grouped", (&NumberFormat{ThousandsSeparator: ","}).FormatInt(123), "123"},
+		{"accounting negative", accounting.FormatFloat(-1234.5, 64), "($1,234.5)"},
+		{"accounting positive", accounting.FormatUint(1000), "$1,000"},
+		{"decimal comma", european.FormatFloat(1234.25, 64), "1.234,25 €"},
+		{"negative with affixes", (&NumberFormat{Prefix: "$"}).FormatInt(-5), "-$5"},
+		{"float32", (&NumberFormat{}).FormatFloat(float64(float32(0.1)), 32), "0.1"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestNumberFormatRoundTrip(t *testing.T) {
+	formats := []NumberFormat{
+		{},
+		{ThousandsSeparator: ","},
+		{ThousandsSeparator: ".", DecimalMark: ","},
+		{ThousandsSeparator: " ", Prefix: "$", Suffix: "%"},
+		{ThousandsSeparator: ",", Prefix: "$", ParenthesizedNegatives: true},
+	}
+	for _, f := range formats {
+		for _, v := range []int64{0, 7, -7, 999, 1000, -1234567, math.MaxInt64, math.MinInt64} {
+			s := f.FormatInt(v)
+			if got, err := f.ParseInt64(s); err != nil || got != v {
+				t.Errorf("%+v: ParseInt64(%q) = %d, %v; want %d", f, s, got, err, v)
+			}
+		}
+		for _, v := range []uint64{0, 1000, math.MaxUint64} {
+			s := f.FormatUint(v)
+			if got, err := f.ParseUint64(s); err != nil || got != v {
+				t.Errorf("%+v: ParseUint64(%q) = %d, %v; want %d", f, s, got, err, v)
+			}
+		}
+		for _, v := range []float64{0, 0.5, -0.001, 1234.5678, -9876543.21, 1e20} {
+			s := f.FormatFloat(v, 64)
+			if got, err := f.ParseDouble(s); err != nil || got != v {
+				t.Errorf("%+v: ParseDouble(%q) = %v, %v; want %v", f, s, got, err, v)
+			}
+		}
+		for _, v := range []float32{0.1, -1234.5, 3.4e38} {
+			s := f.FormatFloat(float64(v), 32)
+			if got, err := f.ParseFloat(s); err != nil || got != v {
+				t.Errorf("%+v: ParseFloat(%q) = %v, %v; want %v", f, s, got, err, v)
+			}
+		}
+	}
+}
+
+func TestParseIntegerRanges(t *testing.T) {
+	grouped := &NumberFormat{ThousandsSeparator: ",", ParenthesizedNegatives: true}
+	parsers := map[string]struct {
+		plain, formatted func(string) (string, error)
+	}{
+		"int32": {
+			func(s string) (string, error) { v, err := ParseInt32(s); return fmt.Sprint(v), err },
+			func(s string) (string, error) { v, err := grouped.ParseInt32(s); return fmt.Sprint(v), err },
+		},
+		"int64": {
+			func(s string) (string, error) { v, err := ParseInt64(s); return fmt.Sprint(v), err },
+			func(s string) (string, error) { v, err := grouped.ParseInt64(s); return fmt.Sprint(v), err },
+		},
+		"uint32": {
+			func(s string) (string, error) { v, err := ParseUint32(s); return fmt.Sprint(v), err },
+			func(s string) (string, error) { v, err := grouped.ParseUint32(s); return fmt.Sprint(v), err },
+		},
+		"uint64": {
+			func(s string) (string, error) { v, err := ParseUint64(s); return fmt.Sprint(v), err },
+			func(s string) (string, error) { v, err := grouped.ParseUint64(s); return fmt.Sprint(v), err },
+		},
+	}
+	for _, tt := range []struct {
+		parser    string
+		plain     string
+		formatted string
+		want      string
+		wantErr   bool
+	}{
+		{"int32", "2147483647", "2,147,483,647", "2147483647", false},
+		{"int32", "-2147483648", "(2,147,483,648)", "-2147483648", false},
+		{"int32", "2147483648", "2,147,483,648", "", true},
+		{"int32", "-2147483649", "(2,147,483,649)", "", true},
+		{"int64", "9223372036854775807", "9,223,372,036,854,775,807", "9223372036854775807", false},
+		{"int64", "-9223372036854775808", "(9,223,372,036,854,775,808)", "-9223372036854775808", false},
+		{"int64", "9223372036854775808", "9,223,372,036,854,775,808", "", true},
+		{"int64", "1.5", "1.5", "", true},
+		{"uint32", "4294967295", "4,294,967,295", "4294967295", false},
+		{"uint32", "4294967296", "4,294,967,296", "", true},
+		{"uint32", "-1", "(1)", "", true},
+		{"uint64", "18446744073709551615", "18,446,744,073,709,551,615", "18446744073709551615", false},
+		{"uint64", "18446744073709551616", "18,446,744,073,709,551,616", "", true},
+		{"uint64", "-1", "(1)", "", true},
+	} {
+		p := parsers[tt.parser]
+		for _, c := range []struct {
+			parse func(string) (string, error)
+			in    string
+		}{{p.plain, tt.plain}, {p.formatted, tt.formatted}} {
+			got, err := c.parse(c.in)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Errorf("%s: parsing %q got error %v, want error %v", tt.parser, c.in, err, tt.wantErr)
+				continue
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("%s: parsing %q = %s, want %s", tt.parser, c.in, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		format  DurationFormat
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"go", DurationFormat{}, "1h30m", 90 * time.Minute, false},
+		{"go with unit", DurationFormat{GoUnitSuffix: "ms"}, "150", 150 * time.Millisecond, false},
+		{"go invalid", DurationFormat{}, "90", 0, true},
+		{"clock", DurationFormat{Syntax: ClockDurationSyntax}, "01:30:00", 90 * time.Minute, false},
+		{"clock over 24 hours", DurationFormat{Syntax: ClockDurationSyntax}, "36:00:00", 36 * time.Hour, false},
+		{"clock negative fraction", DurationFormat{Syntax: ClockDurationSyntax}, "-00:00:01.5", -1500 * time.Millisecond, false},
+		{"clock nanoseconds beyond float precision", DurationFormat{Syntax: ClockDurationSyntax}, "5000:00:00.000000001", 5000*time.Hour + 1, false},
+		{"clock rounds to nanoseconds", DurationFormat{Syntax: ClockDurationSyntax}, "00:00:00.0000000015", 2, false},
+		{"clock max", DurationFormat{Syntax: ClockDurationSyntax}, "2562047:47:16.854775807", math.MaxInt64, false},
+		{"clock min", DurationFormat{Syntax: ClockDurationSyntax}, "-2562047:47:16.854775808", math.MinInt64, false},
+		{"clock overflow by one", DurationFormat{Syntax: ClockDurationSyntax}, "2562047:47:16.854775808", 0, true},
+		{"clock huge hours", DurationFormat{Syntax: ClockDurationSyntax}, "99999999999999999999:00:00", 0, true},
+		{"clock minutes out of range", DurationFormat{Syntax: ClockDurationSyntax}, "01:60:00", 0, true},
+		{"clock missing seconds", DurationFormat{Syntax: ClockDurationSyntax}, "01:30", 0, true},
+		{"iso", DurationFormat{Syntax: ISO8601DurationSyntax}, "PT5M", 5 * time.Minute, false},
+		{"iso days and fraction", DurationFormat{Syntax: ISO8601DurationSyntax}, "P1DT2H30.5S", 26*time.Hour + 30500*time.Millisecond, false},
+		{"iso weeks", DurationFormat{Syntax: ISO8601DurationSyntax}, "P2W", 14 * 24 * time.Hour, false},
+		{"iso decimal comma", DurationFormat{Syntax: ISO8601DurationSyntax}, "PT0,25H", 15 * time.Minute, false},
+		{"iso fractional week", DurationFormat{Syntax: ISO8601DurationSyntax}, "P0.000000000000000001W", 0, false},
+		{"iso negative", DurationFormat{Syntax: ISO8601DurationSyntax}, "-PT1S", -time.Second, false},
+		{"iso empty", DurationFormat{Syntax: ISO8601DurationSyntax}, "P", 0, true},
+		{"iso trailing T", DurationFormat{Syntax: ISO8601DurationSyntax}, "P1DT", 0, true},
+		{"iso years", DurationFormat{Syntax: ISO8601DurationSyntax}, "P1Y", 0, true},
+		{"iso overflow", DurationFormat{Syntax: ISO8601DurationSyntax}, "P20000W", 0, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.format.Parse(tt.in)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("Parse(%q) got error %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		format DurationFormat
+		in     time.Duration
+		want   string
+	}{
+		{"go", DurationFormat{}, 90 * time.Minute, "1h30m0s"},
+		{"go with unit", DurationFormat{GoUnitSuffix: "s"}, 1500 * time.Millisecond, "1.5"},
+		{"go whole units", DurationFormat{GoUnitSuffix: "ms"}, 3 * time.Second, "3000"},
+		{"clock", DurationFormat{Syntax: ClockDurationSyntax}, 90 * time.Minute, "01:30:00"},
+		{"clock fraction", DurationFormat{Syntax: ClockDurationSyntax}, -1500 * time.Millisecond, "-00:00:01.5"},
+		{"clock min", DurationFormat{Syntax: ClockDurationSyntax}, math.MinInt64, "-2562047:47:16.854775808"},
+		{"iso zero", DurationFormat{Syntax: ISO8601DurationSyntax}, 0, "PT0S"},
+		{"iso", DurationFormat{Syntax: ISO8601DurationSyntax}, 26*time.Hour + 30500*time.Millisecond, "PT26H30.5S"},
+		{"iso negative", DurationFormat{Syntax: ISO8601DurationSyntax}, -time.Second / 2, "-PT0.5S"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.format.Format(tt.in)
+			if err != nil {
+				t.Fatalf("Format(%v) got error %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Format(%v) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+	if _, err := (&DurationFormat{GoUnitSuffix: "parsec"}).Format(time.Second); err == nil {
+		t.Errorf("Format with an invalid unit got no error")
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	durations := []time.Duration{
+		0,
+		1,
+		-1,
+		time.Millisecond,
+		90 * time.Minute,
+		5000*time.Hour + 1,
+		-(5000*time.Hour + 1),
+		math.MaxInt64,
+		math.MinInt64,
+	}
+	for _, syntax := range []DurationSyntax{GoDurationSyntax, ClockDurationSyntax, ISO8601DurationSyntax} {
+		f := &DurationFormat{Syntax: syntax}
+		for _, d := range durations {
+			s, err := f.Format(d)
+			if err != nil {
+				t.Fatalf("syntax %d: Format(%v) got error %v", syntax, d, err)
+			}
+			got, err := f.Parse(s)
+			if err != nil {
+				t.Errorf("syntax %d: Parse(%q) got error %v", syntax, s, err)
+				continue
+			}
+			if got != d {
+				t.Errorf("syntax %d: Parse(Format(%v)) = %v via %q", syntax, d, got, s)
+			}
+		}
+	}
+}
@@ -64,3 +64,41 @@ func TestReader(t *testing.T) {
 		})
 	}
 }
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		csv  string
+	}{
+		{
+			"single line",
+			"name,age,height\nfred,40,3m\n",
+		},
+		{
+			"quoted values",
+			"name,age,height\n\"smith, fred\",40,\"3\"\"\"\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := converter.NewReader(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("NewReader error: %v", err)
+			}
+			recs, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll() error: %v", err)
+			}
+			out := &strings.Builder{}
+			w, err := converter.NewWriter(out)
+			if err != nil {
+				t.Fatalf("NewWriter error: %v", err)
+			}
+			if err := w.WriteAll(recs); err != nil {
+				t.Fatalf("WriteAll() error: %v", err)
+			}
+			if diff := cmp.Diff(tt.csv, out.String()); diff != "" {
+				t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter03_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/xtoproto/examples/example03/converter03"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/google/xtoproto/examples/example03"
+)
+
+// allTypesCSV has a value of every supported type in each row. It is written in the
+// canonical form of each column, so writing the parsed records reproduces it exactly.
+const allTypesCSV = `name,small_int,big_int,small_uint,big_uint,ratio,price,active,verified,color,created,timeout,elapsed,interval,latency_ms
+alpha,-7,-9000000000,7,18446744073709551615,0.5,"$1,234.5",true,Y,red,2020-10-04 13:30:00,1h30m0s,26:00:00.25,PT26H,150
+beta,0,0,0,0,-1.25,($12),false,N,,2020-02-26 00:00:00,-2s,-00:00:05,,1.5
+`
+
+func TestReader(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		csv  string
+		want []*pb.AllTypes
+	}{
+		{
+			"all types",
+			allTypesCSV,
+			[]*pb.AllTypes{
+				{
+					Name:      "alpha",
+					SmallInt:  -7,
+					BigInt:    -9000000000,
+					SmallUint: 7,
+					BigUint:   18446744073709551615,
+					Ratio:     0.5,
+					Price:     1234.5,
+					Active:    true,
+					Verified:  true,
+					Color:     pb.Color_COLOR_RED,
+					Created:   timestamppb.New(time.Date(2020, 10, 4, 13, 30, 0, 0, time.UTC)),
+					Timeout:   durationpb.New(90 * time.Minute),
+					Elapsed:   durationpb.New(26*time.Hour + 250*time.Millisecond),
+					Interval:  durationpb.New(26 * time.Hour),
+					LatencyMs: durationpb.New(150 * time.Millisecond),
+				},
+				{
+					Name:      "beta",
+					Ratio:     -1.25,
+					Price:     -12,
+					Created:   timestamppb.New(time.Date(2020, 2, 26, 0, 0, 0, 0, time.UTC)),
+					Timeout:   durationpb.New(-2 * time.Second),
+					Elapsed:   durationpb.New(-5 * time.Second),
+					LatencyMs: durationpb.New(1500 * time.Microsecond),
+				},
+			},
+		},
+		{
+			"alternative duration spellings",
+			`name,small_int,big_int,small_uint,big_uint,ratio,price,active,verified,color,created,timeout,elapsed,interval,latency_ms
+gamma,1,2,3,4,5,$6,true,y,green,2020-01-01 00:00:00,90m,1:02:03,P1W,0.25
+`,
+			[]*pb.AllTypes{
+				{
+					Name:      "gamma",
+					SmallInt:  1,
+					BigInt:    2,
+					SmallUint: 3,
+					BigUint:   4,
+					Ratio:     5,
+					Price:     6,
+					Active:    true,
+					Verified:  true,
+					Color:     pb.Color_COLOR_GREEN,
+					Created:   timestamppb.New(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+					Timeout:   durationpb.New(90 * time.Minute),
+					Elapsed:   durationpb.New(time.Hour + 2*time.Minute + 3*time.Second),
+					Interval:  durationpb.New(7 * 24 * time.Hour),
+					LatencyMs: durationpb.New(250 * time.Microsecond),
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := converter03.NewReader(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("NewReader error: %v", err)
+			}
+			got, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll() error: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	r, err := converter03.NewReader(strings.NewReader(allTypesCSV))
+	if err != nil {
+		t.Fatalf("NewReader error: %v", err)
+	}
+	recs, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("ReadAll() error: %v", err)
+	}
+	out := &strings.Builder{}
+	w, err := converter03.NewWriter(out)
+	if err != nil {
+		t.Fatalf("NewWriter error: %v", err)
+	}
+	if err := w.WriteAll(recs); err != nil {
+		t.Fatalf("WriteAll() error: %v", err)
+	}
+	if diff := cmp.Diff(allTypesCSV, out.String()); diff != "" {
+		t.Errorf("unexpected diff (-want, +got):\n%s", diff)
+	}
+}
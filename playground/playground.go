@@ -55,7 +55,9 @@ f,x`,
 	}
 
 	readFile service.FileReaderFunc = func(_ context.Context, path string) ([]byte, error) {
-		return nil, fmt.Errorf("reading files not supported on web (%q)", path)
+		// Reporting that the file does not exist lets code generation create new BUILD
+		// files.
+		return nil, fmt.Errorf("reading files not supported on web (%q): %w", path, os.ErrNotExist)
 	}
 	writeFile service.FileWriterFunc = func(_ context.Context, path string, data []byte) error {
 		// writing files not supported on web
@@ -147,6 +149,11 @@ func handleJSRequest(s spb.XToProtoServiceServer, req *jsRequest) *jsResponse {
 	}
 
 	req2.Mapping = resp1.BestMappingCandidate.GetTopLevelMapping()
+	req2.AdditionalMappings = resp1.BestMappingCandidate.GetAdditionalMappings()
+	if req1.GetInputFormat() == spb.Format_XML {
+		// Generated converters parse CSV records.
+		req2.Converter = nil
+	}
 	resp2, err := s.GenerateCode(ctx, req2)
 	if err != nil {
 		return &jsResponse{
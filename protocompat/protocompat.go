@@ -0,0 +1,347 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protocompat reports changes between two versions of protocol buffer definitions
+// that break readers of data written with the old version.
+//
+// The definitions may be compared as .proto files or as RecordProtoMappings, which are
+// compared using the .proto files generated from them.
+package protocompat
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/xtoproto/csvtoproto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+// Kind identifies a kind of incompatible change.
+type Kind string
+
+// Kinds of incompatible changes.
+const (
+	// TagReused is reported when a field uses a number or name that the old message
+	// reserved, or the number of a removed field that was not reserved.
+	TagReused Kind = "TAG_REUSED"
+	// FieldNumberChanged is reported when a field of the old message has a different
+	// number in the new message.
+	FieldNumberChanged Kind = "FIELD_NUMBER_CHANGED"
+	// IncompatibleTypeChange is reported when the new type of a field decodes values of the
+	// old type differently, such as int64 changed to string.
+	IncompatibleTypeChange Kind = "INCOMPATIBLE_TYPE_CHANGE"
+	// JSONNameChanged is reported when a renamed field has a different JSON name.
+	JSONNameChanged Kind = "JSON_NAME_CHANGED"
+	// FieldRemovedWithoutReservation is reported once when a field is removed and its
+	// number, name or both are not reserved.
+	FieldRemovedWithoutReservation Kind = "FIELD_REMOVED_WITHOUT_RESERVATION"
+	// EnumValueChanged is reported when an enum value is renamed, renumbered or removed
+	// without reserving its number.
+	EnumValueChanged Kind = "ENUM_VALUE_CHANGED"
+	// TypeRemoved is reported when a message or enum of the old file is missing from the
+	// new file.
+	TypeRemoved Kind = "TYPE_REMOVED"
+)
+
+// Problem is an incompatible change.
+type Problem struct {
+	Kind Kind `json:"kind"`
+	// Element is the full name of the changed field, enum value, message or enum, such as
+	// "mypackage.MyMessage.my_field". It is the name in the new definitions for reused
+	// numbers and names, and in the old definitions otherwise.
+	Element string `json:"element"`
+	// Description is a human-readable description of the change.
+	Description string `json:"description"`
+}
+
+// String returns the problem in the form "KIND element: description".
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Element, p.Description)
+}
+
+// CompareMappings returns the incompatible changes between the .proto files generated from
+// two mappings.
+func CompareMappings(oldMapping, newMapping *pb.RecordProtoMapping) ([]*Problem, error) {
+	oldFile, err := mappingFile(oldMapping)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling old mapping: %w", err)
+	}
+	newFile, err := mappingFile(newMapping)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling new mapping: %w", err)
+	}
+	return CompareFiles(oldFile, newFile), nil
+}
+
+// mappingFile returns the descriptor of the .proto file generated from a mapping.
+func mappingFile(mapping *pb.RecordProtoMapping) (protoreflect.FileDescriptor, error) {
+	const protoFileName = "mapping.proto"
+	protoCode, _, err := csvtoproto.GenerateCode(mapping, true, false)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProtoFile(protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{protoFileName: protoCode}),
+	}, protoFileName)
+}
+
+// ParseProtoFile parses a .proto file and returns its descriptor. The well-known types
+// of google/protobuf may be imported without adding them to the parser's import paths.
+func ParseProtoFile(parser protoparse.Parser, fileName string) (protoreflect.FileDescriptor, error) {
+	fds, err := parser.ParseFiles(fileName)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if seen[fd.GetName()] {
+			return
+		}
+		seen[fd.GetName()] = true
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+		set.File = append(set.File, fd.AsFileDescriptorProto())
+	}
+	add(fds[0])
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, err
+	}
+	return files.FindFileByPath(fds[0].GetName())
+}
+
+// CompareFiles returns the incompatible changes between the messages and enums of two
+// .proto files, including nested ones. Messages and enums are matched by full name.
+func CompareFiles(oldFile, newFile protoreflect.FileDescriptor) []*Problem {
+	oldMessages, oldEnums := map[protoreflect.FullName]protoreflect.MessageDescriptor{}, map[protoreflect.FullName]protoreflect.EnumDescriptor{}
+	newMessages, newEnums := map[protoreflect.FullName]protoreflect.MessageDescriptor{}, map[protoreflect.FullName]protoreflect.EnumDescriptor{}
+	collectTypes(oldFile.Messages(), oldFile.Enums(), oldMessages, oldEnums)
+	collectTypes(newFile.Messages(), newFile.Enums(), newMessages, newEnums)
+
+	var messageNames, enumNames []protoreflect.FullName
+	for name := range oldMessages {
+		messageNames = append(messageNames, name)
+	}
+	for name := range oldEnums {
+		enumNames = append(enumNames, name)
+	}
+
+	var problems []*Problem
+	for _, name := range sortNames(messageNames) {
+		newMsg, ok := newMessages[name]
+		if !ok {
+			problems = append(problems, &Problem{TypeRemoved, string(name), "message was removed"})
+			continue
+		}
+		problems = append(problems, CompareMessages(oldMessages[name], newMsg)...)
+	}
+	for _, name := range sortNames(enumNames) {
+		newEnum, ok := newEnums[name]
+		if !ok {
+			problems = append(problems, &Problem{TypeRemoved, string(name), "enum was removed"})
+			continue
+		}
+		problems = append(problems, CompareEnums(oldEnums[name], newEnum)...)
+	}
+	return problems
+}
+
+func collectTypes(msgs protoreflect.MessageDescriptors, enums protoreflect.EnumDescriptors, msgsOut map[protoreflect.FullName]protoreflect.MessageDescriptor, enumsOut map[protoreflect.FullName]protoreflect.EnumDescriptor) {
+	for i := 0; i < enums.Len(); i++ {
+		enumsOut[enums.Get(i).FullName()] = enums.Get(i)
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		m := msgs.Get(i)
+		if m.IsMapEntry() {
+			continue
+		}
+		msgsOut[m.FullName()] = m
+		collectTypes(m.Messages(), m.Enums(), msgsOut, enumsOut)
+	}
+}
+
+func sortNames(names []protoreflect.FullName) []protoreflect.FullName {
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// CompareMessages returns the incompatible changes between the fields of two versions of
+// a message. Nested messages and enums are not compared.
+func CompareMessages(oldMsg, newMsg protoreflect.MessageDescriptor) []*Problem {
+	var problems []*Problem
+	report := func(kind Kind, element protoreflect.FullName, format string, args ...interface{}) {
+		problems = append(problems, &Problem{kind, string(element), fmt.Sprintf(format, args...)})
+	}
+	oldFields, newFields := oldMsg.Fields(), newMsg.Fields()
+	for i := 0; i < oldFields.Len(); i++ {
+		oldField := oldFields.Get(i)
+		newField := newFields.ByNumber(oldField.Number())
+		if moved := newFields.ByName(oldField.Name()); moved != nil && moved.Number() != oldField.Number() {
+			report(FieldNumberChanged, oldField.FullName(), "field number changed from %d to %d", oldField.Number(), moved.Number())
+		}
+		nameRemoved := newFields.ByName(oldField.Name()) == nil && !newMsg.ReservedNames().Has(oldField.Name())
+		if newField == nil {
+			numberRemoved := !newMsg.ReservedRanges().Has(oldField.Number())
+			switch {
+			case numberRemoved && nameRemoved:
+				report(FieldRemovedWithoutReservation, oldField.FullName(), "field %d was removed without reserving its number or name", oldField.Number())
+			case numberRemoved:
+				report(FieldRemovedWithoutReservation, oldField.FullName(), "field %d was removed without reserving its number", oldField.Number())
+			case nameRemoved:
+				report(FieldRemovedWithoutReservation, oldField.FullName(), "field %d was removed without reserving its name", oldField.Number())
+			}
+			continue
+		}
+		// A field with a different name is a renamed field, unless the old field moved to
+		// another number or the new field is another field of the old message. Then the old
+		// field was removed and its number reused.
+		if newField.Name() != oldField.Name() && (newFields.ByName(oldField.Name()) != nil || oldFields.ByName(newField.Name()) != nil) {
+			report(TagReused, newField.FullName(), "field uses number %d of removed field %s, which was not reserved", oldField.Number(), oldField.Name())
+			if nameRemoved {
+				report(FieldRemovedWithoutReservation, oldField.FullName(), "field %d was removed without reserving its name", oldField.Number())
+			}
+			continue
+		}
+		if !typesCompatible(oldField, newField) {
+			report(IncompatibleTypeChange, oldField.FullName(), "field %d changed from %s to %s", oldField.Number(), fieldTypeName(oldField), fieldTypeName(newField))
+		}
+		if oldField.Name() != newField.Name() && oldField.JSONName() != newField.JSONName() {
+			report(JSONNameChanged, oldField.FullName(), "field %d was renamed to %s, changing its JSON name from %q to %q", oldField.Number(), newField.Name(), oldField.JSONName(), newField.JSONName())
+		}
+	}
+	for i := 0; i < newFields.Len(); i++ {
+		newField := newFields.Get(i)
+		if oldMsg.ReservedRanges().Has(newField.Number()) {
+			report(TagReused, newField.FullName(), "field uses number %d, which was reserved", newField.Number())
+		}
+		if oldMsg.ReservedNames().Has(newField.Name()) {
+			report(TagReused, newField.FullName(), "field uses name %s, which was reserved", newField.Name())
+		}
+	}
+	return problems
+}
+
+// CompareEnums returns the incompatible changes between the values of two versions of an
+// enum. Enum values are serialized as numbers in the binary format and as names in JSON,
+// so both must stay the same.
+func CompareEnums(oldEnum, newEnum protoreflect.EnumDescriptor) []*Problem {
+	var problems []*Problem
+	report := func(element protoreflect.FullName, format string, args ...interface{}) {
+		problems = append(problems, &Problem{EnumValueChanged, string(element), fmt.Sprintf(format, args...)})
+	}
+	oldValues, newValues := oldEnum.Values(), newEnum.Values()
+	for i := 0; i < oldValues.Len(); i++ {
+		oldValue := oldValues.Get(i)
+		if moved := newValues.ByName(oldValue.Name()); moved != nil && moved.Number() != oldValue.Number() {
+			report(oldValue.FullName(), "enum value number changed from %d to %d", oldValue.Number(), moved.Number())
+		}
+		newValue := newValues.ByNumber(oldValue.Number())
+		switch {
+		case newValue == nil && !newEnum.ReservedRanges().Has(oldValue.Number()):
+			report(oldValue.FullName(), "enum value %d was removed without reserving its number", oldValue.Number())
+		case newValue != nil && newValue.Name() != oldValue.Name() && newValues.ByName(oldValue.Name()) == nil:
+			report(oldValue.FullName(), "enum value %d was renamed to %s", oldValue.Number(), newValue.Name())
+		}
+	}
+	for i := 0; i < newValues.Len(); i++ {
+		newValue := newValues.Get(i)
+		if oldEnum.ReservedRanges().Has(newValue.Number()) {
+			report(newValue.FullName(), "enum value uses number %d, which was reserved", newValue.Number())
+		}
+		if oldEnum.ReservedNames().Has(newValue.Name()) {
+			report(newValue.FullName(), "enum value uses name %s, which was reserved", newValue.Name())
+		}
+	}
+	return problems
+}
+
+// wireCompatibleKinds lists groups of field kinds whose values can be decoded as any other
+// kind of the same group. See
+// https://developers.google.com/protocol-buffers/docs/proto3#updating.
+var wireCompatibleKinds = [][]protoreflect.Kind{
+	{protoreflect.Int32Kind, protoreflect.Uint32Kind, protoreflect.Int64Kind, protoreflect.Uint64Kind, protoreflect.BoolKind, protoreflect.EnumKind},
+	{protoreflect.Sint32Kind, protoreflect.Sint64Kind},
+	{protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind},
+	{protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind},
+	{protoreflect.StringKind, protoreflect.BytesKind},
+}
+
+// typesCompatible reports whether values of the old field can be decoded as the new field.
+func typesCompatible(oldField, newField protoreflect.FieldDescriptor) bool {
+	if oldField.IsMap() != newField.IsMap() {
+		return false
+	}
+	if oldField.IsMap() {
+		return typesCompatible(oldField.MapKey(), newField.MapKey()) && typesCompatible(oldField.MapValue(), newField.MapValue())
+	}
+	oldKind, newKind := oldField.Kind(), newField.Kind()
+	if oldField.IsList() != newField.IsList() && !isLengthDelimited(oldKind) {
+		return false
+	}
+	switch {
+	case oldKind == protoreflect.MessageKind || oldKind == protoreflect.GroupKind:
+		return newKind == oldKind && oldField.Message().FullName() == newField.Message().FullName()
+	case oldKind == newKind:
+		return true
+	}
+	for _, group := range wireCompatibleKinds {
+		if containsKind(group, oldKind) && containsKind(group, newKind) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLengthDelimited reports whether values of a kind are encoded the same way in singular
+// and repeated fields.
+func isLengthDelimited(kind protoreflect.Kind) bool {
+	return kind == protoreflect.StringKind || kind == protoreflect.BytesKind || kind == protoreflect.MessageKind
+}
+
+func containsKind(kinds []protoreflect.Kind, kind protoreflect.Kind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldTypeName returns the type of a field as written in a .proto file, such as "int64",
+// "repeated string" or "google.protobuf.Timestamp".
+func fieldTypeName(field protoreflect.FieldDescriptor) string {
+	if field.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldTypeName(field.MapKey()), fieldTypeName(field.MapValue()))
+	}
+	name := field.Kind().String()
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		name = string(field.Message().FullName())
+	case protoreflect.EnumKind:
+		name = string(field.Enum().FullName())
+	}
+	if field.IsList() {
+		return "repeated " + name
+	}
+	return name
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocompat
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+func mustParse(t *testing.T, protoCode string) protoreflect.FileDescriptor {
+	t.Helper()
+	fd, err := ParseProtoFile(protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{"test.proto": protoCode}),
+	}, "test.proto")
+	if err != nil {
+		t.Fatalf("error parsing .proto file: %v\n%s", err, protoCode)
+	}
+	return fd
+}
+
+func TestCompareFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		want     []*Problem
+	}{
+		{
+			name: "compatible changes",
+			old: `syntax = "proto3";
+package p;
+import "google/protobuf/timestamp.proto";
+enum Color { COLOR_UNSPECIFIED = 0; COLOR_RED = 1; COLOR_BLUE = 2; }
+message M {
+  int32 a = 1;
+  string b = 2;
+  Color c = 3;
+  google.protobuf.Timestamp d = 4;
+  sint32 e = 5;
+  double gone = 6;
+}`,
+			new: `syntax = "proto3";
+package p;
+import "google/protobuf/timestamp.proto";
+enum Color { COLOR_UNSPECIFIED = 0; COLOR_RED = 1; reserved 2; COLOR_GREEN = 3; }
+message M {
+  reserved 6;
+  reserved "gone";
+  int64 a = 1;
+  bytes b = 2;
+  int32 c = 3;
+  google.protobuf.Timestamp d = 4;
+  sint64 e = 5;
+  string new_field = 7;
+}`,
+		},
+		{
+			name: "incompatible changes",
+			old: `syntax = "proto3";
+package p;
+enum Color { COLOR_UNSPECIFIED = 0; COLOR_RED = 1; COLOR_BLUE = 2; COLOR_GREEN = 3; }
+message M {
+  reserved 9;
+  reserved "old";
+  int64 id = 1;
+  string name = 2;
+  float score = 3;
+  string zip_code = 4;
+  Color color = 5;
+}`,
+			new: `syntax = "proto3";
+package p;
+enum Color { COLOR_UNSPECIFIED = 0; COLOR_RED = 2; COLOR_GREEN = 3; }
+message M {
+  string id = 1;
+  string name = 4;
+  double score = 3;
+  string zip = 6;
+  Color color = 5;
+  bool old = 9;
+}`,
+			want: []*Problem{
+				{IncompatibleTypeChange, "p.M.id", "field 1 changed from int64 to string"},
+				{FieldNumberChanged, "p.M.name", "field number changed from 2 to 4"},
+				{FieldRemovedWithoutReservation, "p.M.name", "field 2 was removed without reserving its number"},
+				{IncompatibleTypeChange, "p.M.score", "field 3 changed from float to double"},
+				{TagReused, "p.M.name", "field uses number 4 of removed field zip_code, which was not reserved"},
+				{FieldRemovedWithoutReservation, "p.M.zip_code", "field 4 was removed without reserving its name"},
+				{TagReused, "p.M.old", "field uses number 9, which was reserved"},
+				{TagReused, "p.M.old", "field uses name old, which was reserved"},
+				{EnumValueChanged, "p.COLOR_RED", "enum value number changed from 1 to 2"},
+				{EnumValueChanged, "p.COLOR_RED", "enum value 1 was removed without reserving its number"},
+				{EnumValueChanged, "p.COLOR_BLUE", "enum value 2 was renamed to COLOR_RED"},
+			},
+		},
+		{
+			name: "removed and renamed fields",
+			old: `syntax = "proto3";
+package p;
+message M {
+  int64 id = 1;
+  string zip_code = 2;
+  string city = 3;
+  string note = 4;
+  int32 count = 5;
+}`,
+			new: `syntax = "proto3";
+package p;
+message M {
+  reserved 4;
+  int64 id = 1;
+  string postal_code = 2;
+  int32 count = 6;
+  string total = 5;
+}`,
+			want: []*Problem{
+				{JSONNameChanged, "p.M.zip_code", `field 2 was renamed to postal_code, changing its JSON name from "zipCode" to "postalCode"`},
+				{FieldRemovedWithoutReservation, "p.M.city", "field 3 was removed without reserving its number or name"},
+				{FieldRemovedWithoutReservation, "p.M.note", "field 4 was removed without reserving its name"},
+				{FieldNumberChanged, "p.M.count", "field number changed from 5 to 6"},
+				{TagReused, "p.M.total", "field uses number 5 of removed field count, which was not reserved"},
+			},
+		},
+		{
+			name: "removed types",
+			old: `syntax = "proto3";
+package p;
+message M { message Nested { int32 x = 1; } Nested n = 1; }
+enum E { E_UNSPECIFIED = 0; }`,
+			new: `syntax = "proto3";
+package p;
+message M { reserved 1; reserved "n"; }`,
+			want: []*Problem{
+				{TypeRemoved, "p.M.Nested", "message was removed"},
+				{TypeRemoved, "p.E", "enum was removed"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CompareFiles(mustParse(t, tc.old), mustParse(t, tc.new))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("CompareFiles() unexpected problems (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCompareMappings(t *testing.T) {
+	oldMapping := &pb.RecordProtoMapping{
+		PackageName: "mypackage",
+		MessageName: "Order",
+		ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+			{ColName: "id", ProtoName: "id", ProtoType: "int64", ProtoTag: 1},
+			{ColName: "placed_at", ProtoName: "placed_at", ProtoType: "google.protobuf.Timestamp", ProtoTag: 2},
+			{ColName: "total", ProtoName: "total", ProtoType: "double", ProtoTag: 3},
+		},
+	}
+	newMapping := &pb.RecordProtoMapping{
+		PackageName: "mypackage",
+		MessageName: "Order",
+		ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+			{ColName: "id", ProtoName: "id", ProtoType: "string", ProtoTag: 1},
+			{ColName: "placed_at", ProtoName: "placed_at", ProtoType: "google.protobuf.Timestamp", ProtoTag: 2},
+		},
+		ReservedTags: []int32{3},
+	}
+	want := []*Problem{
+		{IncompatibleTypeChange, "mypackage.Order.id", "field 1 changed from int64 to string"},
+		{FieldRemovedWithoutReservation, "mypackage.Order.total", "field 3 was removed without reserving its name"},
+	}
+	got, err := CompareMappings(oldMapping, newMapping)
+	if err != nil {
+		t.Fatalf("CompareMappings() error: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CompareMappings() unexpected problems (-want, +got):\n%s", diff)
+	}
+}
@@ -19,8 +19,8 @@ package recordinfer
 
 import (
 	"fmt"
+	"math/rand"
 	"regexp"
-	"sort"
 	"strings"
 	"time"
 
@@ -38,15 +38,48 @@ type InferredProto struct {
 	messageName string
 	columns     []*inferredColumn
 	goOpts      *pb.GoOptions
+	csvDialect  *pb.CsvDialect
+}
+
+// Confidence returns a score in [0, 1] indicating how likely the inferred mapping is correct.
+// It is the mean of the confidence of each column.
+func (ip *InferredProto) Confidence() float64 {
+	if len(ip.columns) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, col := range ip.columns {
+		total += col.candidate.confidence()
+	}
+	return total / float64(len(ip.columns))
+}
+
+// ColumnInferences returns an explanation of the type chosen for each column.
+func (ip *InferredProto) ColumnInferences() []*ColumnInference {
+	var out []*ColumnInference
+	for _, col := range ip.columns {
+		out = append(out, &ColumnInference{
+			ColumnIndex: col.tag - 1,
+			ColumnName:  col.csvColumnName,
+			ProtoType:   col.columnType.protoType(),
+			Confidence:  col.candidate.confidence(),
+			Reasons:     col.candidate.reasons,
+		})
+	}
+	return out
 }
 
 // Code returns the source for a .proto file.
 func (ip *InferredProto) Code() string {
 	var imports []string
 	body := ""
+	enums := ""
 	for _, col := range ip.columns {
 		body += fmt.Sprintf("%s\n", col.protoFieldCode())
 		imports = append(imports, col.columnType.protoImports()...)
+		if et, ok := col.columnType.(*enumColumnType); ok {
+			enums += fmt.Sprintf("%s\n\n", et.protoEnumCode())
+		}
 	}
 
 	return fmt.Sprintf(`syntax = "proto3";
@@ -55,9 +88,9 @@ package %s;
 
 %s
 
-message %s {
+%smessage %s {
 %s
-}`, ip.packageName, strings.Join(imports, "\n"), ip.messageName, body)
+}`, ip.packageName, strings.Join(imports, "\n"), enums, ip.messageName, body)
 }
 
 // Mapping returns a protobuf representation of the inferred mapping between Record and proto.
@@ -67,6 +100,7 @@ func (ip *InferredProto) Mapping() *pb.RecordProtoMapping {
 		PackageName: ip.packageName,
 		MessageName: ip.messageName,
 		GoOptions:   ip.goOpts,
+		CsvDialect:  ip.csvDialect,
 	}
 	for _, col := range ip.columns {
 		fieldMapping := &pb.ColumnToFieldMapping{
@@ -77,9 +111,13 @@ func (ip *InferredProto) Mapping() *pb.RecordProtoMapping {
 			ProtoName:    col.fieldName,
 			ProtoTag:     int32(col.tag),
 			Comment:      col.comment,
+			NullValues:   col.nullValues,
 		}
 		col.columnType.updateMapping(fieldMapping)
 		m.ColumnToFieldMappings = append(m.ColumnToFieldMappings, fieldMapping)
+		if et, ok := col.columnType.(*enumColumnType); ok {
+			m.EnumDefinitions = append(m.EnumDefinitions, et.def)
+		}
 	}
 	return m
 }
@@ -99,29 +137,99 @@ func (ip *InferredProto) FormattedMapping(template *pb.RecordProtoMapping) strin
 }
 
 // RecordBasedInferrer provides a builder interface to an InferredProto.
+//
+// The first row added is the header row. Each subsequent row incrementally updates the
+// per-column state used for inference, so memory use is bounded by the number of columns
+// rather than the number of rows, unless Options.SampleSize is set.
 type RecordBasedInferrer struct {
-	rows [][]string
-	opts *Options
+	opts    *Options
+	header  []string
+	columns []*columnState
+	// rowCount is the number of data rows added, not counting the header or rows beyond
+	// Options.MaxRows.
+	rowCount int
+	// sample is a uniform random sample of the data rows when Options.SampleSize is set.
+	sample [][]string
+	rng    *rand.Rand
 }
 
 // AddRow appends a row to the builder's set of rows. Returns an error if the number of columns in the new row does not
-// match the number of columns in the first row added.
+// match the number of columns in the first row added. Rows added after Options.MaxRows rows are ignored.
 func (b *RecordBasedInferrer) AddRow(row []string) error {
-	if (len(b.rows) > 0) && (len(row) != len(b.rows[0])) {
-		return fmt.Errorf("invalid row length; expected %d got %d for row %s", len(b.rows[0]), len(row), row)
+	if b.header == nil {
+		b.header = append([]string{}, row...)
+		for _, name := range b.header {
+			b.columns = append(b.columns, newColumnState(name, b.opts))
+		}
+		return nil
 	}
+	if len(row) != len(b.header) {
+		return fmt.Errorf("invalid row length; expected %d got %d for row %s", len(b.header), len(row), row)
+	}
+	if b.Done() {
+		return nil
+	}
+	b.rowCount++
+
+	if size := b.opts.SampleSize; size > 0 {
+		// Reservoir sampling; see Vitter, "Random sampling with a reservoir."
+		if len(b.sample) < size {
+			b.sample = append(b.sample, append([]string{}, row...))
+		} else if i := b.rng.Intn(b.rowCount); i < size {
+			b.sample[i] = append([]string{}, row...)
+		}
+		return nil
+	}
+	for i, value := range row {
+		b.columns[i].add(value)
+	}
+	return nil
+}
 
-	b.rows = append(b.rows, row)
+// Done reports whether the inferrer has received Options.MaxRows data rows. Callers that read
+// rows from a stream may stop reading once Done returns true.
+func (b *RecordBasedInferrer) Done() bool {
+	return b.opts.MaxRows > 0 && b.rowCount >= b.opts.MaxRows
+}
 
-	return nil
+// columnStates returns the state of each column based on the rows added so far.
+func (b *RecordBasedInferrer) columnStates() []*columnState {
+	if b.opts.SampleSize <= 0 {
+		return b.columns
+	}
+	var states []*columnState
+	for _, name := range b.header {
+		states = append(states, newColumnState(name, b.opts))
+	}
+	for _, row := range b.sample {
+		for i, value := range row {
+			states[i].add(value)
+		}
+	}
+	return states
 }
 
 // Build constructs an InferredProto using the builder's internal data.
 func (b *RecordBasedInferrer) Build() (*InferredProto, error) {
-	if len(b.rows) < 2 {
-		return nil, fmt.Errorf("not enough rows to infer types: %d", len(b.rows))
+	candidates, err := b.BuildCandidates(1)
+	if err != nil {
+		return nil, err
 	}
-	numCols := len(b.rows[0])
+	return candidates[0], nil
+}
+
+// BuildCandidates is like Build but returns up to n alternative InferredProtos, ordered from
+// most to least likely. Each column's type is scored based on the share of values that parse
+// as the type, the specificity of the type, and hints in the column name (like "id" or
+// "_at"). The first candidate is the result of Build.
+func (b *RecordBasedInferrer) BuildCandidates(n int) ([]*InferredProto, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("must request at least one candidate, got %d", n)
+	}
+	if b.rowCount < 1 {
+		return nil, fmt.Errorf("not enough rows to infer types: got %d data rows", b.rowCount)
+	}
+	numCols := len(b.header)
 	if numCols == 0 {
 		return nil, fmt.Errorf("not enough columns to infer types: %d", numCols)
 	}
@@ -134,35 +242,52 @@ func (b *RecordBasedInferrer) Build() (*InferredProto, error) {
 		}
 	}
 
-	result := &InferredProto{
-		messageName: b.opts.MessageName,
-		packageName: b.opts.PackageName,
-		goOpts:      gOpts,
+	states := b.columnStates()
+	var columnCandidates [][]*columnCandidate
+	for _, cs := range states {
+		columnCandidates = append(columnCandidates, cs.candidates())
 	}
 
-	for i := 0; i < numCols; i++ {
-		cv := &columnValues{i, b.rows}
-		comment := cv.statisticalComment()
-		colType, err := cv.inferType(b.opts)
-		if err != nil {
-			return nil, err
+	var results []*InferredProto
+	for _, combination := range topCombinations(columnCandidates, n) {
+		result := &InferredProto{
+			messageName: b.opts.MessageName,
+			packageName: b.opts.PackageName,
+			goOpts:      gOpts,
+			csvDialect:  b.opts.CSVDialect,
 		}
-		result.columns = append(result.columns, &inferredColumn{
-			csvColumnName: cv.columnName(),
-			fieldName:     columnNameToFieldName(cv.columnName()),
-			columnType:    colType,
-			tag:           i + 1,
-			comment:       comment,
-		})
+		for i, cs := range states {
+			candidate := columnCandidates[i][combination[i]]
+			var nullValues []string
+			if _, isString := candidate.colType.(*stringColumnType); !isString {
+				// String columns can represent null sentinels as-is.
+				nullValues = cs.observedNullValues()
+			}
+			result.columns = append(result.columns, &inferredColumn{
+				csvColumnName: cs.columnName(),
+				fieldName:     columnNameToFieldName(cs.columnName()),
+				columnType:    candidate.colType,
+				tag:           i + 1,
+				comment:       cs.statisticalComment(b.rowCount),
+				nullValues:    nullValues,
+				candidate:     candidate,
+			})
+		}
+		results = append(results, result)
 	}
 
-	return result, nil
+	return results, nil
 }
 
-// NewRecordBasedInferrer creates a new RecordBasedInferrer.
+// NewRecordBasedInferrer creates a new RecordBasedInferrer. A nil opts is equivalent to an
+// empty Options.
 func NewRecordBasedInferrer(opts *Options) *RecordBasedInferrer {
+	if opts == nil {
+		opts = &Options{}
+	}
 	return &RecordBasedInferrer{
 		opts: opts,
+		rng:  rand.New(rand.NewSource(opts.SampleSeed)),
 	}
 }
 
@@ -172,6 +297,8 @@ type inferredColumn struct {
 	columnType    columnType
 	tag           int
 	comment       string
+	nullValues    []string
+	candidate     *columnCandidate
 }
 
 func (c *inferredColumn) protoFieldCode() string {
@@ -193,95 +320,56 @@ type Options struct {
 
 	// TimestampLocation is the time zone name used to parse timestamps that do not have an explicit timezone.
 	TimestampLocation *time.Location
-}
 
-type columnValues struct {
-	index int
-	rows  [][]string
+	// NullValues is the set of raw values that denote a missing value. Null values are ignored
+	// when inferring the type of a column, and the null values observed in a column are recorded
+	// in the output mapping. If nil, DefaultNullValues is used. Use an empty, non-nil slice to
+	// disable null detection.
+	NullValues []string
+
+	// TrueValues and FalseValues are the values recognized as true and false when inferring
+	// bool columns. Matching is case insensitive. If either is empty, it is filled with the
+	// values of DefaultTrueValues or DefaultFalseValues that are not in the other.
+	TrueValues, FalseValues []string
+
+	// NumberOptions controls the choice of integer and floating point proto types. If nil,
+	// DefaultNumberOptions is used.
+	NumberOptions *NumberOptions
+
+	// EnumOptions controls the inference of enums from low-cardinality string columns. If nil,
+	// no enums are inferred.
+	EnumOptions *EnumOptions
+
+	// MaxRows is the maximum number of data rows to inspect. Rows after the first MaxRows
+	// are ignored. If zero, all rows are inspected.
+	MaxRows int
+
+	// SampleSize, if positive, is the number of data rows to keep in a uniform random sample
+	// of the input. Types are inferred from the sample rather than from every row, which
+	// bounds the time spent inferring types of large inputs. SampleSeed seeds the random
+	// number generator used for sampling.
+	SampleSize int
+	SampleSeed int64
+
+	// CSVDialect is the syntax of the CSV file the records were read from. It is copied to
+	// the output mapping.
+	CSVDialect *pb.CsvDialect
 }
 
-func (cv *columnValues) columnName() string {
-	return cv.rows[0][cv.index]
-}
+// DefaultNullValues is the set of null sentinels used when Options.NullValues is nil.
+var DefaultNullValues = []string{"", "-", "NA", "N/A", "n/a", "NULL", "null"}
 
-func (cv *columnValues) rawValues() []string {
-	var values []string
-	for _, row := range cv.rows[1:] {
-		values = append(values, row[cv.index])
-	}
-	return values
-}
-
-const valuesToDisplayInStatisticalComment = 5
-
-// statisticalComment returns a human-readable description of the values of the column based
-// on the values inspected.
-func (cv *columnValues) statisticalComment() string {
-	counts := make(map[string]int)
-	rawValues := cv.rawValues()
-	for _, rv := range rawValues {
-		counts[rv]++
-	}
-	var keys []string
-	for k := range counts {
-		keys = append(keys, k)
+func (o *Options) isNullValue(value string) bool {
+	nullValues := o.NullValues
+	if nullValues == nil {
+		nullValues = DefaultNullValues
 	}
-	sort.Slice(keys, func(i, j int) bool {
-		ki, kj := keys[i], keys[j]
-		ci, cj := counts[ki], counts[kj]
-		if ci > cj {
+	for _, nv := range nullValues {
+		if value == nv {
 			return true
 		}
-		if ci < cj {
-			return false
-		}
-		// For stability, sort by string if frequency is the same.
-		return ki < kj
-	})
-	dispKeys := keys
-	if len(dispKeys) > valuesToDisplayInStatisticalComment {
-		dispKeys = dispKeys[0:valuesToDisplayInStatisticalComment]
-	}
-	for i, key := range dispKeys {
-		dispKeys[i] = fmt.Sprintf("%q (%d)", key, counts[key])
 	}
-	return fmt.Sprintf("Field type inferred from %d unique values in %d rows; %d most common: %s",
-		len(counts), len(rawValues), len(dispKeys), strings.Join(dispKeys, "; "))
-}
-
-func (cv *columnValues) inferType(opts *Options) (columnType, error) {
-	var inferrers []func(string) (columnType, error)
-	inferrers = append(inferrers, timeFormatInferrers(opts.TimestampLocation)...)
-	inferrers = append(inferrers, inferInt64Format, inferFloat32Format)
-	// TODO(reddaly): Improve this algorithm to work for more input Records,
-	// especially those with null values or those with ambiguous values.
-	for _, inferer := range inferrers {
-		var colType columnType
-		everyValueIsColType := true
-		for _, rawValue := range cv.rawValues() {
-			var err error
-			newColType, err := inferer(rawValue)
-			if err != nil {
-				return nil, err
-			}
-			if newColType == nil {
-				everyValueIsColType = false
-				break
-			}
-			if colType == nil {
-				colType = newColType
-				continue
-			}
-			if !columnTypesEqual(colType, newColType) {
-				everyValueIsColType = false
-				break
-			}
-		}
-		if colType != nil && everyValueIsColType {
-			return colType, nil
-		}
-	}
-	return &stringColumnType{}, nil
+	return false
 }
 
 type columnType interface {
@@ -290,9 +378,19 @@ type columnType interface {
 	updateMapping(mapping *pb.ColumnToFieldMapping)
 }
 
-// columnTypesEqual reports if two columnTypes are equivalent.
+// columnTypesEqual reports if two columnTypes are equivalent: they have the same proto type
+// and parsing information.
 func columnTypesEqual(a, b columnType) bool {
-	return a.protoType() == b.protoType()
+	if a == b {
+		return true
+	}
+	if a.protoType() != b.protoType() {
+		return false
+	}
+	ma, mb := &pb.ColumnToFieldMapping{}, &pb.ColumnToFieldMapping{}
+	a.updateMapping(ma)
+	b.updateMapping(mb)
+	return proto.Equal(ma, mb)
 }
 
 var (
@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"strings"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+var (
+	// DefaultTrueValues are the values recognized as true when Options.TrueValues is
+	// empty.
+	DefaultTrueValues = []string{"true", "t", "yes", "y", "on"}
+
+	// DefaultFalseValues are the values recognized as false when Options.FalseValues is
+	// empty.
+	DefaultFalseValues = []string{"false", "f", "no", "n", "off"}
+)
+
+type boolColumnType struct {
+	trueValues, falseValues []string
+}
+
+func (t *boolColumnType) protoType() string {
+	return "bool"
+}
+
+func (t *boolColumnType) protoImports() []string {
+	return nil
+}
+
+func (t *boolColumnType) updateMapping(mapping *pb.ColumnToFieldMapping) {
+	mapping.ParsingInfo = &pb.ColumnToFieldMapping_BoolFormat{
+		BoolFormat: &pb.BoolFormat{
+			TrueValues:  t.trueValues,
+			FalseValues: t.falseValues,
+		},
+	}
+}
+
+func (t *boolColumnType) asInferrerFunc() func(string) (columnType, error) {
+	return func(value string) (columnType, error) {
+		if containsFold(t.trueValues, value) || containsFold(t.falseValues, value) {
+			return t, nil
+		}
+		return nil, nil
+	}
+}
+
+// boolFormatInferrer returns an inferrer for bool columns. An empty side of the vocabulary
+// of opts is filled from the defaults, leaving out values of the other side, so that
+// inferred bool formats always have at least one true value and one false value.
+func boolFormatInferrer(opts *Options) func(string) (columnType, error) {
+	t := &boolColumnType{opts.TrueValues, opts.FalseValues}
+	if len(t.trueValues) == 0 {
+		t.trueValues = withoutFold(DefaultTrueValues, t.falseValues)
+	}
+	if len(t.falseValues) == 0 {
+		t.falseValues = withoutFold(DefaultFalseValues, t.trueValues)
+	}
+	if len(t.trueValues) == 0 || len(t.falseValues) == 0 {
+		return func(string) (columnType, error) { return nil, nil }
+	}
+	return t.asInferrerFunc()
+}
+
+// withoutFold returns the values that are not in excluded, ignoring case.
+func withoutFold(values, excluded []string) []string {
+	var out []string
+	for _, v := range values {
+		if !containsFold(excluded, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ColumnInference explains the type chosen for a column of an InferredProto.
+type ColumnInference struct {
+	// ColumnIndex is the 0-based index of the column.
+	ColumnIndex int
+	// ColumnName is the name of the column in the header row.
+	ColumnName string
+	// ProtoType is the proto type chosen for the column.
+	ProtoType string
+	// Confidence is a score in [0, 1] indicating how likely ProtoType is the right type.
+	Confidence float64
+	// Reasons are human-readable explanations of the score.
+	Reasons []string
+}
+
+// minCandidateParsedShare is the minimum fraction of non-null values a type must parse to
+// be considered as a candidate for a column.
+const minCandidateParsedShare = 0.8
+
+// Base scores of each kind of column type when all values parse. More specific types score
+// higher than more general types, so "1" is an int64 rather than a float or string.
+var kindSpecificity = map[string]float64{
+	"timestamp": 0.95,
+	"duration":  0.9,
+	"bool":      0.9,
+	"int":       0.85,
+	"float":     0.8,
+	"enum":      0.6,
+	"string":    0.3,
+}
+
+// formattedNumberMultiplier scales the score of numbers with a NumberFormat, so a column of
+// values like "1.234" is a plain float rather than an integer with "." separating groups of
+// digits.
+const formattedNumberMultiplier = 0.9
+
+// columnCandidate is a possible type for a column along with its score.
+type columnCandidate struct {
+	colType columnType
+	score   float64
+	reasons []string
+}
+
+func (c *columnCandidate) confidence() float64 {
+	if c.score > 1 {
+		return 1
+	}
+	return c.score
+}
+
+type columnNameHint struct {
+	pattern     *regexp.Regexp
+	description string
+	multipliers map[string]float64
+}
+
+var columnNameHints = []*columnNameHint{
+	{
+		regexp.MustCompile(`(^|_)(id|key|uuid|sku|ssn)($|_)`),
+		"an identifier",
+		map[string]float64{"timestamp": 0.5, "bool": 0.5, "float": 0.5, "enum": 0.5},
+	},
+	{
+		regexp.MustCompile(`(^|_)(zip|postal|postcode|phone|fax|code)($|_)`),
+		"a code that may have significant leading zeros",
+		map[string]float64{"string": 3, "timestamp": 0.5, "int": 0.5, "float": 0.5},
+	},
+	{
+		regexp.MustCompile(`(^|_)(at|on|date|time|timestamp|datetime|created|updated|modified)($|_)`),
+		"a time",
+		map[string]float64{"timestamp": 1.05},
+	},
+	{
+		regexp.MustCompile(`(^|_)(duration|elapsed|latency|timeout|ttl|delay|interval|uptime)($|_)`),
+		"a duration",
+		map[string]float64{"duration": 1.05},
+	},
+	{
+		regexp.MustCompile(`(^(is|has|can|should)_)|((^|_)(flag|enabled|active)($|_))`),
+		"a flag",
+		map[string]float64{"bool": 1.05, "enum": 0.9},
+	},
+}
+
+// candidateKind returns the key of the column type in kindSpecificity.
+func candidateKind(ct columnType) string {
+	switch t := ct.(type) {
+	case *timeColumnType:
+		return "timestamp"
+	case *durationColumnType:
+		return "duration"
+	case *boolColumnType:
+		return "bool"
+	case *numberColumnType:
+		if t.floatingPoint {
+			return "float"
+		}
+		return "int"
+	case *enumColumnType:
+		return "enum"
+	default:
+		return "string"
+	}
+}
+
+// describeColumnType returns a short human-readable description of a column type.
+func describeColumnType(ct columnType) string {
+	switch t := ct.(type) {
+	case *timeColumnType:
+		return fmt.Sprintf("%s with layout %q", t.protoType(), t.layout)
+	case *durationColumnType:
+		if t.unit != "" {
+			return fmt.Sprintf("%s in %s", t.protoType(), t.unit)
+		}
+		return fmt.Sprintf("%s with %s syntax", t.protoType(), t.syntax)
+	case *enumColumnType:
+		return fmt.Sprintf("enum %s with %d values", t.protoType(), len(t.def.GetValues()))
+	case *numberColumnType:
+		if f := t.numberFormat(); f != nil {
+			return fmt.Sprintf("%s with number format {%s}", t.protoType(), proto.CompactTextString(f))
+		}
+		return t.protoType()
+	default:
+		return ct.protoType()
+	}
+}
+
+// candidates returns the viable types of the column ordered from best to worst. Types that
+// fail to parse some values are ranked below string.
+func (cs *columnState) candidates() []*columnCandidate {
+	nonNull := cs.nonNullCount()
+	nullCount := cs.nullCount()
+	fieldName := columnNameToFieldName(cs.columnName())
+
+	newCandidate := func(ct columnType, parsed int, tieBreak float64) *columnCandidate {
+		kind := candidateKind(ct)
+		share := 1.0
+		if nonNull != 0 {
+			share = float64(parsed) / float64(nonNull)
+		}
+		c := &columnCandidate{
+			colType: ct,
+			score:   kindSpecificity[kind] - tieBreak,
+			reasons: []string{fmt.Sprintf("parsed %d of %d non-null values as %s", parsed, nonNull, describeColumnType(ct))},
+		}
+		if nt, ok := ct.(*numberColumnType); ok {
+			if nt.numberFormat() != nil {
+				c.score *= formattedNumberMultiplier
+			}
+			c.reasons = append(c.reasons, nt.reasons()...)
+		}
+		if share < 1 {
+			// A converter using this type would fail on some rows, so rank it below string.
+			c.score *= kindSpecificity["string"] * share * share
+			c.reasons = append(c.reasons, fmt.Sprintf("%d values would fail to parse", nonNull-parsed))
+		}
+		if nullCount != 0 && kind != "string" {
+			c.reasons = append(c.reasons, fmt.Sprintf("ignored %d null values", nullCount))
+		}
+		for _, hint := range columnNameHints {
+			if m, ok := hint.multipliers[kind]; ok && hint.pattern.MatchString(fieldName) {
+				c.score *= m
+				c.reasons = append(c.reasons, fmt.Sprintf("column name %q suggests %s (score x%.2f)", cs.columnName(), hint.description, m))
+			}
+		}
+		return c
+	}
+
+	var out []*columnCandidate
+	if nonNull != 0 {
+	inferrers:
+		for i, is := range cs.inferrers {
+			if !is.viable || is.colType == nil || float64(is.parsed)/float64(nonNull) < minCandidateParsedShare {
+				continue
+			}
+			for _, c := range out {
+				// Formatted number inferrers may produce the same type as the plain ones.
+				if columnTypesEqual(c.colType, is.colType) {
+					continue inferrers
+				}
+			}
+			// Prefer earlier inferrers when scores are otherwise equal.
+			out = append(out, newCandidate(is.colType, is.parsed, float64(i)*1e-6))
+		}
+		if enumType := cs.inferEnum(); enumType != nil {
+			out = append(out, newCandidate(enumType, nonNull, 0))
+		}
+	}
+	out = append(out, newCandidate(&stringColumnType{}, nonNull, 0))
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].score > out[j].score
+	})
+	return out
+}
+
+// topCombinations returns the indexes of up to n combinations of per-column candidates with
+// the highest total scores, best first. Each candidate list must be sorted by descending
+// score.
+func topCombinations(cands [][]*columnCandidate, n int) [][]int {
+	score := func(idx []int) float64 {
+		total := 0.0
+		for col, i := range idx {
+			total += cands[col][i].score
+		}
+		return total
+	}
+	h := &combinationHeap{}
+	first := make([]int, len(cands))
+	heap.Push(h, &combination{first, 0, score(first)})
+	var out [][]int
+	for h.Len() > 0 && len(out) < n {
+		c := heap.Pop(h).(*combination)
+		out = append(out, c.idx)
+		// Only increment columns at or after the last incremented column so each
+		// combination is generated exactly once.
+		for col := c.lastChanged; col < len(cands); col++ {
+			if c.idx[col]+1 >= len(cands[col]) {
+				continue
+			}
+			next := append([]int(nil), c.idx...)
+			next[col]++
+			heap.Push(h, &combination{next, col, score(next)})
+		}
+	}
+	return out
+}
+
+type combination struct {
+	idx         []int
+	lastChanged int
+	score       float64
+}
+
+type combinationHeap []*combination
+
+func (h combinationHeap) Len() int            { return len(h) }
+func (h combinationHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h combinationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *combinationHeap) Push(x interface{}) { *h = append(*h, x.(*combination)) }
+func (h *combinationHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/google/xtoproto/csvtoprotoparse"
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+// goDurationPattern matches durations in time.ParseDuration syntax that have at least one
+// unit, so plain numbers like "0" are left to the number inferrers.
+var goDurationPattern = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h)((\d+(\.\d*)?|\.\d+)(ns|us|µs|μs|ms|s|m|h))*$`)
+
+// plainDurationNumberPattern matches the numbers that may be given a unit suffix.
+var plainDurationNumberPattern = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)$`)
+
+// columnNameDurationUnits maps the last word of a column name, as in "latency_ms", to the
+// time.ParseDuration unit of its values. Ambiguous abbreviations like "m" and "min" are
+// not included.
+var columnNameDurationUnits = map[string]string{
+	"ns":           "ns",
+	"nanos":        "ns",
+	"nanoseconds":  "ns",
+	"us":           "us",
+	"micros":       "us",
+	"microseconds": "us",
+	"ms":           "ms",
+	"millis":       "ms",
+	"milliseconds": "ms",
+	"sec":          "s",
+	"secs":         "s",
+	"seconds":      "s",
+	"mins":         "m",
+	"minutes":      "m",
+	"hrs":          "h",
+	"hours":        "h",
+}
+
+type durationColumnType struct {
+	syntax pb.DurationFormat_Syntax
+	// unit is appended to values of the GO syntax before parsing.
+	unit string
+}
+
+func (t *durationColumnType) protoType() string {
+	return "google.protobuf.Duration"
+}
+
+func (t *durationColumnType) protoImports() []string {
+	return []string{"google/protobuf/duration.proto"}
+}
+
+func (t *durationColumnType) updateMapping(mapping *pb.ColumnToFieldMapping) {
+	mapping.ParsingInfo = &pb.ColumnToFieldMapping_DurationFormat{
+		DurationFormat: &pb.DurationFormat{
+			GoUnitSuffix: t.unit,
+			Syntax:       t.syntax,
+		},
+	}
+}
+
+func (t *durationColumnType) parses(value string) bool {
+	var err error
+	switch t.syntax {
+	case pb.DurationFormat_CLOCK:
+		_, err = csvtoprotoparse.ParseClockDuration(value)
+	case pb.DurationFormat_ISO_8601:
+		_, err = csvtoprotoparse.ParseISO8601Duration(value)
+	default:
+		if t.unit == "" && !goDurationPattern.MatchString(value) {
+			return false
+		}
+		if t.unit != "" && !plainDurationNumberPattern.MatchString(value) {
+			return false
+		}
+		_, err = csvtoprotoparse.ParseGoDuration(value, t.unit)
+	}
+	return err == nil
+}
+
+func (t *durationColumnType) asInferrerFunc() func(string) (columnType, error) {
+	return func(value string) (columnType, error) {
+		if t.parses(value) {
+			return t, nil
+		}
+		return nil, nil
+	}
+}
+
+// durationFormatInferrers returns inferrers for each duration syntax. If the last word of
+// the column name is a unit, numbers are also inferred to be durations in that unit.
+func durationFormatInferrers(columnName string) []func(string) (columnType, error) {
+	types := []*durationColumnType{
+		{syntax: pb.DurationFormat_GO},
+		{syntax: pb.DurationFormat_CLOCK},
+		{syntax: pb.DurationFormat_ISO_8601},
+	}
+	if unit := columnNameDurationUnit(columnName); unit != "" {
+		types = append(types, &durationColumnType{syntax: pb.DurationFormat_GO, unit: unit})
+	}
+	var out []func(string) (columnType, error)
+	for _, t := range types {
+		out = append(out, t.asInferrerFunc())
+	}
+	return out
+}
+
+// columnNameDurationUnit returns the duration unit named by the last word of a column name,
+// or "".
+func columnNameDurationUnit(columnName string) string {
+	words := strings.FieldsFunc(strings.ToLower(columnName), func(r rune) bool {
+		return r == '_' || r == '-' || r == ' ' || r == '(' || r == ')'
+	})
+	if len(words) < 2 {
+		return ""
+	}
+	return columnNameDurationUnits[words[len(words)-1]]
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stoewer/go-strcase"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+// EnumOptions controls when a string column is inferred to be an enum.
+type EnumOptions struct {
+	// MinExampleCount is the minimum number of non-null values a column must have to be
+	// inferred as an enum.
+	MinExampleCount int
+
+	// MaxUniqueValues is the maximum number of distinct values an enum column may have.
+	MaxUniqueValues int
+
+	// MaxUniqueValuesOverCount is the maximum ratio of distinct values to non-null values an
+	// enum column may have.
+	MaxUniqueValuesOverCount float64
+
+	// MaxStringLength is the maximum length of any value in an enum column.
+	MaxStringLength int
+}
+
+// DefaultEnumOptions are reasonable settings for inferring enums from category columns like
+// "status" or "country."
+var DefaultEnumOptions = &EnumOptions{
+	MinExampleCount:          10,
+	MaxUniqueValues:          20,
+	MaxUniqueValuesOverCount: 0.2,
+	MaxStringLength:          32,
+}
+
+type enumColumnType struct {
+	def *pb.EnumDefinition
+}
+
+func (t *enumColumnType) protoType() string {
+	return t.def.GetEnumName()
+}
+
+func (t *enumColumnType) protoImports() []string {
+	return nil
+}
+
+func (t *enumColumnType) updateMapping(mapping *pb.ColumnToFieldMapping) {}
+
+// protoEnumCode returns the source of the enum definition for a .proto file.
+func (t *enumColumnType) protoEnumCode() string {
+	lines := []string{fmt.Sprintf("enum %s {", t.def.GetEnumName())}
+	lines = append(lines, fmt.Sprintf("  %s = 0;", enumZeroValueName(t.def.GetEnumName())))
+	for _, v := range t.def.GetValues() {
+		lines = append(lines, fmt.Sprintf("  %s = %d;", v.GetProtoName(), v.GetNumber()))
+	}
+	lines = append(lines, "}")
+	return strings.Join(lines, "\n")
+}
+
+// inferEnum returns an enumColumnType if the values of the column are few enough to be
+// represented as an enum, or nil otherwise.
+func (cs *columnState) inferEnum() *enumColumnType {
+	opts := cs.opts
+	eo := opts.EnumOptions
+	nonNull := cs.nonNullCount()
+	if eo == nil || nonNull == 0 || nonNull < eo.MinExampleCount || cs.maxLength > eo.MaxStringLength {
+		return nil
+	}
+	rawValues, ok := cs.distinctNonNullValues()
+	if !ok || len(rawValues) > eo.MaxUniqueValues || float64(len(rawValues))/float64(nonNull) > eo.MaxUniqueValuesOverCount {
+		return nil
+	}
+
+	enumName := strcase.UpperCamelCase(columnNameToFieldName(cs.columnName()))
+	if enumName == "" {
+		return nil
+	}
+	if enumName == opts.MessageName {
+		enumName += "Enum"
+	}
+	prefix := strcase.UpperSnakeCase(enumName)
+
+	// Raw values that only differ in case share an enum value. Other raw values whose
+	// names collide, such as "A+" and "A-", get the suffixes _2, _3, ... in the order of the
+	// sorted raw values.
+	byFold := make(map[string]*pb.EnumValueDefinition)
+	used := make(map[string]bool)
+	var names []string
+	byName := make(map[string]*pb.EnumValueDefinition)
+	for _, raw := range rawValues {
+		folded := strings.ToLower(raw)
+		if v := byFold[folded]; v != nil {
+			v.RawValues = append(v.RawValues, raw)
+			continue
+		}
+		base := enumValueName(prefix, raw)
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[name] = true
+		v := &pb.EnumValueDefinition{ProtoName: name, RawValues: []string{raw}}
+		byFold[folded] = v
+		byName[name] = v
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	def := &pb.EnumDefinition{EnumName: enumName}
+	for i, name := range names {
+		v := byName[name]
+		v.Number = int32(i + 1)
+		def.Values = append(def.Values, v)
+	}
+	return &enumColumnType{def}
+}
+
+func enumZeroValueName(enumName string) string {
+	return strcase.UpperSnakeCase(enumName) + "_UNSPECIFIED"
+}
+
+func enumValueName(prefix, rawValue string) string {
+	suffix := strings.ToUpper(columnNameToFieldName(rawValue))
+	switch suffix {
+	case "":
+		suffix = "EMPTY"
+	case "UNSPECIFIED":
+		suffix = "UNSPECIFIED_VALUE"
+	}
+	return prefix + "_" + suffix
+}
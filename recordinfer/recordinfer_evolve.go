@@ -0,0 +1,257 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
+)
+
+// IncompatibleTypeChange describes a column whose inferred type cannot replace the type of
+// its field in the previous mapping without breaking wire compatibility, and whose values
+// may not parse as the previous type.
+type IncompatibleTypeChange struct {
+	ColumnName   string
+	ProtoName    string
+	PreviousType string
+	InferredType string
+}
+
+// String returns a human-readable description of the change.
+func (c *IncompatibleTypeChange) String() string {
+	return fmt.Sprintf("column %q (field %s) changed from %s to %s", c.ColumnName, c.ProtoName, c.PreviousType, c.InferredType)
+}
+
+// widenedTypes maps a proto type to the types it may be changed to without breaking wire
+// compatibility, because each value of the old type is encoded the same way as the same
+// value of the new type.
+var widenedTypes = map[string][]string{
+	"int32":  {"int64"},
+	"uint32": {"int64", "uint64"},
+	"sint32": {"sint64"},
+}
+
+// subsumedTypes maps a proto type to the types whose values it can also parse. A field
+// keeps its previous type if the inferred type is one of these.
+var subsumedTypes = map[string][]string{
+	"int64":  {"int32", "uint32"},
+	"uint64": {"uint32"},
+	"sint64": {"sint32"},
+	"double": {"float", "int32", "int64", "uint32", "uint64"},
+}
+
+// Evolve returns a mapping for the columns of an inferred mapping that is wire compatible
+// with a previous mapping, such as one checked into a repository that describes data that
+// is already stored.
+//
+// Columns are matched to the fields of the previous mapping by column name. A matched
+// column keeps the name, tag and ignored setting of its previous field, and takes the
+// inferred type if it is the same as or wider than the previous type. Otherwise the
+// previous field is kept unchanged, and the change is reported as an
+// IncompatibleTypeChange unless the previous type can parse the values of the inferred
+// type, such as int64 for int32 values or string for any values. New columns get tags and
+// names not used by the previous mapping. The tags and names of removed columns are
+// reserved.
+//
+// The package, message name, Go options, CSV dialect and extra field definitions of the
+// previous mapping are kept, falling back to those of the inferred mapping if unset.
+// Enums keep the numbers of their previous values.
+func Evolve(previous, inferred *pb.RecordProtoMapping) (*pb.RecordProtoMapping, []*IncompatibleTypeChange) {
+	out := &pb.RecordProtoMapping{
+		PackageName:           previous.GetPackageName(),
+		MessageName:           previous.GetMessageName(),
+		GoOptions:             previous.GetGoOptions(),
+		CsvDialect:            previous.GetCsvDialect(),
+		ExtraFieldDefinitions: previous.GetExtraFieldDefinitions(),
+		ReservedTags:          previous.GetReservedTags(),
+		ReservedNames:         previous.GetReservedNames(),
+	}
+	if out.PackageName == "" {
+		out.PackageName = inferred.GetPackageName()
+	}
+	if out.MessageName == "" {
+		out.MessageName = inferred.GetMessageName()
+	}
+	if out.GoOptions == nil {
+		out.GoOptions = inferred.GetGoOptions()
+	}
+	if out.CsvDialect == nil {
+		out.CsvDialect = inferred.GetCsvDialect()
+	}
+	out = proto.Clone(out).(*pb.RecordProtoMapping)
+
+	usedTags := map[int32]bool{}
+	usedNames := map[string]bool{}
+	for _, tag := range previous.GetReservedTags() {
+		usedTags[tag] = true
+	}
+	for _, name := range previous.GetReservedNames() {
+		usedNames[name] = true
+	}
+	for _, f := range previous.GetExtraFieldDefinitions() {
+		usedTags[f.GetProtoTag()] = true
+		usedNames[f.GetProtoName()] = true
+	}
+	for _, f := range previous.GetColumnToFieldMappings() {
+		usedTags[f.GetProtoTag()] = true
+		usedNames[f.GetProtoName()] = true
+	}
+
+	unmatched := append([]*pb.ColumnToFieldMapping(nil), previous.GetColumnToFieldMappings()...)
+	match := func(colName string) *pb.ColumnToFieldMapping {
+		for i, f := range unmatched {
+			if f.GetColName() == colName {
+				unmatched = append(unmatched[:i], unmatched[i+1:]...)
+				return f
+			}
+		}
+		return nil
+	}
+
+	var changes []*IncompatibleTypeChange
+	var newFields []*pb.ColumnToFieldMapping
+	for _, col := range inferred.GetColumnToFieldMappings() {
+		field := proto.Clone(col).(*pb.ColumnToFieldMapping)
+		prev := match(col.GetColName())
+		if prev == nil {
+			newFields = append(newFields, field)
+			out.ColumnToFieldMappings = append(out.ColumnToFieldMappings, field)
+			continue
+		}
+		if prev.GetProtoType() != col.GetProtoType() && !containsString(widenedTypes[prev.GetProtoType()], col.GetProtoType()) {
+			if prev.GetProtoType() != "string" && !containsString(subsumedTypes[prev.GetProtoType()], col.GetProtoType()) {
+				changes = append(changes, &IncompatibleTypeChange{
+					ColumnName:   col.GetColName(),
+					ProtoName:    prev.GetProtoName(),
+					PreviousType: prev.GetProtoType(),
+					InferredType: col.GetProtoType(),
+				})
+			}
+			field = proto.Clone(prev).(*pb.ColumnToFieldMapping)
+			field.ColumnIndex = col.GetColumnIndex()
+		}
+		field.ProtoName = prev.GetProtoName()
+		field.ProtoTag = prev.GetProtoTag()
+		field.Ignored = prev.GetIgnored()
+		out.ColumnToFieldMappings = append(out.ColumnToFieldMappings, field)
+	}
+
+	for _, f := range unmatched {
+		out.ReservedTags = append(out.ReservedTags, f.GetProtoTag())
+		out.ReservedNames = append(out.ReservedNames, f.GetProtoName())
+	}
+	sort.Slice(out.ReservedTags, func(i, j int) bool { return out.ReservedTags[i] < out.ReservedTags[j] })
+	sort.Strings(out.ReservedNames)
+
+	nextTag := int32(1)
+	for _, field := range newFields {
+		for usedTags[nextTag] || (nextTag >= reservedTagsStart && nextTag <= reservedTagsEnd) {
+			nextTag++
+		}
+		field.ProtoTag = nextTag
+		usedTags[nextTag] = true
+		name := field.GetProtoName()
+		for i := 2; usedNames[name]; i++ {
+			name = fmt.Sprintf("%s_%d", field.GetProtoName(), i)
+		}
+		field.ProtoName = name
+		usedNames[name] = true
+	}
+
+	out.EnumDefinitions = evolveEnums(out.GetColumnToFieldMappings(), previous.GetEnumDefinitions(), inferred.GetEnumDefinitions())
+	return out, changes
+}
+
+// Field numbers 19000 through 19999 are reserved for the protocol buffer implementation.
+const (
+	reservedTagsStart = 19000
+	reservedTagsEnd   = 19999
+)
+
+// evolveEnums returns the enums used by fields. An enum defined by both the previous and
+// the inferred mapping keeps the numbers of its previous values, including values that
+// were not inferred, and new values get the next unused numbers.
+func evolveEnums(fields []*pb.ColumnToFieldMapping, previous, inferred []*pb.EnumDefinition) []*pb.EnumDefinition {
+	find := func(enums []*pb.EnumDefinition, name string) *pb.EnumDefinition {
+		for _, e := range enums {
+			if e.GetEnumName() == name {
+				return e
+			}
+		}
+		return nil
+	}
+	var out []*pb.EnumDefinition
+	for _, field := range fields {
+		if find(out, field.GetProtoType()) != nil {
+			continue
+		}
+		prev, inf := find(previous, field.GetProtoType()), find(inferred, field.GetProtoType())
+		switch {
+		case prev == nil && inf == nil:
+			continue
+		case prev == nil:
+			out = append(out, proto.Clone(inf).(*pb.EnumDefinition))
+			continue
+		case inf == nil:
+			out = append(out, proto.Clone(prev).(*pb.EnumDefinition))
+			continue
+		}
+		merged := proto.Clone(prev).(*pb.EnumDefinition)
+		maxNumber := int32(0)
+		for _, v := range merged.GetValues() {
+			if v.GetNumber() > maxNumber {
+				maxNumber = v.GetNumber()
+			}
+		}
+		for _, v := range inf.GetValues() {
+			if existing := findEnumValue(merged, v.GetProtoName()); existing != nil {
+				for _, raw := range v.GetRawValues() {
+					if !containsString(existing.RawValues, raw) {
+						existing.RawValues = append(existing.RawValues, raw)
+					}
+				}
+				continue
+			}
+			maxNumber++
+			nv := proto.Clone(v).(*pb.EnumValueDefinition)
+			nv.Number = maxNumber
+			merged.Values = append(merged.Values, nv)
+		}
+		out = append(out, merged)
+	}
+	return out
+}
+
+func findEnumValue(enum *pb.EnumDefinition, protoName string) *pb.EnumValueDefinition {
+	for _, v := range enum.GetValues() {
+		if v.GetProtoName() == protoName {
+			return v
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
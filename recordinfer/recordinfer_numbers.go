@@ -15,38 +15,365 @@
 package recordinfer
 
 import (
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/xtoproto/csvtoprotoparse"
 
 	pb "github.com/google/xtoproto/proto/recordtoproto"
 )
 
+// NumberOptions controls how the proto types of numeric columns are chosen from the range
+// and precision of the observed values.
+type NumberOptions struct {
+	// Headroom is the factor applied to the largest observed magnitude of an integer column
+	// before choosing its width, so columns whose values grow over time still fit. For
+	// example, with a Headroom of 10 a column with a maximum of 300,000,000 is int64 rather
+	// than int32. Values less than 1 are treated as 1.
+	Headroom float64
+
+	// NarrowIntegers allows int32 and uint32 for integer columns whose values fit after
+	// applying Headroom. Otherwise integer columns are int64 or uint64.
+	NarrowIntegers bool
+
+	// Unsigned allows uint32 and uint64 for integer columns without negative values.
+	// Columns with values larger than the maximum int64 are uint64 regardless.
+	Unsigned bool
+
+	// AllowFloatRounding uses float for decimal columns even if some observed values
+	// cannot be represented by a 32-bit float, in which case the inference reasons include
+	// a warning. Otherwise such columns are double.
+	AllowFloatRounding bool
+}
+
+// DefaultNumberOptions is used when Options.NumberOptions is nil. Integer columns are int64,
+// and decimal columns are float unless float would round the observed values.
+var DefaultNumberOptions = &NumberOptions{Headroom: 1}
+
+func (o *NumberOptions) headroom() float64 {
+	if o.Headroom < 1 {
+		return 1
+	}
+	return o.Headroom
+}
+
+// numberStats summarizes the values of a numeric column.
+type numberStats struct {
+	count int
+	// minInt and maxUint are the smallest negative and the largest non-negative integer
+	// values. They are only meaningful if hasNegative and hasNonNegative are set.
+	minInt                      int64
+	maxUint                     uint64
+	hasNegative, hasNonNegative bool
+	// minFloat and maxFloat are the smallest and largest values, and minText and maxText
+	// are their normalized text.
+	minFloat, maxFloat float64
+	minText, maxText   string
+	// maxFractionDigits is the largest number of digits after the decimal point.
+	maxFractionDigits int
+	// roundedCount is the number of values that a 32-bit float cannot represent with the
+	// same shortest decimal form, and roundedExample is the first such value.
+	roundedCount   int
+	roundedExample string
+}
+
+// add updates the stats with a value in the form accepted by strconv. integerOnly requires
+// the value to be an integer. It returns false and leaves the stats unchanged if the value
+// is not a number or, for integers, if no integer type can represent every value.
+func (s *numberStats) add(normalized, rawValue string, integerOnly bool) (isInteger, ok bool) {
+	f, err := strconv.ParseFloat(normalized, 64)
+	if err != nil {
+		return false, false
+	}
+	i, intErr := strconv.ParseInt(normalized, 10, 64)
+	u, uintErr := strconv.ParseUint(normalized, 10, 64)
+	isInteger = intErr == nil || uintErr == nil
+	if integerOnly {
+		if !isInteger {
+			return false, false
+		}
+		// No integer type holds both negative values and values larger than the maximum
+		// int64.
+		if (intErr != nil && s.hasNegative) || (intErr == nil && i < 0 && s.maxUint > math.MaxInt64) {
+			return false, false
+		}
+	}
+
+	if s.count == 0 || f < s.minFloat {
+		s.minFloat, s.minText = f, normalized
+	}
+	if s.count == 0 || f > s.maxFloat {
+		s.maxFloat, s.maxText = f, normalized
+	}
+	s.count++
+	switch {
+	case intErr == nil && i < 0:
+		if !s.hasNegative || i < s.minInt {
+			s.minInt = i
+		}
+		s.hasNegative = true
+	case uintErr == nil:
+		if !s.hasNonNegative || u > s.maxUint {
+			s.maxUint = u
+		}
+		s.hasNonNegative = true
+	}
+	if _, frac, ok := strings.Cut(normalized, "."); ok && !strings.ContainsAny(frac, "eE") && len(frac) > s.maxFractionDigits {
+		s.maxFractionDigits = len(frac)
+	}
+	shortest32 := strconv.FormatFloat(float64(float32(f)), 'g', -1, 32)
+	if back, err := strconv.ParseFloat(shortest32, 64); err != nil || back != f {
+		if s.roundedCount == 0 {
+			s.roundedExample = rawValue
+		}
+		s.roundedCount++
+	}
+	return isInteger, true
+}
+
+// integerType returns the proto type of an integer column.
+func (s *numberStats) integerType(opts *NumberOptions) string {
+	fits := func(max uint64, min int64) bool {
+		h := opts.headroom()
+		return (!s.hasNonNegative || float64(s.maxUint)*h <= float64(max)) &&
+			(!s.hasNegative || float64(s.minInt)*h >= float64(min))
+	}
+	if !s.hasNegative && (opts.Unsigned || s.maxUint > math.MaxInt64) {
+		if opts.NarrowIntegers && fits(math.MaxUint32, 0) {
+			return "uint32"
+		}
+		return "uint64"
+	}
+	if opts.NarrowIntegers && fits(math.MaxInt32, math.MinInt32) {
+		return "int32"
+	}
+	return "int64"
+}
+
+// floatType returns the proto type of a decimal column.
+func (s *numberStats) floatType(opts *NumberOptions) string {
+	if s.roundedCount > 0 && !opts.AllowFloatRounding {
+		return "double"
+	}
+	return "float"
+}
+
 type numberColumnType struct {
+	// integerOnly is true for columns whose values must all be integers.
+	integerOnly bool
+	// floatingPoint is true if the proto type is float or double. Columns of plain decimal
+	// numbers always are, and formatted columns are once a non-integer value is seen.
 	floatingPoint bool
+	// format is nil for numbers in the plain form accepted by strconv.
+	format *pb.NumberFormat
+	stats  numberStats
+	opts   *NumberOptions
 }
 
 func (t *numberColumnType) protoType() string {
 	if t.floatingPoint {
-		return "float"
+		return t.stats.floatType(t.opts)
 	}
-	return "int64"
+	return t.stats.integerType(t.opts)
 }
 
 func (t *numberColumnType) protoImports() []string {
 	return nil
 }
 
-func (t *numberColumnType) updateMapping(mapping *pb.ColumnToFieldMapping) {}
+func (t *numberColumnType) updateMapping(mapping *pb.ColumnToFieldMapping) {
+	if f := t.numberFormat(); f != nil {
+		mapping.ParsingInfo = &pb.ColumnToFieldMapping_NumberFormat{NumberFormat: f}
+	}
+}
+
+// numberFormat returns a copy of the format of the numbers, or nil if they are in the plain
+// form accepted by strconv.
+func (t *numberColumnType) numberFormat() *pb.NumberFormat {
+	if t.format == nil || proto.Equal(t.format, &pb.NumberFormat{}) {
+		return nil
+	}
+	return proto.Clone(t.format).(*pb.NumberFormat)
+}
+
+// reasons returns human-readable notes about the range and precision of the values.
+func (t *numberColumnType) reasons() []string {
+	s := &t.stats
+	if s.count == 0 {
+		return nil
+	}
+	if !t.floatingPoint {
+		return []string{fmt.Sprintf("values range from %s to %s", s.minText, s.maxText)}
+	}
+	out := []string{fmt.Sprintf("values range from %s to %s with up to %d decimal places", s.minText, s.maxText, s.maxFractionDigits)}
+	if s.roundedCount > 0 {
+		if t.protoType() == "float" {
+			out = append(out, fmt.Sprintf("warning: float rounds %d values, such as %q", s.roundedCount, s.roundedExample))
+		} else {
+			out = append(out, fmt.Sprintf("float would round %d values, such as %q, so double is used", s.roundedCount, s.roundedExample))
+		}
+	}
+	return out
+}
+
+// plainNumberInferrers returns inferrers of integers and decimal numbers in the plain form
+// accepted by strconv. Like the formatted number inferrers, they are stateful and track the
+// range of the values.
+func plainNumberInferrers(opts *NumberOptions) []func(string) (columnType, error) {
+	var out []func(string) (columnType, error)
+	for _, integerOnly := range []bool{true, false} {
+		t := &numberColumnType{integerOnly: integerOnly, floatingPoint: !integerOnly, opts: opts}
+		out = append(out, func(value string) (columnType, error) {
+			if _, ok := t.stats.add(value, value, t.integerOnly); !ok {
+				return nil, nil
+			}
+			return t, nil
+		})
+	}
+	return out
+}
+
+// numberStyle is a family of number formats that share a decimal mark.
+type numberStyle struct {
+	decimalMark         string
+	thousandsSeparators []string
+}
+
+// numberStyles are the styles of formatted numbers that are inferred, such as "1,234.5"
+// and "1.234,5".
+var numberStyles = []*numberStyle{
+	{".", []string{",", " ", "'"}},
+	{",", []string{".", " "}},
+}
+
+// currencySymbols are the currency signs recognized as number prefixes or suffixes.
+var currencySymbols = []string{"$", "€", "£", "¥", "₹"}
+
+// formattedNumberInferrers returns an inferrer for each number style. Unlike other inferrers,
+// these are stateful: the format of the column is the union of the features of the values
+// seen so far, so "$1,234" and "(7)" together give a format with a "$" prefix, a ","
+// thousands separator and parenthesized negatives. A value that conflicts with the format
+// so far, such as "12%" after "$1", does not parse.
+func formattedNumberInferrers(opts *NumberOptions) []func(string) (columnType, error) {
+	var out []func(string) (columnType, error)
+	for _, style := range numberStyles {
+		style := style
+		t := &numberColumnType{format: &pb.NumberFormat{}, opts: opts}
+		out = append(out, func(value string) (columnType, error) {
+			f, normalized, ok := detectNumberFormat(value, style)
+			if !ok {
+				return nil, nil
+			}
+			merged, ok := mergeNumberFormat(t.format, f)
+			if !ok {
+				return nil, nil
+			}
+			isInteger, ok := t.stats.add(normalized, value, false)
+			if !ok {
+				return nil, nil
+			}
+			t.format = merged
+			t.floatingPoint = t.floatingPoint || !isInteger
+			return t, nil
+		})
+	}
+	return out
+}
+
+// detectNumberFormat returns the format of value if it is a number written in the given
+// style and the value in the form accepted by strconv.
+func detectNumberFormat(value string, style *numberStyle) (*pb.NumberFormat, string, bool) {
+	f := &pb.NumberFormat{}
+	s := value
+	if trimmed := strings.TrimSpace(s); trimmed != s {
+		f.TrimSpace, s = true, trimmed
+	}
+	if len(s) > 2 && strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		f.ParenthesizedNegatives, s = true, s[1:len(s)-1]
+	}
+	s = trimSign(s)
+	for _, sym := range currencySymbols {
+		if strings.HasPrefix(s, sym) {
+			f.Prefix = sym
+			if strings.HasPrefix(s[len(sym):], " ") {
+				f.Prefix += " "
+			}
+			s = trimSign(s[len(f.Prefix):])
+			break
+		}
+	}
+	for _, sym := range append([]string{"%"}, currencySymbols...) {
+		if strings.HasSuffix(s, sym) {
+			f.Suffix = sym
+			if strings.HasSuffix(s[:len(s)-len(sym)], " ") {
+				f.Suffix = " " + sym
+			}
+			s = s[:len(s)-len(f.Suffix)]
+			break
+		}
+	}
+	intPart, _, hasFrac := strings.Cut(s, style.decimalMark)
+	for _, sep := range style.thousandsSeparators {
+		if strings.Contains(intPart, sep) {
+			f.ThousandsSeparator = sep
+			break
+		}
+	}
+	if hasFrac && style.decimalMark != "." {
+		f.DecimalMark = style.decimalMark
+	}
+
+	normalized, err := numberFormatToParser(f).Normalize(value)
+	if err != nil {
+		return nil, "", false
+	}
+	return f, normalized, true
+}
+
+func trimSign(s string) string {
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		return s[1:]
+	}
+	return s
+}
 
-func inferFloat32Format(value string) (columnType, error) {
-	if _, err := strconv.ParseFloat(value, 32); err == nil {
-		return &numberColumnType{floatingPoint: true}, nil
+// mergeNumberFormat returns a format with the features of both dst and f, or false if the
+// formats conflict.
+func mergeNumberFormat(dst, f *pb.NumberFormat) (*pb.NumberFormat, bool) {
+	merged := proto.Clone(dst).(*pb.NumberFormat)
+	for _, field := range []struct {
+		dst   *string
+		value string
+	}{
+		{&merged.ThousandsSeparator, f.GetThousandsSeparator()},
+		{&merged.DecimalMark, f.GetDecimalMark()},
+		{&merged.Prefix, f.GetPrefix()},
+		{&merged.Suffix, f.GetSuffix()},
+	} {
+		switch {
+		case field.value == "":
+		case *field.dst == "":
+			*field.dst = field.value
+		case *field.dst != field.value:
+			return nil, false
+		}
 	}
-	return nil, nil
+	merged.ParenthesizedNegatives = merged.ParenthesizedNegatives || f.GetParenthesizedNegatives()
+	merged.TrimSpace = merged.TrimSpace || f.GetTrimSpace()
+	return merged, true
 }
 
-func inferInt64Format(value string) (columnType, error) {
-	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
-		return &numberColumnType{floatingPoint: false}, nil
+// numberFormatToParser returns the runtime parser of numbers in format f.
+func numberFormatToParser(f *pb.NumberFormat) *csvtoprotoparse.NumberFormat {
+	return &csvtoprotoparse.NumberFormat{
+		ThousandsSeparator:     f.GetThousandsSeparator(),
+		DecimalMark:            f.GetDecimalMark(),
+		Prefix:                 f.GetPrefix(),
+		Suffix:                 f.GetSuffix(),
+		ParenthesizedNegatives: f.GetParenthesizedNegatives(),
+		TrimSpace:              f.GetTrimSpace(),
 	}
-	return nil, nil
 }
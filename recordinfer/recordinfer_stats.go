@@ -0,0 +1,256 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recordinfer
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxTrackedValues is the number of distinct values per column whose frequency is counted
+	// exactly. Beyond this, frequencies are estimated with a fixed-size sketch.
+	maxTrackedValues = 10000
+
+	// minViabilitySamples is the number of non-null values a column must have before a type
+	// that fails to parse too many of them is no longer evaluated.
+	minViabilitySamples = 1000
+)
+
+// columnState is the incrementally updated state used to infer the type of a column. Its
+// size is bounded regardless of the number of values added.
+type columnState struct {
+	name string
+	opts *Options
+
+	rowCount   int
+	nullCounts map[string]int
+	maxLength  int
+	counts     *valueCounter
+	inferrers  []*inferrerState
+}
+
+// inferrerState tracks how many values of a column parse as a particular type.
+type inferrerState struct {
+	// infer returns the column type of a value, or nil if the value does not parse. It
+	// returns the same columnType for every value it parses, so the column type needs no
+	// comparison as values are added.
+	infer   func(string) (columnType, error)
+	colType columnType
+	parsed  int
+	// viable is false once the type has failed to parse so many values that it can no
+	// longer be a candidate.
+	viable bool
+}
+
+func newColumnState(name string, opts *Options) *columnState {
+	cs := &columnState{
+		name:       name,
+		opts:       opts,
+		nullCounts: make(map[string]int),
+		counts:     newValueCounter(maxTrackedValues),
+	}
+	var inferrers []func(string) (columnType, error)
+	inferrers = append(inferrers, timeFormatInferrers(opts.TimestampLocation)...)
+	inferrers = append(inferrers, durationFormatInferrers(name)...)
+	numberOpts := opts.NumberOptions
+	if numberOpts == nil {
+		numberOpts = DefaultNumberOptions
+	}
+	inferrers = append(inferrers, boolFormatInferrer(opts))
+	inferrers = append(inferrers, plainNumberInferrers(numberOpts)...)
+	inferrers = append(inferrers, formattedNumberInferrers(numberOpts)...)
+	for _, infer := range inferrers {
+		cs.inferrers = append(cs.inferrers, &inferrerState{infer: infer, viable: true})
+	}
+	return cs
+}
+
+func (cs *columnState) columnName() string {
+	return cs.name
+}
+
+// add updates the state of the column with a raw value.
+func (cs *columnState) add(value string) {
+	cs.rowCount++
+	cs.counts.add(value)
+	if cs.opts.isNullValue(value) {
+		cs.nullCounts[value]++
+		return
+	}
+	if len(value) > cs.maxLength {
+		cs.maxLength = len(value)
+	}
+	nonNull := cs.nonNullCount()
+	for _, is := range cs.inferrers {
+		if !is.viable {
+			continue
+		}
+		if newColType, err := is.infer(value); err == nil && newColType != nil {
+			is.colType = newColType
+			is.parsed++
+		}
+		failed := nonNull - is.parsed
+		if nonNull >= minViabilitySamples && float64(failed) > (1-minCandidateParsedShare)*float64(nonNull) {
+			is.viable = false
+		}
+	}
+}
+
+func (cs *columnState) nullCount() int {
+	total := 0
+	for _, c := range cs.nullCounts {
+		total += c
+	}
+	return total
+}
+
+func (cs *columnState) nonNullCount() int {
+	return cs.rowCount - cs.nullCount()
+}
+
+// observedNullValues returns the sorted, unique null sentinels that appear in the column.
+func (cs *columnState) observedNullValues() []string {
+	var values []string
+	for v := range cs.nullCounts {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// distinctNonNullValues returns the sorted, unique non-null values of the column, or false if
+// there were too many to track exactly.
+func (cs *columnState) distinctNonNullValues() ([]string, bool) {
+	if cs.counts.approximate {
+		return nil, false
+	}
+	var values []string
+	for _, e := range cs.counts.entries {
+		if cs.nullCounts[e.value] == 0 {
+			values = append(values, e.value)
+		}
+	}
+	sort.Strings(values)
+	return values, true
+}
+
+const valuesToDisplayInStatisticalComment = 5
+
+// statisticalComment returns a human-readable description of the values of the column based
+// on the values inspected. totalRows is the number of rows in the input, which may be larger
+// than the number of rows inspected if the input was sampled.
+func (cs *columnState) statisticalComment(totalRows int) string {
+	entries := cs.counts.mostCommon(valuesToDisplayInStatisticalComment)
+	var dispKeys []string
+	for _, e := range entries {
+		dispKeys = append(dispKeys, fmt.Sprintf("%q (%d)", e.value, e.count))
+	}
+	unique := fmt.Sprintf("%d", len(cs.counts.entries))
+	common := "most common"
+	if cs.counts.approximate {
+		unique = fmt.Sprintf("more than %d", len(cs.counts.entries))
+		common = "most common (approximate counts)"
+	}
+	rows := fmt.Sprintf("%d rows", cs.rowCount)
+	if totalRows > cs.rowCount {
+		rows = fmt.Sprintf("%d sampled rows of %d", cs.rowCount, totalRows)
+	}
+	return fmt.Sprintf("Field type inferred from %s unique values in %s; %d %s: %s",
+		unique, rows, len(dispKeys), common, strings.Join(dispKeys, "; "))
+}
+
+// valueCounter counts the frequency of values. The first capacity distinct values are
+// counted exactly. After that, the counter behaves like the Space-Saving sketch of Metwally
+// et al.: the least frequent value is replaced by the new value, whose count is overestimated
+// by the evicted count.
+type valueCounter struct {
+	capacity    int
+	entries     valueCountHeap
+	byValue     map[string]*valueCount
+	approximate bool
+}
+
+type valueCount struct {
+	value string
+	count int
+	index int
+}
+
+func newValueCounter(capacity int) *valueCounter {
+	return &valueCounter{capacity: capacity, byValue: make(map[string]*valueCount)}
+}
+
+func (vc *valueCounter) add(value string) {
+	if e, ok := vc.byValue[value]; ok {
+		e.count++
+		heap.Fix(&vc.entries, e.index)
+		return
+	}
+	if len(vc.entries) < vc.capacity {
+		e := &valueCount{value: value, count: 1}
+		vc.byValue[value] = e
+		heap.Push(&vc.entries, e)
+		return
+	}
+	vc.approximate = true
+	e := vc.entries[0]
+	delete(vc.byValue, e.value)
+	e.value = value
+	e.count++
+	vc.byValue[value] = e
+	heap.Fix(&vc.entries, e.index)
+}
+
+// mostCommon returns up to n of the most frequent values, ordered by descending frequency and
+// then by value.
+func (vc *valueCounter) mostCommon(n int) []*valueCount {
+	sorted := append([]*valueCount(nil), vc.entries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		// For stability, sort by string if frequency is the same.
+		return sorted[i].value < sorted[j].value
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// valueCountHeap is a min-heap of values ordered by count.
+type valueCountHeap []*valueCount
+
+func (h valueCountHeap) Len() int           { return len(h) }
+func (h valueCountHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h valueCountHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *valueCountHeap) Push(x interface{}) {
+	e := x.(*valueCount)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *valueCountHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
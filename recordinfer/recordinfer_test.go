@@ -167,6 +167,284 @@ func TestRecordBasedInferrer(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "null values",
+			rows: [][]string{
+				{"count", "when", "label"},
+				{"1", "2016-10-1", "NA"},
+				{"NA", "-", "b"},
+				{"", "2016-10-2", ""},
+				{"4", "2016-10-3", "d"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "count",
+						ColumnIndex: 0,
+						ProtoType:   "int64",
+						ProtoName:   "count",
+						ProtoTag:    1,
+						NullValues:  []string{"", "NA"},
+						Comment:     "Field type inferred from 4 unique values in 4 rows; 4 most common: \"\" (1); \"1\" (1); \"4\" (1); \"NA\" (1)",
+					},
+					{
+						ColName:      "when",
+						ColumnIndex:  1,
+						ProtoType:    "google.protobuf.Timestamp",
+						ProtoName:    "when",
+						ProtoImports: []string{"google/protobuf/timestamp.proto"},
+						ProtoTag:     2,
+						ParsingInfo: &pb.ColumnToFieldMapping_TimeFormat{
+							TimeFormat: &pb.TimeFormat{
+								GoLayout: "2006-1-2",
+							},
+						},
+						NullValues: []string{"-"},
+						Comment:    "Field type inferred from 4 unique values in 4 rows; 4 most common: \"-\" (1); \"2016-10-1\" (1); \"2016-10-2\" (1); \"2016-10-3\" (1)",
+					},
+					{
+						ColName:     "label",
+						ColumnIndex: 2,
+						ProtoType:   "string",
+						ProtoName:   "label",
+						ProtoTag:    3,
+						Comment:     "Field type inferred from 4 unique values in 4 rows; 4 most common: \"\" (1); \"NA\" (1); \"b\" (1); \"d\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "null detection disabled",
+			rows: [][]string{
+				{"count"},
+				{"1"},
+				{"NA"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				NullValues:  []string{},
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "count",
+						ColumnIndex: 0,
+						ProtoType:   "string",
+						ProtoName:   "count",
+						ProtoTag:    1,
+						Comment:     "Field type inferred from 2 unique values in 2 rows; 2 most common: \"1\" (1); \"NA\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "bools",
+			rows: [][]string{
+				{"active", "flag"},
+				{"Yes", "Y"},
+				{"no", "N"},
+				{"YES", "maybe"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "active",
+						ColumnIndex: 0,
+						ProtoType:   "bool",
+						ProtoName:   "active",
+						ProtoTag:    1,
+						ParsingInfo: &pb.ColumnToFieldMapping_BoolFormat{
+							BoolFormat: &pb.BoolFormat{
+								TrueValues:  DefaultTrueValues,
+								FalseValues: DefaultFalseValues,
+							},
+						},
+						Comment: "Field type inferred from 3 unique values in 3 rows; 3 most common: \"YES\" (1); \"Yes\" (1); \"no\" (1)",
+					},
+					{
+						ColName:     "flag",
+						ColumnIndex: 1,
+						ProtoType:   "string",
+						ProtoName:   "flag",
+						ProtoTag:    2,
+						Comment:     "Field type inferred from 3 unique values in 3 rows; 3 most common: \"N\" (1); \"Y\" (1); \"maybe\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "bools with custom vocabulary",
+			rows: [][]string{
+				{"flag"},
+				{"X"},
+				{""},
+				{"x"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				TrueValues:  []string{"x"},
+				FalseValues: []string{""},
+				NullValues:  []string{},
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "flag",
+						ColumnIndex: 0,
+						ProtoType:   "bool",
+						ProtoName:   "flag",
+						ProtoTag:    1,
+						ParsingInfo: &pb.ColumnToFieldMapping_BoolFormat{
+							BoolFormat: &pb.BoolFormat{
+								TrueValues:  []string{"x"},
+								FalseValues: []string{""},
+							},
+						},
+						Comment: "Field type inferred from 3 unique values in 3 rows; 3 most common: \"\" (1); \"X\" (1); \"x\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "bools with only true values",
+			rows: [][]string{
+				{"flag"},
+				{"SI"},
+				{"no"},
+				{"y"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				TrueValues:  []string{"si", "y"},
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "flag",
+						ColumnIndex: 0,
+						ProtoType:   "bool",
+						ProtoName:   "flag",
+						ProtoTag:    1,
+						ParsingInfo: &pb.ColumnToFieldMapping_BoolFormat{
+							BoolFormat: &pb.BoolFormat{
+								TrueValues:  []string{"si", "y"},
+								FalseValues: []string{"false", "f", "no", "n", "off"},
+							},
+						},
+						Comment: "Field type inferred from 3 unique values in 3 rows; 3 most common: \"SI\" (1); \"no\" (1); \"y\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "bools with only false values",
+			rows: [][]string{
+				{"flag"},
+				{"nein"},
+				{"yes"},
+				{"off"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				FalseValues: []string{"nein", "off", "on"},
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "flag",
+						ColumnIndex: 0,
+						ProtoType:   "bool",
+						ProtoName:   "flag",
+						ProtoTag:    1,
+						ParsingInfo: &pb.ColumnToFieldMapping_BoolFormat{
+							BoolFormat: &pb.BoolFormat{
+								TrueValues:  []string{"true", "t", "yes", "y"},
+								FalseValues: []string{"nein", "off", "on"},
+							},
+						},
+						Comment: "Field type inferred from 3 unique values in 3 rows; 3 most common: \"nein\" (1); \"off\" (1); \"yes\" (1)",
+					},
+				},
+			},
+		},
+		{
+			name: "enums",
+			rows: [][]string{
+				{"Status", "name"},
+				{"active", "a"},
+				{"Active", "b"},
+				{"in progress", "c"},
+				{"active", "d"},
+				{"", "e"},
+				{"in progress", "f"},
+			},
+			opts: &Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				EnumOptions: &EnumOptions{
+					MinExampleCount:          3,
+					MaxUniqueValues:          5,
+					MaxUniqueValuesOverCount: 0.6,
+					MaxStringLength:          20,
+				},
+			},
+			want: &pb.RecordProtoMapping{
+				PackageName: "abc",
+				MessageName: "ABC",
+				ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+					{
+						ColName:     "Status",
+						ColumnIndex: 0,
+						ProtoType:   "Status",
+						ProtoName:   "status",
+						ProtoTag:    1,
+						NullValues:  []string{""},
+						Comment:     "Field type inferred from 4 unique values in 6 rows; 4 most common: \"active\" (2); \"in progress\" (2); \"\" (1); \"Active\" (1)",
+					},
+					{
+						ColName:     "name",
+						ColumnIndex: 1,
+						ProtoType:   "string",
+						ProtoName:   "name",
+						ProtoTag:    2,
+						Comment:     "Field type inferred from 6 unique values in 6 rows; 5 most common: \"a\" (1); \"b\" (1); \"c\" (1); \"d\" (1); \"e\" (1)",
+					},
+				},
+				EnumDefinitions: []*pb.EnumDefinition{
+					{
+						EnumName: "Status",
+						Values: []*pb.EnumValueDefinition{
+							{ProtoName: "STATUS_ACTIVE", Number: 1, RawValues: []string{"Active", "active"}},
+							{ProtoName: "STATUS_IN_PROGRESS", Number: 2, RawValues: []string{"in progress"}},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "invalid row length",
 			rows: [][]string{
@@ -211,3 +489,436 @@ func TestRecordBasedInferrer(t *testing.T) {
 		})
 	}
 }
+
+func TestEnumValueNames(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		column string
+		values []string
+		want   *pb.EnumDefinition
+	}{
+		{
+			name:   "punctuation collisions",
+			column: "blood_type",
+			values: []string{"A+", "A-", "B+", "B-", "O+", "O-", "a+"},
+			want: &pb.EnumDefinition{
+				EnumName: "BloodType",
+				Values: []*pb.EnumValueDefinition{
+					{ProtoName: "BLOOD_TYPE_A", Number: 1, RawValues: []string{"A+", "a+"}},
+					{ProtoName: "BLOOD_TYPE_A_2", Number: 2, RawValues: []string{"A-"}},
+					{ProtoName: "BLOOD_TYPE_B", Number: 3, RawValues: []string{"B+"}},
+					{ProtoName: "BLOOD_TYPE_B_2", Number: 4, RawValues: []string{"B-"}},
+					{ProtoName: "BLOOD_TYPE_O", Number: 5, RawValues: []string{"O+"}},
+					{ProtoName: "BLOOD_TYPE_O_2", Number: 6, RawValues: []string{"O-"}},
+				},
+			},
+		},
+		{
+			name:   "non-ASCII values",
+			column: "country",
+			values: []string{"日本", "é", "É", "Deutschland"},
+			want: &pb.EnumDefinition{
+				EnumName: "Country",
+				Values: []*pb.EnumValueDefinition{
+					{ProtoName: "COUNTRY_DEUTSCHLAND", Number: 1, RawValues: []string{"Deutschland"}},
+					{ProtoName: "COUNTRY_EMPTY", Number: 2, RawValues: []string{"É", "é"}},
+					{ProtoName: "COUNTRY_EMPTY_2", Number: 3, RawValues: []string{"日本"}},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewRecordBasedInferrer(&Options{
+				PackageName: "abc",
+				MessageName: "ABC",
+				EnumOptions: &EnumOptions{
+					MinExampleCount:          1,
+					MaxUniqueValues:          20,
+					MaxUniqueValuesOverCount: 1,
+					MaxStringLength:          20,
+				},
+			})
+			rows := [][]string{{tc.column}}
+			for _, v := range tc.values {
+				rows = append(rows, []string{v}, []string{v})
+			}
+			for _, row := range rows {
+				if err := b.AddRow(row); err != nil {
+					t.Fatalf("AddRow(%q) error: %v", row, err)
+				}
+			}
+			got, err := b.Build()
+			if err != nil {
+				t.Fatalf("Build() error: %v", err)
+			}
+			defs := got.Mapping().GetEnumDefinitions()
+			if len(defs) != 1 {
+				t.Fatalf("Build() got %d enum definitions, want 1: %v", len(defs), defs)
+			}
+			if diff := cmp.Diff(tc.want, defs[0], protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected enum definition (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNumberFormats(t *testing.T) {
+	rows := [][]string{
+		{"amount", "eu_amount", "share", "padded", "count", "ratio", "plain"},
+		{"$1,234.50", "1.234,56", "45%", " 7 ", "1,234", "1.234", "1"},
+		{"(12.00)", "7", "3%", "8", "5", "0.5", "2"},
+		{"$7", "0,5", "100%", "9 ", "1,000,000", "2", "3"},
+	}
+	b := NewRecordBasedInferrer(&Options{PackageName: "abc", MessageName: "ABC"})
+	for _, row := range rows {
+		if err := b.AddRow(row); err != nil {
+			t.Fatalf("AddRow(%v) error: %v", row, err)
+		}
+	}
+	got, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error: %v", err)
+	}
+	type column struct {
+		ProtoType string
+		Format    *pb.NumberFormat
+	}
+	var gotColumns []column
+	for _, m := range got.Mapping().GetColumnToFieldMappings() {
+		gotColumns = append(gotColumns, column{m.GetProtoType(), m.GetNumberFormat()})
+	}
+	want := []column{
+		{"float", &pb.NumberFormat{ThousandsSeparator: ",", Prefix: "$", ParenthesizedNegatives: true}},
+		{"float", &pb.NumberFormat{ThousandsSeparator: ".", DecimalMark: ","}},
+		{"int64", &pb.NumberFormat{Suffix: "%"}},
+		{"int64", &pb.NumberFormat{TrimSpace: true}},
+		{"int64", &pb.NumberFormat{ThousandsSeparator: ","}},
+		{"float", nil},
+		{"int64", nil},
+	}
+	if diff := cmp.Diff(want, gotColumns, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected column types (-want, +got):\n%s", diff)
+	}
+}
+
+func TestDurations(t *testing.T) {
+	rows := [][]string{
+		{"go", "clock", "iso", "latency_ms", "wait_seconds", "count", "minutes"},
+		{"1h30m", "01:30:00", "PT1H30M", "150", "1.5", "150", "3"},
+		{"250ms", "26:00:00.250", "P1DT2H", "7", "60", "7", "4"},
+		{"-2s", "00:00:05", "PT0.5S", "0", "0", "0", "5"},
+	}
+	b := NewRecordBasedInferrer(&Options{PackageName: "abc", MessageName: "ABC"})
+	for _, row := range rows {
+		if err := b.AddRow(row); err != nil {
+			t.Fatalf("AddRow(%v) error: %v", row, err)
+		}
+	}
+	got, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error: %v", err)
+	}
+	type column struct {
+		ProtoType string
+		Format    *pb.DurationFormat
+	}
+	var gotColumns []column
+	for _, m := range got.Mapping().GetColumnToFieldMappings() {
+		gotColumns = append(gotColumns, column{m.GetProtoType(), m.GetDurationFormat()})
+	}
+	want := []column{
+		{"google.protobuf.Duration", &pb.DurationFormat{Syntax: pb.DurationFormat_GO}},
+		{"google.protobuf.Duration", &pb.DurationFormat{Syntax: pb.DurationFormat_CLOCK}},
+		{"google.protobuf.Duration", &pb.DurationFormat{Syntax: pb.DurationFormat_ISO_8601}},
+		{"google.protobuf.Duration", &pb.DurationFormat{GoUnitSuffix: "ms"}},
+		{"google.protobuf.Duration", &pb.DurationFormat{GoUnitSuffix: "s"}},
+		{"int64", nil},
+		{"int64", nil},
+	}
+	if diff := cmp.Diff(want, gotColumns, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected column types (-want, +got):\n%s", diff)
+	}
+}
+
+func TestNumberWidths(t *testing.T) {
+	rows := [][]string{
+		{"small", "negative", "large", "huge", "price", "precise"},
+		{"1", "-5", "3000000000", "18446744073709551615", "1.25", "123456789.123"},
+		{"200", "7", "12", "0", "0.5", "0.1"},
+	}
+	for _, tc := range []struct {
+		name       string
+		opts       *NumberOptions
+		want       []string
+		wantReason string
+	}{
+		{
+			name:       "default",
+			want:       []string{"int64", "int64", "int64", "uint64", "float", "double"},
+			wantReason: `float would round 1 values, such as "123456789.123", so double is used`,
+		},
+		{
+			name: "narrow unsigned",
+			opts: &NumberOptions{NarrowIntegers: true, Unsigned: true},
+			want: []string{"uint32", "int32", "uint32", "uint64", "float", "double"},
+		},
+		{
+			name: "headroom",
+			opts: &NumberOptions{NarrowIntegers: true, Headroom: 10},
+			want: []string{"int32", "int32", "int64", "uint64", "float", "double"},
+		},
+		{
+			name:       "float rounding allowed",
+			opts:       &NumberOptions{AllowFloatRounding: true},
+			want:       []string{"int64", "int64", "int64", "uint64", "float", "float"},
+			wantReason: `warning: float rounds 1 values, such as "123456789.123"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewRecordBasedInferrer(&Options{PackageName: "abc", MessageName: "ABC", NumberOptions: tc.opts})
+			for _, row := range rows {
+				if err := b.AddRow(row); err != nil {
+					t.Fatalf("AddRow(%v) error: %v", row, err)
+				}
+			}
+			got, err := b.Build()
+			if err != nil {
+				t.Fatalf("Build() error: %v", err)
+			}
+			var gotTypes []string
+			for _, ci := range got.ColumnInferences() {
+				gotTypes = append(gotTypes, ci.ProtoType)
+			}
+			if diff := cmp.Diff(tc.want, gotTypes); diff != "" {
+				t.Errorf("unexpected column types (-want, +got):\n%s", diff)
+			}
+			reasons := got.ColumnInferences()[5].Reasons
+			if tc.wantReason != "" && !containsString(reasons, tc.wantReason) {
+				t.Errorf("reasons for column \"precise\" = %q, want %q among them", reasons, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestBuildCandidates(t *testing.T) {
+	rows := [][]string{
+		{"order_id", "zip", "created_at"},
+		{"20200102", "02134", "20200102"},
+		{"20200103", "10001", "20200103"},
+		{"20200104", "94043", "20200104"},
+	}
+	b := NewRecordBasedInferrer(&Options{PackageName: "abc", MessageName: "ABC"})
+	for _, row := range rows {
+		if err := b.AddRow(row); err != nil {
+			t.Fatalf("AddRow(%v) error: %v", row, err)
+		}
+	}
+	got, err := b.BuildCandidates(4)
+	if err != nil {
+		t.Fatalf("BuildCandidates() error: %v", err)
+	}
+	protoTypes := func(ip *InferredProto) []string {
+		var out []string
+		for _, ci := range ip.ColumnInferences() {
+			out = append(out, ci.ProtoType)
+		}
+		return out
+	}
+	var gotTypes [][]string
+	for _, ip := range got {
+		gotTypes = append(gotTypes, protoTypes(ip))
+	}
+	wantTypes := [][]string{
+		{"int64", "string", "google.protobuf.Timestamp"},
+		{"int64", "string", "int64"},
+		{"int64", "string", "double"},
+		{"google.protobuf.Timestamp", "string", "google.protobuf.Timestamp"},
+	}
+	if diff := cmp.Diff(wantTypes, gotTypes); diff != "" {
+		t.Errorf("unexpected candidate types (-want, +got):\n%s", diff)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i-1].Confidence() < got[i].Confidence() {
+			t.Errorf("candidate %d has confidence %f > candidate %d confidence %f", i, got[i].Confidence(), i-1, got[i-1].Confidence())
+		}
+	}
+	if reasons := got[0].ColumnInferences()[1].Reasons; len(reasons) < 2 {
+		t.Errorf("expected zip reasons to mention the column name, got %q", reasons)
+	}
+}
+
+func TestValueCounter(t *testing.T) {
+	vc := newValueCounter(3)
+	for _, v := range []string{"a", "b", "a", "c", "a", "b", "a", "a", "b"} {
+		vc.add(v)
+	}
+	if vc.approximate {
+		t.Errorf("counter with %d distinct values is approximate, want exact", len(vc.entries))
+	}
+	// "d" replaces "c", the least frequent value, and inherits its count.
+	vc.add("d")
+	if !vc.approximate {
+		t.Errorf("counter is exact after exceeding capacity, want approximate")
+	}
+	type entry struct {
+		Value string
+		Count int
+	}
+	var got []entry
+	for _, e := range vc.mostCommon(5) {
+		got = append(got, entry{e.value, e.count})
+	}
+	want := []entry{{"a", 5}, {"b", 3}, {"d", 2}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mostCommon(5) unexpected diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestColumnStateDropsInviableTypes(t *testing.T) {
+	cs := newColumnState("x", &Options{})
+	for i := 0; i < minViabilitySamples; i++ {
+		cs.add("1")
+	}
+	for i := 0; i < minViabilitySamples; i++ {
+		cs.add("abc")
+	}
+	for _, c := range cs.candidates() {
+		if got := c.colType.protoType(); got != "string" {
+			t.Errorf("got candidate %s, want only string", got)
+		}
+	}
+	for _, is := range cs.inferrers {
+		if is.viable {
+			t.Errorf("inferrer for %v is still viable after %d values failed to parse", is.colType, minViabilitySamples)
+		}
+	}
+}
+
+func TestEvolve(t *testing.T) {
+	previous := &pb.RecordProtoMapping{
+		PackageName: "mypackage",
+		MessageName: "Order",
+		GoOptions:   &pb.GoOptions{GoPackageName: "orderconv", ProtoImport: "example.com/orderpb"},
+		ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+			{ColumnIndex: 0, ColName: "id", ProtoName: "order_id", ProtoType: "int32", ProtoTag: 1},
+			{ColumnIndex: 1, ColName: "name", ProtoName: "name", ProtoType: "string", ProtoTag: 2},
+			{ColumnIndex: 2, ColName: "legacy", ProtoName: "legacy", ProtoType: "string", ProtoTag: 3},
+			{ColumnIndex: 3, ColName: "score", ProtoName: "score", ProtoType: "double", ProtoTag: 4},
+			{ColumnIndex: 4, ColName: "status", ProtoName: "status", ProtoType: "Status", ProtoTag: 5},
+			{ColumnIndex: 5, ColName: "count", ProtoName: "count", ProtoType: "int64", ProtoTag: 8},
+		},
+		EnumDefinitions: []*pb.EnumDefinition{
+			{
+				EnumName: "Status",
+				Values: []*pb.EnumValueDefinition{
+					{ProtoName: "STATUS_ACTIVE", Number: 1, RawValues: []string{"active"}},
+					{ProtoName: "STATUS_CLOSED", Number: 2, RawValues: []string{"closed"}},
+				},
+			},
+		},
+		ReservedTags:  []int32{6},
+		ReservedNames: []string{"old"},
+	}
+	inferred := &pb.RecordProtoMapping{
+		PackageName: "inferredpackage",
+		MessageName: "MyMessage",
+		ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+			{ColumnIndex: 0, ColName: "name", ProtoName: "name", ProtoType: "string", ProtoTag: 1},
+			{ColumnIndex: 1, ColName: "id", ProtoName: "id", ProtoType: "int64", ProtoTag: 2},
+			{ColumnIndex: 2, ColName: "zip", ProtoName: "zip", ProtoType: "string", ProtoTag: 3},
+			{ColumnIndex: 3, ColName: "score", ProtoName: "score", ProtoType: "string", ProtoTag: 4},
+			{ColumnIndex: 4, ColName: "status", ProtoName: "status", ProtoType: "Status", ProtoTag: 5},
+			{ColumnIndex: 5, ColName: "old", ProtoName: "old", ProtoType: "bool", ProtoTag: 6},
+			{ColumnIndex: 6, ColName: "count", ProtoName: "count", ProtoType: "int32", ProtoTag: 7},
+		},
+		EnumDefinitions: []*pb.EnumDefinition{
+			{
+				EnumName: "Status",
+				Values: []*pb.EnumValueDefinition{
+					{ProtoName: "STATUS_PENDING", Number: 1, RawValues: []string{"pending"}},
+					{ProtoName: "STATUS_ACTIVE", Number: 2, RawValues: []string{"active", "ACTIVE"}},
+				},
+			},
+		},
+	}
+	want := &pb.RecordProtoMapping{
+		PackageName: "mypackage",
+		MessageName: "Order",
+		GoOptions:   &pb.GoOptions{GoPackageName: "orderconv", ProtoImport: "example.com/orderpb"},
+		ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+			{ColumnIndex: 0, ColName: "name", ProtoName: "name", ProtoType: "string", ProtoTag: 2},
+			{ColumnIndex: 1, ColName: "id", ProtoName: "order_id", ProtoType: "int64", ProtoTag: 1},
+			{ColumnIndex: 2, ColName: "zip", ProtoName: "zip", ProtoType: "string", ProtoTag: 7},
+			{ColumnIndex: 3, ColName: "score", ProtoName: "score", ProtoType: "double", ProtoTag: 4},
+			{ColumnIndex: 4, ColName: "status", ProtoName: "status", ProtoType: "Status", ProtoTag: 5},
+			{ColumnIndex: 5, ColName: "old", ProtoName: "old_2", ProtoType: "bool", ProtoTag: 9},
+			{ColumnIndex: 6, ColName: "count", ProtoName: "count", ProtoType: "int64", ProtoTag: 8},
+		},
+		EnumDefinitions: []*pb.EnumDefinition{
+			{
+				EnumName: "Status",
+				Values: []*pb.EnumValueDefinition{
+					{ProtoName: "STATUS_ACTIVE", Number: 1, RawValues: []string{"active", "ACTIVE"}},
+					{ProtoName: "STATUS_CLOSED", Number: 2, RawValues: []string{"closed"}},
+					{ProtoName: "STATUS_PENDING", Number: 3, RawValues: []string{"pending"}},
+				},
+			},
+		},
+		ReservedTags:  []int32{3, 6},
+		ReservedNames: []string{"legacy", "old"},
+	}
+	wantChanges := []*IncompatibleTypeChange{
+		{ColumnName: "score", ProtoName: "score", PreviousType: "double", InferredType: "string"},
+	}
+	got, gotChanges := Evolve(previous, inferred)
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("Evolve() unexpected mapping (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantChanges, gotChanges); diff != "" {
+		t.Errorf("Evolve() unexpected incompatible changes (-want, +got):\n%s", diff)
+	}
+}
+
+func TestEvolveTypeChanges(t *testing.T) {
+	for _, tt := range []struct {
+		previousType, inferredType string
+		wantType                   string
+		wantIncompatible           bool
+	}{
+		{"int32", "int64", "int64", false},
+		{"uint32", "uint64", "uint64", false},
+		{"int64", "int32", "int64", false},
+		{"int64", "uint32", "int64", false},
+		{"uint64", "uint32", "uint64", false},
+		{"double", "float", "double", false},
+		{"double", "int32", "double", false},
+		{"double", "int64", "double", false},
+		{"double", "uint32", "double", false},
+		{"double", "uint64", "double", false},
+		{"string", "bool", "string", false},
+		{"int64", "bool", "int64", true},
+		{"uint64", "bool", "uint64", true},
+		{"int32", "bool", "int32", true},
+		{"int64", "double", "int64", true},
+		{"uint64", "int64", "uint64", true},
+		{"bool", "string", "bool", true},
+	} {
+		previous := &pb.RecordProtoMapping{
+			ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+				{ColName: "x", ProtoName: "x", ProtoType: tt.previousType, ProtoTag: 1},
+			},
+		}
+		inferred := &pb.RecordProtoMapping{
+			ColumnToFieldMappings: []*pb.ColumnToFieldMapping{
+				{ColName: "x", ProtoName: "x", ProtoType: tt.inferredType, ProtoTag: 1},
+			},
+		}
+		got, changes := Evolve(previous, inferred)
+		if gotType := got.GetColumnToFieldMappings()[0].GetProtoType(); gotType != tt.wantType {
+			t.Errorf("Evolve(%s to %s) got type %s, want %s", tt.previousType, tt.inferredType, gotType, tt.wantType)
+		}
+		if gotIncompatible := len(changes) != 0; gotIncompatible != tt.wantIncompatible {
+			t.Errorf("Evolve(%s to %s) got incompatible changes %v, want incompatible %v", tt.previousType, tt.inferredType, changes, tt.wantIncompatible)
+		}
+	}
+}
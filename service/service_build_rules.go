@@ -0,0 +1,448 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/stoewer/go-strcase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	spb "github.com/google/xtoproto/proto/service"
+)
+
+// buildFileNames are the names of Bazel BUILD files in order of preference.
+var buildFileNames = []string{"BUILD.bazel", "BUILD"}
+
+// goLibraryName is the name of the go_library rule of a Go package, following the
+// convention used by Gazelle and the BUILD files of this repository.
+const goLibraryName = "go_default_library"
+
+// wellKnownProtoDeps maps the imports of generated .proto files to the proto_library
+// rules that provide them.
+var wellKnownProtoDeps = map[string]string{
+	"google/protobuf/duration.proto":  "@com_google_protobuf//:duration_proto",
+	"google/protobuf/timestamp.proto": "@com_google_protobuf//:timestamp_proto",
+}
+
+// converterDeps are the dependencies of every generated converter in addition to the
+// go_library of its proto. They are the same as those added by the
+// go_xtoproto_converter_library macro of bazel/defs.bzl.
+var converterDeps = []string{
+	"@org_golang_google_protobuf//proto:go_default_library",
+	"@xtoproto//csvcoder:go_default_library",
+	"@xtoproto//csvtoprotoparse:go_default_library",
+	"@xtoproto//protocp:go_default_library",
+	"@xtoproto//textcoder:go_default_library",
+}
+
+var protoImportPattern = regexp.MustCompile(`(?m)^import\s+(?:public\s+|weak\s+)?"([^"]+)"\s*;`)
+
+// buildLoad is a symbol that a BUILD file must load from a .bzl file.
+type buildLoad struct {
+	label, symbol string
+}
+
+// buildAttr is an attribute of a rule. Its value is a string or a []string.
+type buildAttr struct {
+	name  string
+	value interface{}
+}
+
+// buildRule is a rule to add to or update in a BUILD file. The first attribute is the
+// name.
+type buildRule struct {
+	kind  string
+	attrs []buildAttr
+	loads []buildLoad
+}
+
+func (r *buildRule) name() string {
+	return r.attrs[0].value.(string)
+}
+
+// buildFileEdits holds the contents of the BUILD files updated while handling a request,
+// so that a BUILD file shared by the .proto file and the converter is read once and
+// updated with both sets of rules.
+type buildFileEdits struct {
+	s        *service
+	req      *spb.GenerateCodeRequest
+	contents map[string][]byte
+}
+
+// update adds rules to the BUILD file of the workspace-relative directory dir, or updates
+// the rules of the same names. It returns the full path of the file and its new contents
+// without writing it.
+func (e *buildFileEdits) update(ctx context.Context, dir string, rules []*buildRule) (string, *spb.GenerateCodeResponse_File, error) {
+	fullPath, relPath, old, err := e.read(ctx, dir)
+	if err != nil {
+		return "", nil, err
+	}
+	newContents, err := updateBuildFile(relPath, old, rules)
+	if err != nil {
+		return "", nil, grpc.Errorf(codes.FailedPrecondition, "cannot update BUILD file %q: %v", relPath, err)
+	}
+	e.contents[fullPath] = newContents
+	return fullPath, &spb.GenerateCodeResponse_File{
+		WorkspaceRelativePath: relPath,
+		NewContents:           newContents,
+	}, nil
+}
+
+// read returns the path and contents of the BUILD file of a workspace-relative directory.
+// If there is no BUILD file, the contents are empty and the path is that of a new
+// BUILD.bazel file.
+func (e *buildFileEdits) read(ctx context.Context, dir string) (string, string, []byte, error) {
+	workspace := e.s.workspacePathForRequest(e.req)
+	for _, name := range buildFileNames {
+		fullPath, err := pathFromParts(workspace, dir, name)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if data, ok := e.contents[fullPath]; ok {
+			return fullPath, path.Join(dir, name), data, nil
+		}
+		data, err := e.s.readFile(ctx, fullPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", nil, fileErrToStatusErr(fullPath, err)
+		}
+		return fullPath, path.Join(dir, name), data, nil
+	}
+	fullPath, err := pathFromParts(workspace, dir, buildFileNames[0])
+	return fullPath, path.Join(dir, buildFileNames[0]), nil, err
+}
+
+// protoLibraryName returns the name of the proto_library rule of a proto package, as in
+// "mycompany_mypackage_proto".
+func protoLibraryName(protoPackage string) string {
+	if protoPackage == "" {
+		return "default_proto"
+	}
+	return strings.ReplaceAll(protoPackage, ".", "_") + "_proto"
+}
+
+// goProtoLibraryName returns the name of the go_proto_library rule of a proto package.
+func goProtoLibraryName(protoPackage string) string {
+	return strings.TrimSuffix(protoLibraryName(protoPackage), "_proto") + "_go_proto"
+}
+
+// protoBuildRules returns the rules of a generated .proto file: a proto_library, a
+// go_proto_library, and a go_default_library that embeds the go_proto_library, as in the
+// BUILD files of the examples directory.
+func protoBuildRules(req *spb.GenerateCodeRequest, protoFileName, protoCode string) []*buildRule {
+	pkg := req.GetMapping().GetPackageName()
+	importPath := req.GetMapping().GetGoOptions().GetProtoImport()
+	var deps []string
+	for _, m := range protoImportPattern.FindAllStringSubmatch(protoCode, -1) {
+		if dep, ok := wellKnownProtoDeps[m[1]]; ok {
+			deps = append(deps, dep)
+		}
+	}
+	protoAttrs := []buildAttr{
+		{"name", protoLibraryName(pkg)},
+		{"srcs", []string{protoFileName}},
+		{"visibility", []string{"//visibility:public"}},
+	}
+	if len(deps) != 0 {
+		protoAttrs = append(protoAttrs, buildAttr{"deps", deps})
+	}
+	return []*buildRule{
+		{
+			kind:  "proto_library",
+			attrs: protoAttrs,
+			loads: []buildLoad{{"@rules_proto//proto:defs.bzl", "proto_library"}},
+		},
+		{
+			kind: "go_proto_library",
+			attrs: []buildAttr{
+				{"name", goProtoLibraryName(pkg)},
+				{"importpath", importPath},
+				{"proto", ":" + protoLibraryName(pkg)},
+				{"visibility", []string{"//visibility:public"}},
+			},
+			loads: []buildLoad{{"@io_bazel_rules_go//proto:def.bzl", "go_proto_library"}},
+		},
+		{
+			kind: "go_library",
+			attrs: []buildAttr{
+				{"name", goLibraryName},
+				{"embed", []string{":" + goProtoLibraryName(pkg)}},
+				{"importpath", importPath},
+				{"visibility", []string{"//visibility:public"}},
+			},
+			loads: []buildLoad{{"@io_bazel_rules_go//go:def.bzl", "go_library"}},
+		},
+	}
+}
+
+// converterBuildRule returns the go_library rule of a generated converter. If the .proto
+// file is generated too, the rule depends on the go_library of the proto.
+func converterBuildRule(req *spb.GenerateCodeRequest, goFileName string) *buildRule {
+	importPath := converterImportPath(req)
+	deps := append([]string(nil), converterDeps...)
+	if req.GetProtoDefinition() != nil {
+		deps = append(deps, bazelLabel(req.GetConverter().GetDirectory(), req.GetProtoDefinition().GetDirectory(), goLibraryName))
+	}
+	sortLabels(deps)
+	return &buildRule{
+		kind: "go_library",
+		attrs: []buildAttr{
+			{"name", converterLibraryName(req)},
+			{"srcs", []string{goFileName}},
+			{"importpath", importPath},
+			{"visibility", []string{"//visibility:public"}},
+			{"deps", deps},
+		},
+		loads: []buildLoad{{"@io_bazel_rules_go//go:def.bzl", "go_library"}},
+	}
+}
+
+// converterLibraryName returns the name of the go_library rule of a generated converter.
+// It is go_default_library unless that is the name of the go_library of the proto in
+// the same directory, in which case it is the converter's package name.
+func converterLibraryName(req *spb.GenerateCodeRequest) string {
+	if req.GetProtoDefinition() != nil && path.Clean(req.GetProtoDefinition().GetDirectory()) == path.Clean(req.GetConverter().GetDirectory()) {
+		return converterPackageName(req)
+	}
+	return goLibraryName
+}
+
+// converterImportPath returns the Go import path of the converter. If the proto_import
+// ends with the directory of the .proto file, the converter's directory is resolved
+// relative to the same prefix. Otherwise the converter's directory is used. If that is
+// the import path of the generated proto, the converter's package name is appended.
+func converterImportPath(req *spb.GenerateCodeRequest) string {
+	converterDir := req.GetConverter().GetDirectory()
+	protoImport := req.GetMapping().GetGoOptions().GetProtoImport()
+	protoDir := req.GetProtoDefinition().GetDirectory()
+	prefix := ""
+	switch {
+	case protoDir != "" && (protoImport == protoDir || strings.HasSuffix(protoImport, "/"+protoDir)):
+		prefix = strings.TrimSuffix(strings.TrimSuffix(protoImport, protoDir), "/")
+	case protoDir == "" && req.GetProtoDefinition() != nil:
+		prefix = protoImport
+	}
+	importPath := path.Join(prefix, converterDir)
+	if importPath == "." || importPath == protoImport {
+		importPath = path.Join(strings.TrimSuffix(importPath, "."), converterPackageName(req))
+	}
+	return importPath
+}
+
+// converterPackageName returns the Go package name of the converter.
+func converterPackageName(req *spb.GenerateCodeRequest) string {
+	if name := req.GetMapping().GetGoOptions().GetGoPackageName(); name != "" {
+		return name
+	}
+	return strcase.SnakeCase(req.GetMapping().GetMessageName()) + "_converter"
+}
+
+// bazelLabel returns the label of a rule in the workspace-relative directory dir as
+// written in a BUILD file in fromDir.
+func bazelLabel(fromDir, dir, name string) string {
+	if path.Clean(fromDir) == path.Clean(dir) {
+		return ":" + name
+	}
+	dir = path.Clean(dir)
+	if dir == "." {
+		dir = ""
+	}
+	return fmt.Sprintf("//%s:%s", dir, name)
+}
+
+// updateBuildFile returns the contents of a BUILD file after adding the given rules and
+// the load statements they need. A rule with the same name as an existing rule updates
+// it: its kind and attributes are set, except that the visibility of the existing rule
+// is kept, and srcs and deps are added to its lists. srcs and deps that are not list
+// literals, such as globs, are left unchanged. Other attributes, rules, statements and
+// comments are kept.
+func updateBuildFile(fileName string, contents []byte, rules []*buildRule) ([]byte, error) {
+	f, err := build.ParseBuild(fileName, contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		for _, l := range r.loads {
+			addBuildLoad(f, l)
+		}
+		existing := findBuildRule(f, r.name())
+		if existing == nil {
+			call := &build.CallExpr{X: &build.Ident{Name: r.kind}}
+			rule := build.NewRule(call)
+			for _, a := range r.attrs {
+				rule.SetAttr(a.name, buildValue(a.value))
+			}
+			f.Stmt = append(f.Stmt, call)
+			continue
+		}
+		existing.SetKind(r.kind)
+		for _, a := range r.attrs {
+			old := existing.Attr(a.name)
+			switch {
+			case old == nil:
+				existing.SetAttr(a.name, buildValue(a.value))
+			case a.name == "name" || a.name == "visibility":
+			case a.name == "srcs" || a.name == "deps":
+				if list, ok := old.(*build.ListExpr); ok {
+					existing.SetAttr(a.name, mergeBuildList(list, a.value.([]string)))
+				}
+			default:
+				v := buildValue(a.value)
+				*v.Comment() = *old.Comment()
+				existing.SetAttr(a.name, v)
+			}
+		}
+	}
+	return build.FormatWithoutRewriting(f), nil
+}
+
+// findBuildRule returns the rule of a BUILD file with the given name, or nil.
+func findBuildRule(f *build.File, name string) *build.Rule {
+	for _, r := range f.Rules("") {
+		if r.Name() == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// buildValue returns the expression of an attribute value.
+func buildValue(v interface{}) build.Expr {
+	switch v := v.(type) {
+	case string:
+		return &build.StringExpr{Value: v}
+	case []string:
+		list := &build.ListExpr{ForceMultiLine: len(v) > 1}
+		for _, s := range v {
+			list.List = append(list.List, &build.StringExpr{Value: s})
+		}
+		return list
+	}
+	panic(fmt.Sprintf("unsupported BUILD attribute value %v", v))
+}
+
+// mergeBuildList returns a list with the elements of list followed by the values that it
+// does not already contain. If all the elements are strings, they are sorted with
+// sortLabels. The comments of the elements are kept.
+func mergeBuildList(list *build.ListExpr, values []string) *build.ListExpr {
+	out := &build.ListExpr{Comments: list.Comments, End: build.End{Comments: list.End.Comments}}
+	seen := map[string]bool{}
+	allStrings := true
+	for _, x := range list.List {
+		str, ok := x.(*build.StringExpr)
+		if !ok {
+			allStrings = false
+			out.List = append(out.List, x)
+			continue
+		}
+		seen[str.Value] = true
+		// A copy without a position, so that the printer formats the list as a new one.
+		out.List = append(out.List, &build.StringExpr{Comments: str.Comments, Value: str.Value})
+	}
+	for _, s := range values {
+		if !seen[s] {
+			seen[s] = true
+			out.List = append(out.List, &build.StringExpr{Value: s})
+		}
+	}
+	if allStrings {
+		sort.SliceStable(out.List, func(i, j int) bool {
+			return labelLess(out.List[i].(*build.StringExpr).Value, out.List[j].(*build.StringExpr).Value)
+		})
+	}
+	out.ForceMultiLine = len(out.List) > 1
+	return out
+}
+
+// sortLabels sorts labels the way buildifier sorts the elements of srcs and deps.
+func sortLabels(labels []string) {
+	sort.SliceStable(labels, func(i, j int) bool { return labelLess(labels[i], labels[j]) })
+}
+
+// labelLess reports whether label a comes before label b in the order in which buildifier
+// sorts the elements of srcs and deps: labels in the same package first, then labels in
+// the workspace, then external labels.
+func labelLess(a, b string) bool {
+	rank := func(label string) int {
+		switch {
+		case strings.HasPrefix(label, ":"):
+			return 0
+		case strings.HasPrefix(label, "//"):
+			return 1
+		case strings.HasPrefix(label, "@"):
+			return 2
+		}
+		return -1
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+// addBuildLoad adds a load statement for a symbol to a BUILD file unless it is already
+// loaded. The symbol is added to an existing load statement of the same label if there
+// is one. Otherwise a new load statement follows the last one, or the comments at the
+// start of the file if there are no load statements.
+func addBuildLoad(f *build.File, l buildLoad) {
+	var sameLabel *build.LoadStmt
+	lastLoad := -1
+	for i, stmt := range f.Stmt {
+		load, ok := stmt.(*build.LoadStmt)
+		if !ok {
+			continue
+		}
+		for _, to := range load.To {
+			if to.Name == l.symbol {
+				return
+			}
+		}
+		if load.Module.Value == l.label {
+			sameLabel = load
+		}
+		lastLoad = i
+	}
+	if sameLabel != nil {
+		i := sort.Search(len(sameLabel.To), func(i int) bool { return sameLabel.To[i].Name > l.symbol })
+		sameLabel.From = append(sameLabel.From[:i], append([]*build.Ident{{Name: l.symbol}}, sameLabel.From[i:]...)...)
+		sameLabel.To = append(sameLabel.To[:i], append([]*build.Ident{{Name: l.symbol}}, sameLabel.To[i:]...)...)
+		return
+	}
+	load := &build.LoadStmt{
+		Module:       &build.StringExpr{Value: l.label},
+		From:         []*build.Ident{{Name: l.symbol}},
+		To:           []*build.Ident{{Name: l.symbol}},
+		ForceCompact: true,
+	}
+	i := lastLoad + 1
+	if lastLoad < 0 && len(f.Stmt) != 0 {
+		if _, ok := f.Stmt[0].(*build.CommentBlock); ok {
+			i = 1
+		}
+	}
+	f.Stmt = append(f.Stmt[:i], append([]build.Expr{load}, f.Stmt[i:]...)...)
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+
+	"github.com/google/xtoproto/recordinfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	spb "github.com/google/xtoproto/proto/service"
+)
+
+// EvolveMapping merges an inferred mapping into a previous mapping. See the definition of
+// EvolveMappingRequest in service.proto for more details.
+func (s *service) EvolveMapping(ctx context.Context, req *spb.EvolveMappingRequest) (*spb.EvolveMappingResponse, error) {
+	if req.GetPreviousMapping() == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing previous mapping")
+	}
+	if req.GetInferredMapping() == nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing inferred mapping")
+	}
+	mapping, changes := recordinfer.Evolve(req.GetPreviousMapping(), req.GetInferredMapping())
+	resp := &spb.EvolveMappingResponse{Mapping: mapping}
+	for _, c := range changes {
+		resp.IncompatibleTypeChanges = append(resp.IncompatibleTypeChanges, &spb.IncompatibleTypeChange{
+			ColName:      c.ColumnName,
+			ProtoName:    c.ProtoName,
+			PreviousType: c.PreviousType,
+			InferredType: c.InferredType,
+		})
+	}
+	return resp, nil
+}
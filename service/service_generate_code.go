@@ -35,53 +35,76 @@ func (s *service) GenerateCode(ctx context.Context, req *spb.GenerateCodeRequest
 		return nil, grpc.Errorf(codes.InvalidArgument, "missing input mapping")
 	}
 
-	// TODO(reddaly): Support the use case where the mapping .pbtxt file is stored
-	// in the repository as the basis for the bazel rule that produces the
-	// .proto file. In that case, we need to merge the request mapping with the
-	// mapping in the repo.
+	// The mapping is used as is. When the mapping is stored in the repository as
+	// the basis for the bazel rule that produces the .proto file, callers merge
+	// a new inference result into it with EvolveMapping before generating code.
 
 	genProto := req.GetProtoDefinition() != nil
 	genGo := req.GetConverter() != nil
-	protoCode, goCode, err := csvtoproto.GenerateCode(req.GetMapping(), genProto, genGo)
+	protoCode, goCode, err := csvtoproto.GenerateCodeWithAdditionalMappings(req.GetMapping(), req.GetAdditionalMappings(), genProto, genGo)
 	if err != nil {
 		return nil, grpc.Errorf(codes.InvalidArgument, "failed to generate code: %v", err)
 	}
 
-	var outputProtoFile *spb.GenerateCodeResponse_File
+	buildFiles := &buildFileEdits{s, req, map[string][]byte{}}
+	out := &outputWriter{s: s, policy: req.GetWritePolicy()}
+	var outputProtoFile, outputProtoBuildFile *spb.GenerateCodeResponse_File
 	if genProto {
 		codePath, codePathWSRelative, err := s.protoPath(req)
 		if err != nil {
 			return nil, grpc.Errorf(codes.InvalidArgument, "invalid output specification for .proto file: %v", err)
 		}
-		// TODO(reddaly): Consider configurable overwrite behavior.
-		if err := s.writeFile(ctx, codePath, []byte(protoCode)); err != nil {
-			return nil, fileErrToStatusErr(codePath, err)
-		}
 		outputProtoFile = &spb.GenerateCodeResponse_File{
 			WorkspaceRelativePath: codePathWSRelative,
 			NewContents:           []byte(protoCode),
 		}
+		if err := out.addGenerated(ctx, codePath, outputProtoFile); err != nil {
+			return nil, err
+		}
+		if req.GetProtoDefinition().GetUpdateBuildRules() {
+			buildPath, buildFile, err := buildFiles.update(ctx, req.GetProtoDefinition().GetDirectory(), protoBuildRules(req, path.Base(codePath), protoCode))
+			if err != nil {
+				return nil, err
+			}
+			if err := out.addBuildFile(ctx, buildPath, buildFile); err != nil {
+				return nil, err
+			}
+			outputProtoBuildFile = buildFile
+		}
 	}
-	var outputGoFile *spb.GenerateCodeResponse_File
+	var outputGoFile, outputConverterBuildFile *spb.GenerateCodeResponse_File
 	if genGo {
 		codePath, codePathWSRelative, err := s.converterGoPath(req)
 		if err != nil {
 			return nil, grpc.Errorf(codes.InvalidArgument, "invalid output specification for .go file: %v", err)
 		}
-		// TODO(reddaly): Consider configurable overwrite behavior.
-		if err := s.writeFile(ctx, codePath, []byte(goCode)); err != nil {
-			return nil, fileErrToStatusErr(codePath, err)
-		}
 		outputGoFile = &spb.GenerateCodeResponse_File{
 			WorkspaceRelativePath: codePathWSRelative,
 			NewContents:           []byte(goCode),
 		}
+		if err := out.addGenerated(ctx, codePath, outputGoFile); err != nil {
+			return nil, err
+		}
+		if req.GetConverter().GetUpdateBuildRules() {
+			buildPath, buildFile, err := buildFiles.update(ctx, req.GetConverter().GetDirectory(), []*buildRule{converterBuildRule(req, path.Base(codePath))})
+			if err != nil {
+				return nil, err
+			}
+			if err := out.addBuildFile(ctx, buildPath, buildFile); err != nil {
+				return nil, err
+			}
+			outputConverterBuildFile = buildFile
+		}
+	}
+	if err := out.flush(ctx); err != nil {
+		return nil, err
 	}
-	// TODO(reddaly): Update BUILD rule.
 
 	return &spb.GenerateCodeResponse{
-		ProtoFile:       outputProtoFile,
-		ConverterGoFile: outputGoFile,
+		ProtoFile:          outputProtoFile,
+		ProtoBuildFile:     outputProtoBuildFile,
+		ConverterGoFile:    outputGoFile,
+		ConverterBuildFile: outputConverterBuildFile,
 	}, nil
 }
 
@@ -15,6 +15,7 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"time"
@@ -30,6 +31,9 @@ import (
 // Infer infers a proto definition from a record-oriented data source. See the
 // definition of InferRequest in service.proto for more details.
 func (s *service) Infer(ctx context.Context, req *spb.InferRequest) (*spb.InferResponse, error) {
+	if req.GetInputFormat() == spb.Format_XML {
+		return s.inferXML(ctx, req)
+	}
 
 	tz := time.UTC
 	if req.GetTimestampLocation() != "" {
@@ -45,35 +49,98 @@ func (s *service) Infer(ctx context.Context, req *spb.InferRequest) (*spb.InferR
 		GoPackageName:     req.GetGoPackageName(),
 		GoProtoImport:     req.GetGoProtoImport(),
 		TimestampLocation: tz,
+		NullValues:        req.GetNullValues(),
+		TrueValues:        req.GetTrueValues(),
+		FalseValues:       req.GetFalseValues(),
+		CSVDialect:        req.GetCsvDialect(),
+	}
+	if req.GetDisableNullDetection() {
+		if len(req.GetNullValues()) != 0 {
+			return nil, grpc.Errorf(codes.InvalidArgument, "null_values must be empty if disable_null_detection is true, got %q", req.GetNullValues())
+		}
+		opts.NullValues = []string{}
+	}
+	if !req.GetDisableEnumInference() {
+		opts.EnumOptions = recordinfer.DefaultEnumOptions
+	}
+	if no := req.GetNumberOptions(); no != nil {
+		opts.NumberOptions = &recordinfer.NumberOptions{
+			Headroom:           no.GetHeadroom(),
+			NarrowIntegers:     no.GetNarrowIntegers(),
+			Unsigned:           no.GetUnsignedIntegers(),
+			AllowFloatRounding: no.GetAllowFloatRounding(),
+		}
 	}
 
 	if got := len(req.GetExampleInputs()); got != 1 {
 		return nil, grpc.Errorf(codes.InvalidArgument, "must provide exactly one entry in example_inputs, got %d", got)
 	}
-	input := req.GetExampleInputs()[0]
-	var exampleBytes []byte
+	exampleBytes, err := s.readExampleInput(ctx, req.GetExampleInputs()[0])
+	if err != nil {
+		return nil, err
+	}
+
+	numCandidates := int(req.GetMaxMappingCandidates())
+	if numCandidates < 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "max_mapping_candidates must not be negative, got %d", numCandidates)
+	}
+	candidates, err := csvinfer.InferProtoCandidatesFromReader(bytes.NewReader(exampleBytes), maxInt(numCandidates, 1), opts)
+	if err != nil {
+		return nil, grpc.Errorf(codes.Unknown, "failed to infer proto definition: %v", err)
+	}
+
+	resp := &spb.InferResponse{
+		BestMappingCandidate: &spb.MappingSet{
+			TopLevelMapping: candidates[0].Mapping(),
+		},
+	}
+	if numCandidates > 0 {
+		for _, ip := range candidates {
+			resp.RankedMappingCandidates = append(resp.RankedMappingCandidates, rankedMappingSet(ip))
+		}
+	}
+	return resp, nil
+}
+
+// readExampleInput returns the contents of an example input file.
+func (s *service) readExampleInput(ctx context.Context, input *spb.InputFile) ([]byte, error) {
 	if len(input.GetInputContent()) != 0 {
-		exampleBytes = input.GetInputContent()
-	} else if input.GetInputPath() != "" {
+		return input.GetInputContent(), nil
+	}
+	if input.GetInputPath() != "" {
 		contents, err := s.readFile(ctx, input.GetInputPath())
 		if err != nil {
 			return nil, fileErrToStatusErr(input.GetInputPath(), err)
 		}
-		exampleBytes = contents
-	} else {
-		return nil, grpc.Errorf(codes.InvalidArgument, "missing supported input content spec")
+		return contents, nil
 	}
+	return nil, grpc.Errorf(codes.InvalidArgument, "missing supported input content spec")
+}
 
-	ip, err := csvinfer.InferProto(string(exampleBytes), opts)
-	if err != nil {
-		return nil, grpc.Errorf(codes.Unknown, "failed to infer proto definition: %v", err)
+// rankedMappingSet returns a MappingSet for an inferred proto that includes
+// scoring details.
+func rankedMappingSet(ip *recordinfer.InferredProto) *spb.MappingSet {
+	ms := &spb.MappingSet{
+		TopLevelMapping: ip.Mapping(),
+		Confidence:      ip.Confidence(),
 	}
+	for _, ci := range ip.ColumnInferences() {
+		ms.ColumnInferences = append(ms.ColumnInferences, &spb.ColumnInference{
+			ColumnIndex: int32(ci.ColumnIndex),
+			ColName:     ci.ColumnName,
+			ProtoType:   ci.ProtoType,
+			Confidence:  ci.Confidence,
+			Reasons:     ci.Reasons,
+		})
+	}
+	return ms
+}
 
-	return &spb.InferResponse{
-		BestMappingCandidate: &spb.MappingSet{
-			TopLevelMapping: ip.Mapping(),
-		},
-	}, nil
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 func fileErrToStatusErr(path string, err error) error {
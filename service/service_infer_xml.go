@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+
+	"github.com/google/xtoproto/xmlinfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	rpb "github.com/google/xtoproto/proto/recordtoproto"
+	spb "github.com/google/xtoproto/proto/service"
+)
+
+// inferXML infers messages from XML example inputs.
+func (s *service) inferXML(ctx context.Context, req *spb.InferRequest) (*spb.InferResponse, error) {
+	if len(req.GetExampleInputs()) == 0 {
+		return nil, grpc.Errorf(codes.InvalidArgument, "must provide at least one entry in example_inputs")
+	}
+	var decoders multiTokenReader
+	for _, input := range req.GetExampleInputs() {
+		exampleBytes, err := s.readExampleInput(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		decoders = append(decoders, xml.NewDecoder(bytes.NewReader(exampleBytes)))
+	}
+	result, err := xmlinfer.Infer(&decoders)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "failed to infer proto definition from XML: %v", err)
+	}
+	mappings, err := result.Mappings()
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "failed to infer proto definition from XML: %v", err)
+	}
+	for _, m := range mappings {
+		m.PackageName = req.GetPackageName()
+		m.GoOptions = &rpb.GoOptions{
+			GoPackageName: req.GetGoPackageName(),
+			ProtoImport:   req.GetGoProtoImport(),
+		}
+	}
+	if req.GetMessageName() != "" {
+		mappings[0].MessageName = req.GetMessageName()
+	}
+	return &spb.InferResponse{
+		BestMappingCandidate: &spb.MappingSet{
+			TopLevelMapping:    mappings[0],
+			AdditionalMappings: mappings[1:],
+		},
+	}, nil
+}
+
+// multiTokenReader reads the tokens of several XML documents in order.
+type multiTokenReader []xml.TokenReader
+
+func (m *multiTokenReader) Token() (xml.Token, error) {
+	for len(*m) != 0 {
+		tok, err := (*m)[0].Token()
+		if err == io.EOF {
+			*m = (*m)[1:]
+			continue
+		}
+		return tok, err
+	}
+	return nil, io.EOF
+}
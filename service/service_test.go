@@ -16,11 +16,16 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/testing/protocmp"
 
 	pb "github.com/google/xtoproto/proto/recordtoproto"
@@ -98,6 +103,108 @@ func Test_service_Infer(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "null detection disabled",
+			s:    unimplementedFileSysService,
+			req: &spb.InferRequest{
+				ExampleInputs: []*spb.InputFile{
+					makeInputFile([]byte("a,b\n1,thing\nNA,other\n")),
+				},
+				InputFormat:          spb.Format_CSV,
+				MessageName:          "MyMessage",
+				GoPackageName:        "my_message_converter",
+				GoProtoImport:        "path/to/my_message_go_proto",
+				PackageName:          "my_package",
+				DisableEnumInference: true,
+				DisableNullDetection: true,
+			},
+			want: &spb.InferResponse{
+				BestMappingCandidate: &spb.MappingSet{
+					TopLevelMapping: &rpb.RecordProtoMapping{
+						PackageName: "my_package",
+						MessageName: "MyMessage",
+						GoOptions: &rpb.GoOptions{
+							GoPackageName: "my_message_converter",
+							ProtoImport:   "path/to/my_message_go_proto",
+						},
+						ColumnToFieldMappings: []*rpb.ColumnToFieldMapping{
+							{ColName: "a", ProtoName: "a", ProtoType: "string", ProtoTag: 1},
+							{ColName: "b", ProtoName: "b", ProtoType: "string", ProtoTag: 2, ColumnIndex: 1},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "null values with null detection disabled should cause an error",
+			s:    unimplementedFileSysService,
+			req: &spb.InferRequest{
+				ExampleInputs: []*spb.InputFile{
+					makeInputFile([]byte("a,b\n1,thing\n")),
+				},
+				InputFormat:          spb.Format_CSV,
+				NullValues:           []string{"NA"},
+				DisableNullDetection: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "xml with nested elements",
+			s:    unimplementedFileSysService,
+			req: &spb.InferRequest{
+				ExampleInputs: []*spb.InputFile{
+					makeInputFile([]byte(`<?xml version="1.0"?><order id="1"><item sku="a"><qty>2</qty></item><item sku="b"><qty>1</qty></item></order>`)),
+					makeInputFile([]byte(`<order id="2"><item sku="c"><qty>1.5</qty></item><note>gift</note></order>`)),
+				},
+				InputFormat:   spb.Format_XML,
+				MessageName:   "MyOrder",
+				GoPackageName: "my_order_converter",
+				GoProtoImport: "path/to/my_order_go_proto",
+				PackageName:   "my_package",
+			},
+			want: &spb.InferResponse{
+				BestMappingCandidate: &spb.MappingSet{
+					TopLevelMapping: &rpb.RecordProtoMapping{
+						PackageName: "my_package",
+						MessageName: "MyOrder",
+						GoOptions: &rpb.GoOptions{
+							GoPackageName: "my_order_converter",
+							ProtoImport:   "path/to/my_order_go_proto",
+						},
+						ExtraFieldDefinitions: []*rpb.FieldDefinition{
+							{ProtoName: "id", ProtoType: "int64", ProtoTag: 1},
+							{ProtoName: "item", ProtoType: "Item", ProtoTag: 2, Repeated: true},
+							{ProtoName: "note", ProtoType: "string", ProtoTag: 3},
+						},
+					},
+					AdditionalMappings: []*rpb.RecordProtoMapping{
+						{
+							PackageName: "my_package",
+							MessageName: "Item",
+							GoOptions: &rpb.GoOptions{
+								GoPackageName: "my_order_converter",
+								ProtoImport:   "path/to/my_order_go_proto",
+							},
+							ExtraFieldDefinitions: []*rpb.FieldDefinition{
+								{ProtoName: "sku", ProtoType: "string", ProtoTag: 1},
+								{ProtoName: "qty", ProtoType: "double", ProtoTag: 2},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "xml without attributes or child elements",
+			s:    unimplementedFileSysService,
+			req: &spb.InferRequest{
+				ExampleInputs: []*spb.InputFile{
+					makeInputFile([]byte(`<note>hello</note>`)),
+				},
+				InputFormat: spb.Format_XML,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -107,7 +214,8 @@ func Test_service_Infer(t *testing.T) {
 				return
 			}
 			if diff := cmp.Diff(tt.want, got, protocmp.Transform(), cmpopts.EquateEmpty(),
-				protocmp.IgnoreFields(proto.MessageV2(&pb.ColumnToFieldMapping{}), "comment")); diff != "" {
+				protocmp.IgnoreFields(proto.MessageV2(&pb.ColumnToFieldMapping{}), "comment"),
+				protocmp.IgnoreFields(proto.MessageV2(&pb.FieldDefinition{}), "comment")); diff != "" {
 				t.Errorf("uexpected diff in service.Infer results (-want,+got): %s", diff)
 			}
 		})
@@ -162,9 +270,15 @@ func Test_service_GenerateCode(t *testing.T) {
 					WorkspaceRelativePath: "code-path/proto/hello-world.proto",
 					NewContents:           []byte(""),
 				},
+				ProtoBuildFile: &spb.GenerateCodeResponse_File{
+					WorkspaceRelativePath: "code-path/proto/BUILD.bazel",
+				},
 				ConverterGoFile: &spb.GenerateCodeResponse_File{
 					WorkspaceRelativePath: "converters/my_message.go",
 				},
+				ConverterBuildFile: &spb.GenerateCodeResponse_File{
+					WorkspaceRelativePath: "converters/BUILD.bazel",
+				},
 			},
 			false,
 		},
@@ -184,6 +298,558 @@ func Test_service_GenerateCode(t *testing.T) {
 	}
 }
 
+func Test_service_GenerateCode_buildFiles(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"/ws/generated/BUILD": `# Rules for generated code.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "my_message_test",
+    srcs = ["my_message_test.go"],
+)
+`,
+	}
+	s := &service{
+		defaultWorkspaceDir: "/ws",
+		readFile: func(ctx context.Context, path string) ([]byte, error) {
+			data, ok := files[path]
+			if !ok {
+				return nil, fmt.Errorf("no file %q: %w", path, os.ErrNotExist)
+			}
+			return []byte(data), nil
+		},
+		writeFile: func(ctx context.Context, path string, data []byte) error {
+			files[path] = string(data)
+			return nil
+		},
+	}
+	mapping := proto.Clone(abMapping).(*rpb.RecordProtoMapping)
+	mapping.GoOptions.ProtoImport = "example.com/project/generated"
+	mapping.ColumnToFieldMappings[0].ProtoType = "google.protobuf.Duration"
+	_, err := s.GenerateCode(ctx, &spb.GenerateCodeRequest{
+		Mapping: mapping,
+		ProtoDefinition: &spb.GenerateCodeRequest_ProtoDefinition{
+			Directory:        "generated",
+			UpdateBuildRules: true,
+		},
+		Converter: &spb.GenerateCodeRequest_Converter{
+			Directory:        "generated",
+			UpdateBuildRules: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateCode() error: %v", err)
+	}
+	if _, ok := files["/ws/generated/BUILD.bazel"]; ok {
+		t.Errorf("GenerateCode() created BUILD.bazel next to an existing BUILD file")
+	}
+	want := `# Rules for generated code.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+load("@rules_proto//proto:defs.bzl", "proto_library")
+load("@io_bazel_rules_go//proto:def.bzl", "go_proto_library")
+
+go_test(
+    name = "my_message_test",
+    srcs = ["my_message_test.go"],
+)
+
+proto_library(
+    name = "my_package_proto",
+    srcs = ["my_message.proto"],
+    visibility = ["//visibility:public"],
+    deps = ["@com_google_protobuf//:duration_proto"],
+)
+
+go_proto_library(
+    name = "my_package_go_proto",
+    importpath = "example.com/project/generated",
+    proto = ":my_package_proto",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "go_default_library",
+    embed = [":my_package_go_proto"],
+    importpath = "example.com/project/generated",
+    visibility = ["//visibility:public"],
+)
+
+go_library(
+    name = "my_message_converter",
+    srcs = ["my_message.go"],
+    importpath = "example.com/project/generated/my_message_converter",
+    visibility = ["//visibility:public"],
+    deps = [
+        ":go_default_library",
+        "@org_golang_google_protobuf//proto:go_default_library",
+        "@xtoproto//csvcoder:go_default_library",
+        "@xtoproto//csvtoprotoparse:go_default_library",
+        "@xtoproto//protocp:go_default_library",
+        "@xtoproto//textcoder:go_default_library",
+    ],
+)
+`
+	if diff := cmp.Diff(want, files["/ws/generated/BUILD"]); diff != "" {
+		t.Errorf("unexpected BUILD file (-want, +got):\n%s", diff)
+	}
+}
+
+func Test_service_GenerateCode_additionalMappings(t *testing.T) {
+	ctx := context.Background()
+	s := &service{
+		defaultWorkspaceDir: "/ws",
+		writeFile: func(ctx context.Context, path string, data []byte) error {
+			return nil
+		},
+	}
+	got, err := s.GenerateCode(ctx, &spb.GenerateCodeRequest{
+		Mapping: &rpb.RecordProtoMapping{
+			PackageName: "my_package",
+			MessageName: "Order",
+			ExtraFieldDefinitions: []*rpb.FieldDefinition{
+				{ProtoName: "item", ProtoType: "Item", ProtoTag: 1, Repeated: true},
+			},
+		},
+		AdditionalMappings: []*rpb.RecordProtoMapping{
+			{
+				PackageName: "my_package",
+				MessageName: "Item",
+				ExtraFieldDefinitions: []*rpb.FieldDefinition{
+					{ProtoName: "sku", ProtoType: "string", ProtoTag: 1},
+				},
+			},
+		},
+		ProtoDefinition: &spb.GenerateCodeRequest_ProtoDefinition{},
+	})
+	if err != nil {
+		t.Fatalf("GenerateCode() error: %v", err)
+	}
+	want := `message Order {
+  repeated Item item = 1;
+}
+
+message Item {
+  string sku = 1;
+}
+`
+	if got := string(got.GetProtoFile().GetNewContents()); !strings.HasSuffix(got, want) {
+		t.Errorf("GenerateCode() returned .proto file\n%s\nwant suffix\n%s", got, want)
+	}
+}
+
+func Test_service_GenerateCode_writePolicy(t *testing.T) {
+	ctx := context.Background()
+	const (
+		protoPath = "/ws/generated/my_message.proto"
+		goPath    = "/ws/generated/my_message.go"
+		buildPath = "/ws/generated/BUILD.bazel"
+	)
+	handWritten := "// Hand written.\n"
+	generated := "// Code generated by xtoproto. DO NOT EDIT.\n\nsyntax = \"proto3\";\n"
+	tests := []struct {
+		name      string
+		policy    spb.GenerateCodeRequest_WritePolicy
+		files     map[string]string
+		wantCode  codes.Code
+		wantWrite bool
+		wantDiffs bool
+	}{
+		{
+			name:      "always overwrites hand written file",
+			policy:    spb.GenerateCodeRequest_OVERWRITE_ALWAYS,
+			files:     map[string]string{protoPath: handWritten},
+			wantWrite: true,
+		},
+		{
+			name:      "never writes missing files",
+			policy:    spb.GenerateCodeRequest_OVERWRITE_NEVER,
+			wantWrite: true,
+		},
+		{
+			name:     "never refuses existing file",
+			policy:   spb.GenerateCodeRequest_OVERWRITE_NEVER,
+			files:    map[string]string{goPath: generated},
+			wantCode: codes.AlreadyExists,
+		},
+		{
+			name:      "generated overwrites generated file",
+			policy:    spb.GenerateCodeRequest_OVERWRITE_GENERATED,
+			files:     map[string]string{protoPath: generated},
+			wantWrite: true,
+		},
+		{
+			name:     "generated refuses hand written file",
+			policy:   spb.GenerateCodeRequest_OVERWRITE_GENERATED,
+			files:    map[string]string{goPath: handWritten},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "generated refuses file of another generator",
+			policy:   spb.GenerateCodeRequest_OVERWRITE_GENERATED,
+			files:    map[string]string{goPath: "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage generated\n"},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "generated refuses marker after code",
+			policy:   spb.GenerateCodeRequest_OVERWRITE_GENERATED,
+			files:    map[string]string{goPath: "package generated\n\nconst marker = `\n// Code generated by xtoproto. DO NOT EDIT.\n`\n"},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:      "generated overwrites legacy generated file",
+			policy:    spb.GenerateCodeRequest_OVERWRITE_GENERATED,
+			files:     map[string]string{protoPath: "// This file was generated using xtoproto.\n\nsyntax = \"proto3\";\n"},
+			wantWrite: true,
+		},
+		{
+			name:      "dry run writes nothing",
+			policy:    spb.GenerateCodeRequest_DRY_RUN,
+			files:     map[string]string{protoPath: handWritten},
+			wantDiffs: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			for k, v := range tt.files {
+				files[k] = v
+			}
+			var written []string
+			s := &service{
+				defaultWorkspaceDir: "/ws",
+				readFile: func(ctx context.Context, path string) ([]byte, error) {
+					data, ok := files[path]
+					if !ok {
+						return nil, fmt.Errorf("no file %q: %w", path, os.ErrNotExist)
+					}
+					return []byte(data), nil
+				},
+				writeFile: func(ctx context.Context, path string, data []byte) error {
+					written = append(written, path)
+					files[path] = string(data)
+					return nil
+				},
+			}
+			got, err := s.GenerateCode(ctx, &spb.GenerateCodeRequest{
+				Mapping:     abMapping,
+				WritePolicy: tt.policy,
+				ProtoDefinition: &spb.GenerateCodeRequest_ProtoDefinition{
+					Directory:        "generated",
+					UpdateBuildRules: true,
+				},
+				Converter: &spb.GenerateCodeRequest_Converter{
+					Directory:        "generated",
+					UpdateBuildRules: true,
+				},
+			})
+			if gotCode := status.Code(err); gotCode != tt.wantCode {
+				t.Fatalf("GenerateCode() error = %v, want code %v", err, tt.wantCode)
+			}
+			var wantWritten []string
+			if tt.wantWrite {
+				wantWritten = []string{protoPath, buildPath, goPath}
+			}
+			if diff := cmp.Diff(wantWritten, written, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("unexpected written files (-want, +got):\n%s", diff)
+			}
+			if err != nil {
+				return
+			}
+			if got.GetProtoBuildFile() != got.GetConverterBuildFile() && !proto.Equal(got.GetProtoBuildFile(), got.GetConverterBuildFile()) {
+				t.Errorf("GenerateCode() returned different contents for a shared BUILD file: %v and %v", got.GetProtoBuildFile(), got.GetConverterBuildFile())
+			}
+			for _, f := range []*spb.GenerateCodeResponse_File{got.GetProtoFile(), got.GetProtoBuildFile(), got.GetConverterGoFile(), got.GetConverterBuildFile()} {
+				if gotDiff := f.GetUnifiedDiff() != ""; gotDiff != tt.wantDiffs {
+					t.Errorf("file %q has unified diff %q, want diff = %v", f.GetWorkspaceRelativePath(), f.GetUnifiedDiff(), tt.wantDiffs)
+				}
+			}
+			if tt.wantDiffs {
+				wantPrefix := "--- a/generated/my_message.proto\n+++ b/generated/my_message.proto\n@@ -1 +1,"
+				if got := got.GetProtoFile().GetUnifiedDiff(); !strings.HasPrefix(got, wantPrefix) {
+					t.Errorf("unexpected diff of existing file, want prefix %q:\n%s", wantPrefix, got)
+				}
+				wantPrefix = "--- /dev/null\n+++ b/generated/my_message.go\n@@ -0,0 +1,"
+				if got := got.GetConverterGoFile().GetUnifiedDiff(); !strings.HasPrefix(got, wantPrefix) {
+					t.Errorf("unexpected diff of new file, want prefix %q:\n%s", wantPrefix, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_service_EvolveMapping(t *testing.T) {
+	ctx := context.Background()
+	s := &service{}
+	if _, err := s.EvolveMapping(ctx, &spb.EvolveMappingRequest{InferredMapping: abMapping}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("EvolveMapping() without previous mapping error = %v, want InvalidArgument", err)
+	}
+	inferred := proto.Clone(abMapping).(*rpb.RecordProtoMapping)
+	inferred.ColumnToFieldMappings = []*rpb.ColumnToFieldMapping{
+		{ColumnIndex: 0, ColName: "b", ProtoName: "b", ProtoType: "int64", ProtoTag: 1},
+		{ColumnIndex: 1, ColName: "c", ProtoName: "c", ProtoType: "string", ProtoTag: 2},
+	}
+	got, err := s.EvolveMapping(ctx, &spb.EvolveMappingRequest{
+		PreviousMapping: abMapping,
+		InferredMapping: inferred,
+	})
+	if err != nil {
+		t.Fatalf("EvolveMapping() error: %v", err)
+	}
+	want := &spb.EvolveMappingResponse{
+		Mapping: &rpb.RecordProtoMapping{
+			GoOptions:   abMapping.GetGoOptions(),
+			MessageName: "MyMessage",
+			PackageName: "my_package",
+			ColumnToFieldMappings: []*rpb.ColumnToFieldMapping{
+				{ColumnIndex: 0, ColName: "b", ProtoName: "b", ProtoType: "string", ProtoTag: 2},
+				{ColumnIndex: 1, ColName: "c", ProtoName: "c", ProtoType: "string", ProtoTag: 3},
+			},
+			ReservedTags:  []int32{1},
+			ReservedNames: []string{"a"},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected diff in service.EvolveMapping results (-want,+got): %s", diff)
+	}
+}
+
+func Test_unifiedDiff(t *testing.T) {
+	tests := []struct {
+		name             string
+		oldName, oldText string
+		newText          string
+		want             string
+	}{
+		{
+			name:    "equal",
+			oldName: "a/f",
+			oldText: "x\n",
+			newText: "x\n",
+			want:    "",
+		},
+		{
+			name:    "new file",
+			newText: "x\ny\n",
+			want:    "--- /dev/null\n+++ b/f\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			name:    "separate hunks",
+			oldName: "a/f",
+			oldText: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			newText: "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			want: `--- a/f
++++ b/f
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`,
+		},
+		{
+			name:    "missing final newline",
+			oldName: "a/f",
+			oldText: "a\nb",
+			newText: "a\nc\n",
+			want:    "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff(tt.oldName, "b/f", tt.oldText, tt.newText)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unifiedDiff() unexpected result (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_converterBuildRule(t *testing.T) {
+	req := &spb.GenerateCodeRequest{
+		Mapping:         abMapping,
+		ProtoDefinition: &spb.GenerateCodeRequest_ProtoDefinition{Directory: "protos"},
+		Converter:       &spb.GenerateCodeRequest_Converter{Directory: "converters/my_message"},
+	}
+	got := converterBuildRule(req, "my_message.go")
+	want := &buildRule{
+		kind: "go_library",
+		attrs: []buildAttr{
+			{"name", "go_default_library"},
+			{"srcs", []string{"my_message.go"}},
+			{"importpath", "converters/my_message"},
+			{"visibility", []string{"//visibility:public"}},
+			{"deps", []string{
+				"//protos:go_default_library",
+				"@org_golang_google_protobuf//proto:go_default_library",
+				"@xtoproto//csvcoder:go_default_library",
+				"@xtoproto//csvtoprotoparse:go_default_library",
+				"@xtoproto//protocp:go_default_library",
+				"@xtoproto//textcoder:go_default_library",
+			}},
+		},
+		loads: []buildLoad{{"@io_bazel_rules_go//go:def.bzl", "go_library"}},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(buildRule{}, buildAttr{}, buildLoad{})); diff != "" {
+		t.Errorf("converterBuildRule() unexpected rule (-want, +got):\n%s", diff)
+	}
+}
+
+func Test_updateBuildFile(t *testing.T) {
+	rule := &buildRule{
+		kind: "go_library",
+		attrs: []buildAttr{
+			{"name", "go_default_library"},
+			{"srcs", []string{"conv.go"}},
+			{"importpath", "example.com/conv"},
+			{"visibility", []string{"//visibility:public"}},
+			{"deps", []string{"@xtoproto//csvcoder:go_default_library"}},
+		},
+		loads: []buildLoad{{"@io_bazel_rules_go//go:def.bzl", "go_library"}},
+	}
+	for _, tt := range []struct {
+		name     string
+		contents string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "new file",
+			contents: "",
+			want: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["conv.go"],
+    importpath = "example.com/conv",
+    visibility = ["//visibility:public"],
+    deps = ["@xtoproto//csvcoder:go_default_library"],
+)
+`,
+		},
+		{
+			name: "existing rule keeps comments, extra attributes, srcs and deps",
+			contents: `# Copyright notice.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+# The converter.
+go_library(
+    name = "go_default_library",  # Named by convention.
+    srcs = [
+        "conv.go",
+        # Hand-written helpers.
+        "helpers.go",
+    ],
+    importpath = "example.com/old",  # Moved.
+    # Only the server may use the converter.
+    visibility = ["//server:__pkg__"],
+    deps = [
+        "//util:go_default_library",  # keep
+        # Needed by helpers.go.
+        "//strings:go_default_library",
+    ],
+    testonly = True,
+)
+
+exports_files(["data.csv"])  # Used by tests (see "conv").
+`,
+			want: `# Copyright notice.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+# The converter.
+go_library(
+    name = "go_default_library",  # Named by convention.
+    srcs = [
+        "conv.go",
+        # Hand-written helpers.
+        "helpers.go",
+    ],
+    importpath = "example.com/conv",  # Moved.
+    # Only the server may use the converter.
+    visibility = ["//server:__pkg__"],
+    deps = [
+        # Needed by helpers.go.
+        "//strings:go_default_library",
+        "//util:go_default_library",  # keep
+        "@xtoproto//csvcoder:go_default_library",
+    ],
+    testonly = True,
+)
+
+exports_files(["data.csv"])  # Used by tests (see "conv").
+`,
+		},
+		{
+			name: "single element list becomes multiline",
+			contents: `go_library(
+    name = "go_default_library",
+    srcs = glob(["*.go"]),
+    deps = ["//util:go_default_library"],
+)
+`,
+			want: `load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = glob(["*.go"]),
+    deps = [
+        "//util:go_default_library",
+        "@xtoproto//csvcoder:go_default_library",
+    ],
+    importpath = "example.com/conv",
+    visibility = ["//visibility:public"],
+)
+`,
+		},
+		{
+			name: "load after leading comments",
+			contents: `# Generated data.
+
+exports_files(["data.csv"])
+`,
+			want: `# Generated data.
+
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+exports_files(["data.csv"])
+
+go_library(
+    name = "go_default_library",
+    srcs = ["conv.go"],
+    importpath = "example.com/conv",
+    visibility = ["//visibility:public"],
+    deps = ["@xtoproto//csvcoder:go_default_library"],
+)
+`,
+		},
+		{
+			name:     "syntax error",
+			contents: "go_library(\n",
+			wantErr:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := updateBuildFile("BUILD.bazel", []byte(tt.contents), []*buildRule{rule})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateBuildFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Errorf("updateBuildFile() unexpected diff (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func makeInputFile(content []byte) *spb.InputFile {
 	f := &spb.InputFile{
 		Spec: &spb.InputFile_InputContent{InputContent: content},
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/google/xtoproto/csvtoproto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	spb "github.com/google/xtoproto/proto/service"
+)
+
+// pendingWrite is an output file of GenerateCode that has been checked against the write
+// policy but not yet written.
+type pendingWrite struct {
+	fullPath string
+	file     *spb.GenerateCodeResponse_File
+}
+
+// outputWriter writes the outputs of GenerateCode according to a write policy. Outputs
+// are written only after all of them have been checked, so a request that the policy
+// forbids writes nothing.
+type outputWriter struct {
+	s       *service
+	policy  spb.GenerateCodeRequest_WritePolicy
+	pending []*pendingWrite
+}
+
+// addGenerated checks that a generated .proto or .go file may be written and adds it to
+// the pending writes.
+func (w *outputWriter) addGenerated(ctx context.Context, fullPath string, file *spb.GenerateCodeResponse_File) error {
+	if w.policy == spb.GenerateCodeRequest_OVERWRITE_ALWAYS {
+		w.add(fullPath, file)
+		return nil
+	}
+	old, exists, err := w.readExisting(ctx, fullPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+	case w.policy == spb.GenerateCodeRequest_OVERWRITE_NEVER:
+		return grpc.Errorf(codes.AlreadyExists, "not overwriting existing file %q because the write policy is %v", file.GetWorkspaceRelativePath(), w.policy)
+	case w.policy == spb.GenerateCodeRequest_OVERWRITE_GENERATED && !csvtoproto.HasGeneratedCodeMarker(old):
+		return grpc.Errorf(codes.FailedPrecondition, "not overwriting existing file %q because it has no generated code marker %q", file.GetWorkspaceRelativePath(), csvtoproto.GeneratedCodeMarker)
+	}
+	w.setDiff(file, old, exists)
+	w.add(fullPath, file)
+	return nil
+}
+
+// addBuildFile adds an edited BUILD file to the pending writes. Any earlier pending
+// write of the same file is replaced, and the response file of that write is updated
+// to the new contents.
+func (w *outputWriter) addBuildFile(ctx context.Context, fullPath string, file *spb.GenerateCodeResponse_File) error {
+	if w.policy == spb.GenerateCodeRequest_DRY_RUN {
+		old, exists, err := w.readExisting(ctx, fullPath)
+		if err != nil {
+			return err
+		}
+		w.setDiff(file, old, exists)
+	}
+	for _, p := range w.pending {
+		if p.fullPath == fullPath {
+			p.file.NewContents, p.file.UnifiedDiff = file.GetNewContents(), file.GetUnifiedDiff()
+			p.file = file
+			return nil
+		}
+	}
+	w.add(fullPath, file)
+	return nil
+}
+
+func (w *outputWriter) add(fullPath string, file *spb.GenerateCodeResponse_File) {
+	w.pending = append(w.pending, &pendingWrite{fullPath, file})
+}
+
+// setDiff sets the unified diff of a file if the policy is DRY_RUN.
+func (w *outputWriter) setDiff(file *spb.GenerateCodeResponse_File, old []byte, exists bool) {
+	if w.policy != spb.GenerateCodeRequest_DRY_RUN {
+		return
+	}
+	oldName := ""
+	if exists {
+		oldName = "a/" + file.GetWorkspaceRelativePath()
+	}
+	file.UnifiedDiff = unifiedDiff(oldName, "b/"+file.GetWorkspaceRelativePath(), string(old), string(file.GetNewContents()))
+}
+
+// readExisting returns the contents of a file and whether it exists.
+func (w *outputWriter) readExisting(ctx context.Context, fullPath string) ([]byte, bool, error) {
+	data, err := w.s.readFile(ctx, fullPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fileErrToStatusErr(fullPath, err)
+	}
+	return data, true, nil
+}
+
+// flush writes the pending files unless the policy is DRY_RUN.
+func (w *outputWriter) flush(ctx context.Context) error {
+	if w.policy == spb.GenerateCodeRequest_DRY_RUN {
+		return nil
+	}
+	for _, p := range w.pending {
+		if err := w.s.writeFile(ctx, p.fullPath, p.file.GetNewContents()); err != nil {
+			return fileErrToStatusErr(p.fullPath, err)
+		}
+	}
+	return nil
+}
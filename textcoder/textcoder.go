@@ -38,13 +38,24 @@
 // limitations of Go's reflect package, which does not support obtaining the
 // underlying type of a named type, this functionality is limited to types with
 // an underlying basic type (see https://github.com/golang/go/issues/39574).
+// Other named types, such as `type myTime time.Time`, may reuse the coder of
+// another type using RegisterAlias.
 //
-// Currently the registry does not attempt to find registered coders based on
-// registered interface types. While coders may be registered for an interface
-// type, that coder only be returned then the reflect.Type of the interface is
-// used to obtain a Coder, Encoder, or Decoder; the coder will not be returned
-// if a coder is requested of a type that implements the registered interface.
-// This behavior is likely to change in the future.
+// Slices and maps whose element types have coders are encoded as delimited
+// lists like "a,b,c" and "k=v;k2=v2". The delimiters may be changed with
+// Context.WithSliceDelimiter and Context.WithMapDelimiters.
+//
+// Floats are rounded to six decimal places by default. Use
+// Context.WithExactFloats to format them with the fewest digits that parse back
+// to the same value.
+//
+// Coders may be registered for an interface type. If a type T is not explicitly
+// registered, the registry uses the coder of a registered interface that T or
+// *T implements. If T implements several registered interfaces, the interface
+// with the highest priority (see Registry.SetInterfacePriority) is used, and
+// interfaces with the same priority are ordered by registration. Interface
+// coders take precedence over the encoding.TextMarshaler and basic type rules
+// described above. The interface used for each type is resolved once and cached.
 //
 // The types string, int, uint, float64, float32, uint8, int8, uint16, int16,
 // uint32, int32, uint64, and int64 have coders registered in the default
@@ -61,6 +72,7 @@ import (
 	"encoding"
 	"fmt"
 	"reflect"
+	"sync"
 )
 
 var (
@@ -82,8 +94,9 @@ var (
 	}()
 )
 
-// T is used in place of interface{} to represent a templated type. When go adds
-// generics, we can revisit the API.
+// T is used in place of interface{} to represent a templated type in the
+// reflection-based API. See RegisterFunc, MarshalTyped, and UnmarshalTyped for
+// the type-parameterized API.
 type T = interface{}
 
 // Encoder encodes an argument of type T into a string.
@@ -117,14 +130,20 @@ type coderMap = map[reflect.Type]*registryEntry
 // Registry is a set of registered text coders.
 //
 // Typically users will use the default registry, but creating a specialized
-// Registry object is fully supported.
+// Registry object is fully supported. A Registry is safe for concurrent use by
+// multiple goroutines.
 type Registry struct {
+	mu     sync.RWMutex
 	coders coderMap
+	// interfaces are the registered interface types, ordered by precedence.
+	interfaces []*interfaceEntry
+	// interfaceCoders caches the result of getInterfaceCoder for each type.
+	interfaceCoders map[reflect.Type]*interfaceCoder
 }
 
 // NewRegistry returns a new object for registring text coders.
 func NewRegistry() *Registry {
-	return &Registry{make(coderMap)}
+	return &Registry{coders: make(coderMap), interfaceCoders: make(map[reflect.Type]*interfaceCoder)}
 }
 
 // NewContext returns a new context that uses this registry for textual encoding
@@ -163,23 +182,36 @@ func (r *Registry) Register(t reflect.Type, encoder, decoder interface{}) error
 // 1. If the type is explicitly registered because of a previous call to
 // r.Register(t), r.GetDecoder(t) will return that decoder.
 //
-// 2. If the type implements encoding.TextUnmarshaler interface, GetDecoder(t)
+// 2. If the type or a pointer to the type implements a registered interface
+// type, GetDecoder(t) returns a decoder based on the interface's decoder.
+//
+// 3. If the type implements encoding.TextUnmarshaler interface, GetDecoder(t)
 // returns an decoder that dispatches to UnmarshalText.
 //
-// 3. If the type has an underlying type that is a basic type (bool, int,
+// 4. If the type has an underlying type that is a basic type (bool, int,
 // string, uint, uint8, float32, etc.), GetDecoder(t) will return a decoder for
 // t based on the underlying type.
+//
+// 5. If the type is a slice or map type and its element types (or key and
+// value types) have decoders, GetDecoder(t) returns a composite decoder. See
+// GetCoder.
 func (r *Registry) GetDecoder(t reflect.Type) Decoder {
 	explicit := r.getExplicit(t)
 	if explicit != nil {
 		return explicit
 	}
+	if ic := r.getInterfaceCoder(t); ic != nil {
+		return ic
+	}
 	if reflect.PtrTo(t).Implements(textUnmarshalerInterface) {
 		return &textEncodingCoder{}
 	}
 	if basicCoder, _ := r.getEntryForUnderlying(t); basicCoder != nil {
 		return r.GetCoder(t)
 	}
+	if cc := r.getCompositeCoder(t, false, true); cc != nil {
+		return cc
+	}
 	return nil
 }
 
@@ -191,23 +223,36 @@ func (r *Registry) GetDecoder(t reflect.Type) Decoder {
 // 1. If the type is explicitly registered because of a previous call to
 // r.Register(t), r.GetEncoder(t) will return that encoder.
 //
-// 2. If the type implements encoding.TextMarshaler interface, GetEncoder(t)
+// 2. If the type or a pointer to the type implements a registered interface
+// type, GetEncoder(t) returns an encoder based on the interface's encoder.
+//
+// 3. If the type implements encoding.TextMarshaler interface, GetEncoder(t)
 // returns an encoder that dispatches to MarshalText.
 //
-// 3. If the type has an underlying type that is a basic type (bool, int,
+// 4. If the type has an underlying type that is a basic type (bool, int,
 // string, uint, uint8, float32, etc.), GetEncoder(t) will return a encoder for
 // t based on the underlying type.
+//
+// 5. If the type is a slice or map type and its element types (or key and
+// value types) have encoders, GetEncoder(t) returns a composite encoder. See
+// GetCoder.
 func (r *Registry) GetEncoder(t reflect.Type) Encoder {
 	explicit := r.getExplicit(t)
 	if explicit != nil {
 		return explicit
 	}
+	if ic := r.getInterfaceCoder(t); ic != nil {
+		return ic
+	}
 	if reflect.PtrTo(t).Implements(textMarshalerInterface) {
 		return &textEncodingCoder{}
 	}
 	if basicCoder, _ := r.getEntryForUnderlying(t); basicCoder != nil {
 		return r.GetCoder(t)
 	}
+	if cc := r.getCompositeCoder(t, true, false); cc != nil {
+		return cc
+	}
 	return nil
 }
 
@@ -221,23 +266,30 @@ func (r *Registry) GetEncoder(t reflect.Type) Encoder {
 // 1. If the type is explicitly registered because of a previous call to
 // r.Register(t), r.GetCoder(t) will return that coder.
 //
-// 2. If the type implements encoding.TextUnmarshaler and encoding.TextMarshaler
+// 2. If the type or a pointer to the type implements an interface type with a
+// registered coder, GetCoder(t) returns a coder that dispatches to the coder of
+// that interface. If several registered interfaces match, the interface with
+// the highest priority is used; ties are resolved by registration order.
+//
+// 3. If the type implements encoding.TextUnmarshaler and encoding.TextMarshaler
 // interface, GetCoder(t) returns a Decoder that dispatches to those methods.
 //
-// 3. If the type has an underlying type that is a basic type (bool, int,
+// 4. If the type has an underlying type that is a basic type (bool, int,
 // string, uint, uint8, float32, etc.), GetCoder(t) will return a coder for T
 // based on the underlying type. This allows types like `type distance float64`
 // to use float64's Coder. Due to limitations of Go's reflect package, which
 // does not support obtaining the underlying type of a named type, this
 // functionality is limited to types with an underlying basic type (see
-// https://github.com/golang/go/issues/39574).
+// https://github.com/golang/go/issues/39574). Use RegisterAlias for other named
+// types.
 //
-// Currently the registry does not attempt to find registered coders based on
-// registered interface types. While coders may be registered for an interface
-// type, that coder only be returned then the reflect.Type of the interface is
-// used to obtain a Coder, Encoder, or Decoder; the coder will not be returned
-// if a coder is requested of a type that implements the registered interface.
-// This behavior is likely to change in the future.
+// 5. If the type is a slice type whose element type has a coder, GetCoder(t)
+// returns a coder that separates the elements with "," or the delimiter set by
+// Context.WithSliceDelimiter. If the type is a map type whose key and value
+// types have coders, GetCoder(t) returns a coder for text like "k=v;k2=v2"
+// with entries sorted by key, or the delimiters set by
+// Context.WithMapDelimiters. An empty string is an empty slice or map, and
+// encoding fails if an encoded element contains a delimiter.
 //
 // The types string, int, uint, float64, float32, uint8, int8, uint16, int16,
 // uint32, int32, uint64, and int64 have coders registered in the default
@@ -251,6 +303,9 @@ func (r *Registry) GetCoder(t reflect.Type) Coder {
 	if explicit != nil {
 		return explicit
 	}
+	if ic := r.getInterfaceCoder(t); ic != nil {
+		return ic
+	}
 	tPtr := reflect.PtrTo(t)
 	if tPtr.Implements(textUnmarshalerInterface) && tPtr.Implements(textMarshalerInterface) {
 		return &textEncodingCoder{}
@@ -270,14 +325,21 @@ func (r *Registry) GetCoder(t reflect.Type) Coder {
 			},
 		}
 	}
+	if cc := r.getCompositeCoder(t, true, true); cc != nil {
+		return cc
+	}
 	return nil
 }
 
 func (r *Registry) getExplicit(t reflect.Type) *registryEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.coders[t]
 }
 
 func (r *Registry) setExplicit(t reflect.Type, e *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.coders[t] = e
 }
 
@@ -370,6 +432,9 @@ func Unmarshal(value string, dst T) error {
 }
 
 // UnmarshalContext is like Unmarshal, but it takes an extra context argument.
+// The decoder is looked up in the context's registry using the dynamic type of
+// dst, so UnmarshalContext may be used when the type is not known at compile
+// time.
 //
 // To use a registered coder of type T, dst should be of type *T.
 func UnmarshalContext(ctx *Context, value string, dst T) error {
@@ -377,20 +442,21 @@ func UnmarshalContext(ctx *Context, value string, dst T) error {
 	if t.Kind() != reflect.Ptr {
 		return fmt.Errorf("Unmarshal requires a pointer argument, got type %v", t)
 	}
-	dec := DefaultRegistry().GetDecoder(t.Elem())
+	dec := ctx.Registry().GetDecoder(t.Elem())
 	if dec == nil {
 		return fmt.Errorf("no registered decoder for type %v", t)
 	}
-	return dec.DecodeText(NewContext(), value, dst)
+	return dec.DecodeText(ctx, value, dst)
 }
 
 // MarshalContext attempts to encode the value into a string using one of the
-// default registered coders.
+// coders registered in the context's registry. The encoder is looked up using
+// the dynamic type of value.
 //
 // To use a registered coder of type T, value should be of type T.
 func MarshalContext(ctx *Context, value T) (string, error) {
 	t := reflect.TypeOf(value)
-	e := DefaultRegistry().GetEncoder(t)
+	e := ctx.Registry().GetEncoder(t)
 	if e == nil {
 		return "", fmt.Errorf("no encoder registered of type %v", t)
 	}
@@ -454,6 +520,12 @@ func register(r *Registry, t reflect.Type, encoder, decoder interface{}) error {
 		return err
 	}
 
+	r.setEntry(t, encFn, decFn)
+	return nil
+}
+
+// setEntry registers the encoding and decoding functions for type t.
+func (r *Registry) setEntry(t reflect.Type, encFn func(*Context, T) (string, error), decFn func(*Context, string, T) error) {
 	// Rather than completely overwrite the entry, keep it so that existing
 	// references to it are not invalidated.
 	existing := r.getExplicit(t)
@@ -463,7 +535,9 @@ func register(r *Registry, t reflect.Type, encoder, decoder interface{}) error {
 	}
 	existing.decode = decFn
 	existing.encode = encFn
-	return nil
+	if t.Kind() == reflect.Interface {
+		r.addInterface(t, existing)
+	}
 }
 
 func createEncoderFn(t reflect.Type, encoder reflect.Value) (func(_ *Context, value interface{}) (string, error), error) {
@@ -584,6 +658,12 @@ func (c *textEncodingCoder) DecodeText(_ *Context, text string, dst T) error {
 
 func (c *textEncodingCoder) EncodeText(_ *Context, value T) (string, error) {
 	m, ok := value.(encoding.TextMarshaler)
+	if !ok && value != nil {
+		// MarshalText may have a pointer receiver.
+		ptr := reflect.New(reflect.TypeOf(value))
+		ptr.Elem().Set(reflect.ValueOf(value))
+		m, ok = ptr.Interface().(encoding.TextMarshaler)
+	}
 	if !ok {
 		return "", fmt.Errorf("value does not implement encoding.TextMarshaler: %v of type %v", value, reflect.TypeOf(value))
 	}
@@ -173,7 +173,7 @@ func RegisterBasicTypes(r *Registry) error {
 	// float32, float64
 	putErr(r.Register(
 		reflect.TypeOf(float64(0)),
-		func(v float64) (string, error) { return fmt.Sprintf("%f", v), nil },
+		func(ctx *Context, v float64) (string, error) { return formatFloat(ctx, v, 64), nil },
 		func(value string, dst *float64) error {
 			f, err := strconv.ParseFloat(value, 64)
 			if err != nil {
@@ -184,7 +184,7 @@ func RegisterBasicTypes(r *Registry) error {
 		}))
 	putErr(r.Register(
 		reflect.TypeOf(float32(0)),
-		func(v float32) (string, error) { return fmt.Sprintf("%f", v), nil },
+		func(ctx *Context, v float32) (string, error) { return formatFloat(ctx, float64(v), 32), nil },
 		func(value string, dst *float32) error {
 			f, err := strconv.ParseFloat(value, 32)
 			if err != nil {
@@ -209,3 +209,23 @@ func RegisterBasicTypes(r *Registry) error {
 	}
 	return nil
 }
+
+const exactFloatsKey = "textcoder.exactFloats"
+
+// WithExactFloats returns a new context in which the float32 and float64 coders
+// registered by RegisterBasicTypes format values with the fewest digits that
+// parse back to the same value, such as "0.1234567891", instead of rounding
+// them to six decimal places as fmt.Sprintf("%f") does.
+func (c *Context) WithExactFloats() *Context {
+	return c.WithValue(exactFloatsKey, true)
+}
+
+// formatFloat formats a float of the given bit size according to the context.
+func formatFloat(ctx *Context, v float64, bitSize int) string {
+	if ctx != nil {
+		if exact, _ := ctx.Value(exactFloatsKey); exact == true {
+			return strconv.FormatFloat(v, 'f', -1, bitSize)
+		}
+	}
+	return fmt.Sprintf("%f", v)
+}
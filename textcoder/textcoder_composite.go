@@ -0,0 +1,285 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textcoder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	sliceDelimiterKey       = "textcoder.sliceDelimiter"
+	mapEntryDelimiterKey    = "textcoder.mapEntryDelimiter"
+	mapKeyValueDelimiterKey = "textcoder.mapKeyValueDelimiter"
+
+	defaultSliceDelimiter       = ","
+	defaultMapEntryDelimiter    = ";"
+	defaultMapKeyValueDelimiter = "="
+)
+
+// RegisterAlias registers a coder for newType that converts values to and from
+// existingType and uses the coder of existingType. The types must be
+// convertible to each other using reflect.Value.Convert, as is the case for
+// `type myTime time.Time` and time.Time.
+//
+// The coder of existingType is looked up each time a value is encoded or
+// decoded, so later registrations for existingType also apply to newType.
+func (r *Registry) RegisterAlias(newType, existingType reflect.Type) error {
+	if !newType.ConvertibleTo(existingType) || !existingType.ConvertibleTo(newType) {
+		return fmt.Errorf("cannot alias %v to %v: the types are not convertible", newType, existingType)
+	}
+	if r.GetCoder(existingType) == nil {
+		return fmt.Errorf("cannot alias %v to %v: no coder for %v", newType, existingType, existingType)
+	}
+	r.setEntry(newType,
+		func(ctx *Context, value T) (string, error) {
+			enc := r.GetEncoder(existingType)
+			if enc == nil {
+				return "", fmt.Errorf("no encoder for %v, the alias of %v", existingType, newType)
+			}
+			return enc.EncodeText(ctx, reflect.ValueOf(value).Convert(existingType).Interface())
+		},
+		func(ctx *Context, text string, dst T) error {
+			dec := r.GetDecoder(existingType)
+			if dec == nil {
+				return fmt.Errorf("no decoder for %v, the alias of %v", existingType, newType)
+			}
+			existing := reflect.New(existingType)
+			if err := dec.DecodeText(ctx, text, existing.Interface()); err != nil {
+				return err
+			}
+			reflect.ValueOf(dst).Elem().Set(existing.Elem().Convert(newType))
+			return nil
+		})
+	return nil
+}
+
+// RegisterAlias calls RegisterAlias on the default registry.
+func RegisterAlias(newType, existingType reflect.Type) error {
+	return DefaultRegistry().RegisterAlias(newType, existingType)
+}
+
+// WithSliceDelimiter returns a new context in which slices are encoded with
+// their elements separated by delim. The default delimiter is ",".
+func (c *Context) WithSliceDelimiter(delim string) *Context {
+	return c.WithValue(sliceDelimiterKey, delim)
+}
+
+// WithMapDelimiters returns a new context in which maps are encoded with their
+// entries separated by entryDelim and each key separated from its value by
+// keyValueDelim. The defaults are ";" and "=", as in "k=v;k2=v2".
+func (c *Context) WithMapDelimiters(entryDelim, keyValueDelim string) *Context {
+	return c.WithValue(mapEntryDelimiterKey, entryDelim).WithValue(mapKeyValueDelimiterKey, keyValueDelim)
+}
+
+// stringValue returns the string value associated with key, or def if there is none. The
+// context may be nil.
+func (c *Context) stringValue(key, def string) string {
+	if c == nil {
+		return def
+	}
+	if v, ok := c.Value(key); ok {
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	return def
+}
+
+// getCompositeCoder returns a coder for a slice or map type whose element types have
+// coders, or nil. If needEncoder or needDecoder is false, the element types need not have
+// encoders or decoders respectively.
+func (r *Registry) getCompositeCoder(t reflect.Type, needEncoder, needDecoder bool) Coder {
+	elems := elemTypes(t)
+	if elems == nil || containsType(t, t, map[reflect.Type]bool{}) {
+		return nil
+	}
+	var coders []*elemCoder
+	for _, et := range elems {
+		ec := &elemCoder{}
+		if needEncoder {
+			if ec.enc = r.GetEncoder(et); ec.enc == nil {
+				return nil
+			}
+		}
+		if needDecoder {
+			if ec.dec = r.GetDecoder(et); ec.dec == nil {
+				return nil
+			}
+		}
+		coders = append(coders, ec)
+	}
+	if t.Kind() == reflect.Slice {
+		return &sliceCoder{t, coders[0]}
+	}
+	return &mapCoder{t, coders[0], coders[1]}
+}
+
+// elemTypes returns the element types of a slice type or the key and value types of a map
+// type. It returns nil for other types.
+func elemTypes(t reflect.Type) []reflect.Type {
+	switch t.Kind() {
+	case reflect.Slice:
+		return []reflect.Type{t.Elem()}
+	case reflect.Map:
+		return []reflect.Type{t.Key(), t.Elem()}
+	}
+	return nil
+}
+
+// containsType reports whether the element types of slice or map type t, or their element
+// types, include target. This prevents unbounded recursion when looking up coders for
+// recursive types such as `type tree map[string]tree`.
+func containsType(t, target reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	for _, et := range elemTypes(t) {
+		if et == target || containsType(et, target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// elemCoder encodes and decodes the elements of a composite type. Either field may be nil
+// if it is not needed.
+type elemCoder struct {
+	enc Encoder
+	dec Decoder
+}
+
+func (ec *elemCoder) encode(ctx *Context, v reflect.Value, delims ...string) (string, error) {
+	if ec.enc == nil {
+		return "", fmt.Errorf("no encoder for %v", v.Type())
+	}
+	text, err := ec.enc.EncodeText(ctx, v.Interface())
+	if err != nil {
+		return "", err
+	}
+	for _, d := range delims {
+		if strings.Contains(text, d) {
+			return "", fmt.Errorf("encoded value %q contains the delimiter %q", text, d)
+		}
+	}
+	return text, nil
+}
+
+func (ec *elemCoder) decode(ctx *Context, text string, t reflect.Type) (reflect.Value, error) {
+	if ec.dec == nil {
+		return reflect.Value{}, fmt.Errorf("no decoder for %v", t)
+	}
+	v := reflect.New(t)
+	if err := ec.dec.DecodeText(ctx, text, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// sliceCoder encodes slices as delimiter-separated elements. An empty string is an empty
+// slice.
+type sliceCoder struct {
+	t    reflect.Type
+	elem *elemCoder
+}
+
+func (c *sliceCoder) EncodeText(ctx *Context, value T) (string, error) {
+	delim := ctx.stringValue(sliceDelimiterKey, defaultSliceDelimiter)
+	v := reflect.ValueOf(value)
+	var parts []string
+	for i := 0; i < v.Len(); i++ {
+		text, err := c.elem.encode(ctx, v.Index(i), delim)
+		if err != nil {
+			return "", fmt.Errorf("error encoding element %d of %v: %w", i, c.t, err)
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, delim), nil
+}
+
+func (c *sliceCoder) DecodeText(ctx *Context, text string, dst T) error {
+	delim := ctx.stringValue(sliceDelimiterKey, defaultSliceDelimiter)
+	out := reflect.MakeSlice(c.t, 0, 0)
+	if text != "" {
+		for i, part := range strings.Split(text, delim) {
+			v, err := c.elem.decode(ctx, part, c.t.Elem())
+			if err != nil {
+				return fmt.Errorf("error decoding element %d of %v: %w", i, c.t, err)
+			}
+			out = reflect.Append(out, v)
+		}
+	}
+	reflect.ValueOf(dst).Elem().Set(out)
+	return nil
+}
+
+// mapCoder encodes maps as delimiter-separated key-value pairs, ordered by encoded key. An
+// empty string is an empty map.
+type mapCoder struct {
+	t          reflect.Type
+	key, value *elemCoder
+}
+
+func (c *mapCoder) EncodeText(ctx *Context, value T) (string, error) {
+	entryDelim := ctx.stringValue(mapEntryDelimiterKey, defaultMapEntryDelimiter)
+	kvDelim := ctx.stringValue(mapKeyValueDelimiterKey, defaultMapKeyValueDelimiter)
+	v := reflect.ValueOf(value)
+	var entries []string
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := c.key.encode(ctx, iter.Key(), entryDelim, kvDelim)
+		if err != nil {
+			return "", fmt.Errorf("error encoding key of %v: %w", c.t, err)
+		}
+		val, err := c.value.encode(ctx, iter.Value(), entryDelim)
+		if err != nil {
+			return "", fmt.Errorf("error encoding value of key %q of %v: %w", k, c.t, err)
+		}
+		entries = append(entries, k+kvDelim+val)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, entryDelim), nil
+}
+
+func (c *mapCoder) DecodeText(ctx *Context, text string, dst T) error {
+	entryDelim := ctx.stringValue(mapEntryDelimiterKey, defaultMapEntryDelimiter)
+	kvDelim := ctx.stringValue(mapKeyValueDelimiterKey, defaultMapKeyValueDelimiter)
+	out := reflect.MakeMap(c.t)
+	if text != "" {
+		for _, entry := range strings.Split(text, entryDelim) {
+			kv := strings.SplitN(entry, kvDelim, 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("entry %q of %v has no %q separating the key and value", entry, c.t, kvDelim)
+			}
+			k, err := c.key.decode(ctx, kv[0], c.t.Key())
+			if err != nil {
+				return fmt.Errorf("error decoding key %q of %v: %w", kv[0], c.t, err)
+			}
+			if out.MapIndex(k).IsValid() {
+				return fmt.Errorf("duplicate key %q in %v", kv[0], c.t)
+			}
+			v, err := c.value.decode(ctx, kv[1], c.t.Elem())
+			if err != nil {
+				return fmt.Errorf("error decoding value of key %q of %v: %w", kv[0], c.t, err)
+			}
+			out.SetMapIndex(k, v)
+		}
+	}
+	reflect.ValueOf(dst).Elem().Set(out)
+	return nil
+}
@@ -100,6 +100,38 @@ func Example_b() {
 	// error: got 4 values, want 3
 }
 
+func ExampleRegisterFunc() {
+	type point struct{ x, y int64 }
+
+	// The compiler checks that the functions take a point and a *point.
+	RegisterFunc(DefaultRegistry(),
+		func(_ *Context, v point) (string, error) {
+			return fmt.Sprintf("%d,%d", v.x, v.y), nil
+		},
+		func(_ *Context, s string, dst *point) error {
+			ints, err := splitAndParseInts(s)
+			if err != nil {
+				return err
+			}
+			if len(ints) != 2 {
+				return fmt.Errorf("got %d values, want 2", len(ints))
+			}
+			dst.x, dst.y = ints[0], ints[1]
+			return nil
+		})
+
+	var p point
+	err := UnmarshalTyped("3, 4", &p)
+	fmt.Printf("%+v, err = %v\n", p, err != nil)
+
+	s, err := MarshalTyped(point{5, 6})
+	fmt.Printf("%q, err = %v\n", s, err != nil)
+
+	// Output:
+	// {x:3 y:4}, err = false
+	// "5,6", err = false
+}
+
 func splitAndParseInts(s string) ([]int64, error) {
 	var out []int64
 	for _, ss := range strings.Split(s, ",") {
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textcoder
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// RegisterFunc registers an encoding function and a decoding function for
+// values of type T in the registry.
+//
+// Unlike Registry.Register, the signatures of the functions are checked by the
+// compiler. RegisterFunc panics if either function is nil.
+func RegisterFunc[T any](r *Registry, enc func(*Context, T) (string, error), dec func(*Context, string, *T) error) {
+	t := typeOf[T]()
+	if enc == nil || dec == nil {
+		panic(fmt.Errorf("RegisterFunc[%v] requires a non-nil encoder and decoder", t))
+	}
+	r.setEntry(t,
+		func(ctx *Context, value interface{}) (string, error) {
+			// value may be a nil interface if T is an interface type.
+			v, _ := value.(T)
+			return enc(ctx, v)
+		},
+		func(ctx *Context, text string, dst interface{}) error {
+			return dec(ctx, text, dst.(*T))
+		})
+}
+
+// MarshalTyped encodes a value of type T into a string using the coders of the
+// default registry. Unlike Marshal, the encoder is looked up using the static
+// type T.
+//
+// If T is an interface type and no coder is registered for it, the coder for
+// the dynamic type of the value is used. Use Marshal or MarshalContext for
+// values whose type is not known at compile time.
+func MarshalTyped[T any](value T) (string, error) {
+	ctx := DefaultRegistry().NewContext()
+	if enc := ctx.Registry().GetEncoder(typeOf[T]()); enc != nil {
+		return enc.EncodeText(ctx, value)
+	}
+	return MarshalContext(ctx, value)
+}
+
+// UnmarshalTyped decodes a textual value into dst using the coders of the
+// default registry. Unlike Unmarshal, the decoder is looked up using the static
+// type T.
+//
+// Use Unmarshal or UnmarshalContext when the type of dst is not known at
+// compile time.
+func UnmarshalTyped[T any](value string, dst *T) error {
+	dec := DefaultRegistry().GetDecoder(typeOf[T]())
+	if dec == nil {
+		return fmt.Errorf("no registered decoder for type %v", reflect.TypeOf(dst))
+	}
+	return dec.DecodeText(DefaultRegistry().NewContext(), value, dst)
+}
+
+// typeOf returns the reflect.Type of T, which is an interface type if T is an
+// interface type.
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
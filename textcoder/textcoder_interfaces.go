@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package textcoder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// interfaceEntry is a coder registered for an interface type.
+type interfaceEntry struct {
+	t        reflect.Type
+	entry    *registryEntry
+	priority int
+	// seq is the registration order of the interface, used to break ties between entries
+	// with the same priority.
+	seq int
+}
+
+// SetInterfacePriority sets the priority of the coder registered for interface type t.
+//
+// When a coder is requested for a type that is not explicitly registered and that
+// implements more than one registered interface, the coder of the interface with the highest
+// priority is used. Interfaces with the same priority are ordered by the time of their first
+// registration, earliest first. The default priority is 0.
+func (r *Registry) SetInterfacePriority(t reflect.Type, priority int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ie := range r.interfaces {
+		if ie.t == t {
+			ie.priority = priority
+			r.sortInterfaces()
+			return nil
+		}
+	}
+	return fmt.Errorf("no coder is registered for interface type %v", t)
+}
+
+// addInterface records that entry is the coder for interface type t.
+func (r *Registry) addInterface(t reflect.Type, entry *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ie := range r.interfaces {
+		if ie.t == t {
+			return
+		}
+	}
+	r.interfaces = append(r.interfaces, &interfaceEntry{t: t, entry: entry, seq: len(r.interfaces)})
+	r.sortInterfaces()
+}
+
+// sortInterfaces orders the registered interfaces by precedence and clears the cache of
+// resolved coders. r.mu must be held.
+func (r *Registry) sortInterfaces() {
+	sort.SliceStable(r.interfaces, func(i, j int) bool {
+		a, b := r.interfaces[i], r.interfaces[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	})
+	r.interfaceCoders = make(map[reflect.Type]*interfaceCoder)
+}
+
+// getInterfaceCoder returns a coder for t based on the registered interface with the
+// highest precedence that t or *t implements, or nil if there is none. The result is cached
+// per type.
+func (r *Registry) getInterfaceCoder(t reflect.Type) *interfaceCoder {
+	r.mu.RLock()
+	c, ok := r.interfaceCoders[t]
+	r.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.interfaceCoders[t]; ok {
+		return c
+	}
+	for _, ie := range r.interfaces {
+		if t.Implements(ie.t) {
+			c = &interfaceCoder{t, ie.t, ie.entry, false}
+			break
+		}
+		if t.Kind() != reflect.Interface && reflect.PtrTo(t).Implements(ie.t) {
+			c = &interfaceCoder{t, ie.t, ie.entry, true}
+			break
+		}
+	}
+	r.interfaceCoders[t] = c
+	return c
+}
+
+// interfaceCoder adapts the coder of an interface type to a type that implements it.
+type interfaceCoder struct {
+	t, iface reflect.Type
+	entry    *registryEntry
+	// byPointer is true if *t implements the interface but t does not.
+	byPointer bool
+}
+
+func (c *interfaceCoder) EncodeText(ctx *Context, value T) (string, error) {
+	v := reflect.ValueOf(value)
+	if c.byPointer {
+		ptr := reflect.New(c.t)
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	return c.entry.EncodeText(ctx, v.Interface())
+}
+
+// DecodeText calls the decoder of the interface with a pointer to an interface value that
+// holds the current value of *dst, or dst itself if *t implements the interface. The
+// decoder may either modify that value or replace it with a new value of the same type.
+func (c *interfaceCoder) DecodeText(ctx *Context, text string, dst T) error {
+	dstValue := reflect.ValueOf(dst)
+	ifaceValue := reflect.New(c.iface)
+	if c.byPointer {
+		ifaceValue.Elem().Set(dstValue)
+	} else {
+		ifaceValue.Elem().Set(dstValue.Elem())
+	}
+	if err := c.entry.DecodeText(ctx, text, ifaceValue.Interface()); err != nil {
+		return err
+	}
+	result := ifaceValue.Elem().Elem()
+	wantType := c.t
+	if c.byPointer {
+		wantType = dstValue.Type()
+	}
+	if !result.IsValid() || result.Type() != wantType || (c.byPointer && result.IsNil()) {
+		return fmt.Errorf("decoder for interface %v did not produce a value of type %v", c.iface, wantType)
+	}
+	if c.byPointer {
+		if result.Pointer() != dstValue.Pointer() {
+			dstValue.Elem().Set(result.Elem())
+		}
+		return nil
+	}
+	dstValue.Elem().Set(result)
+	return nil
+}
@@ -20,7 +20,9 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -180,6 +182,31 @@ func TestDefaultEncoders(t *testing.T) {
 	}
 }
 
+func TestExactFloatEncoders(t *testing.T) {
+	ctx := NewContext().WithExactFloats()
+	for _, tt := range []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"float64", float64(math.MaxFloat32 * 8), "2722258773108231000000000000000000000000"},
+		{"float32", float32(math.MaxFloat32 / 8), "42535293000000000000000000000000000000"},
+		{"float64 - fraction", float64(0.1234567891), "0.1234567891"},
+		{"float32 - fraction", float32(0.1), "0.1"},
+		{"distance", distance(42), "42"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MarshalContext(ctx, tt.value)
+			if err != nil {
+				t.Fatalf("MarshalContext() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDefaultDecoders(t *testing.T) {
 	type example struct {
 		name      string
@@ -264,6 +291,282 @@ func TestDefaultDecoders(t *testing.T) {
 	}
 }
 
+type unitful interface{ Unit() string }
+
+type meters float64
+
+func (meters) Unit() string { return "m" }
+
+type named interface{ Name() string }
+
+type namedMeters float64
+
+func (namedMeters) Unit() string { return "m" }
+func (namedMeters) Name() string { return "length" }
+
+type settable interface {
+	Get() string
+	Set(string) error
+}
+
+type label struct{ text string }
+
+func (l *label) Get() string           { return l.text }
+func (l *label) Set(text string) error { l.text = text; return nil }
+
+func TestInterfaceCoders(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(reflect.TypeOf((*unitful)(nil)).Elem(),
+		func(v unitful) (string, error) {
+			return fmt.Sprintf("%v%s", reflect.ValueOf(v).Float(), v.Unit()), nil
+		},
+		func(s string, dst *unitful) error {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, (*dst).Unit()), 64)
+			if err != nil {
+				return err
+			}
+			*dst = reflect.ValueOf(v).Convert(reflect.TypeOf(*dst)).Interface().(unitful)
+			return nil
+		}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(reflect.TypeOf((*named)(nil)).Elem(),
+		func(v named) (string, error) { return v.Name(), nil },
+		func(s string, dst *named) error { return fmt.Errorf("cannot decode %q", s) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(reflect.TypeOf((*settable)(nil)).Elem(),
+		func(v settable) (string, error) { return v.Get(), nil },
+		func(s string, dst *settable) error { return (*dst).Set(s) }); err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(v interface{}) string {
+		enc := r.GetEncoder(reflect.TypeOf(v))
+		if enc == nil {
+			t.Fatalf("no encoder for %T", v)
+		}
+		got, err := enc.EncodeText(r.NewContext(), v)
+		if err != nil {
+			t.Fatalf("EncodeText(%v) error: %v", v, err)
+		}
+		return got
+	}
+
+	if got, want := encode(meters(3.5)), "3.5m"; got != want {
+		t.Errorf("encoding meters got %q, want %q", got, want)
+	}
+	var m meters
+	if err := r.GetDecoder(reflect.TypeOf(m)).DecodeText(r.NewContext(), "4.25m", &m); err != nil || m != 4.25 {
+		t.Errorf("decoding meters got (%v, %v), want (4.25, nil)", m, err)
+	}
+
+	// *label implements settable, but label does not.
+	if got, want := encode(label{"hi"}), "hi"; got != want {
+		t.Errorf("encoding label got %q, want %q", got, want)
+	}
+	var l label
+	if err := r.GetCoder(reflect.TypeOf(l)).DecodeText(r.NewContext(), "there", &l); err != nil || l.text != "there" {
+		t.Errorf("decoding label got (%v, %v), want (there, nil)", l, err)
+	}
+
+	// namedMeters implements both unitful and named, so the earliest registration wins
+	// until the priority of named is raised.
+	if got, want := encode(namedMeters(2)), "2m"; got != want {
+		t.Errorf("encoding namedMeters got %q, want %q", got, want)
+	}
+	if err := r.SetInterfacePriority(reflect.TypeOf((*named)(nil)).Elem(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := encode(namedMeters(2)), "length"; got != want {
+		t.Errorf("encoding namedMeters after SetInterfacePriority got %q, want %q", got, want)
+	}
+
+	// Explicit registrations take precedence over interfaces.
+	if err := r.Register(reflect.TypeOf(meters(0)),
+		func(v meters) (string, error) { return "explicit", nil },
+		func(string, *meters) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := encode(meters(3.5)), "explicit"; got != want {
+		t.Errorf("encoding explicitly registered meters got %q, want %q", got, want)
+	}
+
+	if err := r.SetInterfacePriority(reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), 1); err == nil {
+		t.Errorf("SetInterfacePriority succeeded for an unregistered interface")
+	}
+	if enc := r.GetEncoder(reflect.TypeOf(struct{}{})); enc != nil {
+		t.Errorf("got encoder %v for a type that implements no registered interface", enc)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	r := NewRegistry()
+	RegisterFunc(r,
+		func(_ *Context, v distance) (string, error) { return fmt.Sprintf("%gm", float64(v)), nil },
+		func(_ *Context, s string, dst *distance) error {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(s, "m"), 64)
+			*dst = distance(v)
+			return err
+		})
+	RegisterFunc(r,
+		func(_ *Context, v unitful) (string, error) { return "unit:" + v.Unit(), nil },
+		func(_ *Context, s string, dst *unitful) error { return fmt.Errorf("cannot decode %q", s) })
+
+	coder := r.GetCoder(reflect.TypeOf(distance(0)))
+	got, err := coder.EncodeText(r.NewContext(), distance(1.5))
+	if err != nil || got != "1.5m" {
+		t.Errorf("EncodeText got (%q, %v), want (\"1.5m\", nil)", got, err)
+	}
+	var d distance
+	if err := coder.DecodeText(r.NewContext(), "2.5m", &d); err != nil || d != 2.5 {
+		t.Errorf("DecodeText got (%v, %v), want (2.5, nil)", d, err)
+	}
+
+	// Types that implement a registered interface use its coder.
+	got, err = r.GetEncoder(reflect.TypeOf(meters(0))).EncodeText(r.NewContext(), meters(1))
+	if err != nil || got != "unit:m" {
+		t.Errorf("EncodeText of meters got (%q, %v), want (\"unit:m\", nil)", got, err)
+	}
+}
+
+func TestMarshalTyped(t *testing.T) {
+	if got, err := MarshalTyped(distance(3)); err != nil || got != "3.000000" {
+		t.Errorf("MarshalTyped(distance(3)) = (%q, %v), want (\"3.000000\", nil)", got, err)
+	}
+	// An interface{} value is encoded using its dynamic type.
+	var v interface{} = int64(42)
+	if got, err := MarshalTyped(v); err != nil || got != "42" {
+		t.Errorf("MarshalTyped(interface{}(int64(42))) = (%q, %v), want (\"42\", nil)", got, err)
+	}
+
+	var d distance
+	if err := UnmarshalTyped("1600", &d); err != nil || d != 1600 {
+		t.Errorf("UnmarshalTyped(\"1600\", &d) got (%v, %v), want (1600, nil)", d, err)
+	}
+	type unregistered struct{}
+	err := UnmarshalTyped("x", &unregistered{})
+	checkErr(t, err, regexp.MustCompile(`no registered decoder for type \*textcoder.unregistered`), "UnmarshalTyped")
+}
+
+type myTime time.Time
+
+type tree map[string]tree
+
+func TestRegisterAlias(t *testing.T) {
+	r := NewRegistry()
+	RegisterFunc(r,
+		func(_ *Context, v time.Time) (string, error) { return v.Format("2006-01-02"), nil },
+		func(_ *Context, s string, dst *time.Time) error {
+			v, err := time.Parse("2006-01-02", s)
+			*dst = v
+			return err
+		})
+	if err := r.RegisterAlias(reflect.TypeOf(myTime{}), reflect.TypeOf(time.Time{})); err != nil {
+		t.Fatalf("RegisterAlias failed: %v", err)
+	}
+	coder := r.GetCoder(reflect.TypeOf(myTime{}))
+	var got myTime
+	if err := coder.DecodeText(r.NewContext(), "2020-05-06", &got); err != nil {
+		t.Fatalf("DecodeText failed: %v", err)
+	}
+	if want := myTime(time.Date(2020, 5, 6, 0, 0, 0, 0, time.UTC)); !time.Time(got).Equal(time.Time(want)) {
+		t.Errorf("DecodeText got %v, want %v", time.Time(got), time.Time(want))
+	}
+	if text, err := coder.EncodeText(r.NewContext(), got); err != nil || text != "2020-05-06" {
+		t.Errorf("EncodeText got (%q, %v), want (\"2020-05-06\", nil)", text, err)
+	}
+
+	if err := r.RegisterAlias(reflect.TypeOf(myTime{}), reflect.TypeOf("")); err == nil {
+		t.Errorf("RegisterAlias succeeded for inconvertible types")
+	}
+	if err := NewRegistry().RegisterAlias(reflect.TypeOf(myTime{}), reflect.TypeOf(time.Time{})); err != nil {
+		t.Errorf("RegisterAlias failed for a type that implements encoding.TextMarshaler: %v", err)
+	}
+	type unregistered struct{ t time.Duration }
+	type unregisteredAlias unregistered
+	if err := r.RegisterAlias(reflect.TypeOf(unregisteredAlias{}), reflect.TypeOf(unregistered{})); err == nil {
+		t.Errorf("RegisterAlias succeeded for a type without a coder")
+	}
+}
+
+func TestCompositeCoders(t *testing.T) {
+	type ids []int64
+	for _, tt := range []struct {
+		name          string
+		ctx           *Context
+		value         interface{}
+		text          string
+		wantEncodeErr *regexp.Regexp
+		wantDecodeErr *regexp.Regexp
+	}{
+		{name: "slice", value: []int{1, 2, 3}, text: "1,2,3"},
+		{name: "empty slice", value: []string{}, text: ""},
+		{name: "named slice", value: ids{7, 8}, text: "7,8"},
+		{name: "slice of named basic type", ctx: NewContext().WithExactFloats(), value: []distance{1.5, 2}, text: "1.5,2"},
+		{name: "custom slice delimiter", ctx: NewContext().WithSliceDelimiter("|"), value: []string{"a,b", "c"}, text: "a,b|c"},
+		{name: "nested", value: map[string][]int{"x": {1, 2}, "y": {3}}, text: "x=1,2;y=3"},
+		{name: "map", value: map[string]int{"b": 2, "a": 1}, text: "a=1;b=2"},
+		{name: "empty map", value: map[string]bool{}, text: ""},
+		{name: "custom map delimiters", ctx: NewContext().WithMapDelimiters("&", ":"), value: map[int]string{1: "one", 2: "two"}, text: "1:one&2:two"},
+		{
+			name:          "element contains delimiter",
+			value:         []string{"a,b"},
+			wantEncodeErr: regexp.MustCompile(`error encoding element 0 of \[\]string: encoded value "a,b" contains the delimiter ","`),
+		},
+		{
+			name:          "bad element",
+			value:         []int{},
+			text:          "1,x",
+			wantDecodeErr: regexp.MustCompile(`error decoding element 1 of \[\]int`),
+		},
+		{
+			name:          "missing key-value delimiter",
+			value:         map[string]int{},
+			text:          "a=1;b",
+			wantDecodeErr: regexp.MustCompile(`entry "b" of map\[string\]int has no "=" separating the key and value`),
+		},
+		{
+			name:          "duplicate key",
+			value:         map[string]int{},
+			text:          "a=1;a=2",
+			wantDecodeErr: regexp.MustCompile(`duplicate key "a" in map\[string\]int`),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = NewContext()
+			}
+			typ := reflect.TypeOf(tt.value)
+			coder := DefaultRegistry().GetCoder(typ)
+			if coder == nil {
+				t.Fatalf("GetCoder(%v) returned nil", typ)
+			}
+			if tt.wantDecodeErr == nil {
+				got, err := coder.EncodeText(ctx, tt.value)
+				checkErr(t, err, tt.wantEncodeErr, "EncodeText")
+				if got != tt.text {
+					t.Errorf("EncodeText got %q, want %q", got, tt.text)
+				}
+			}
+			dst := reflect.New(typ)
+			err := coder.DecodeText(ctx, tt.text, dst.Interface())
+			checkErr(t, err, tt.wantDecodeErr, "DecodeText")
+			if diff := cmp.Diff(tt.value, dst.Elem().Interface()); diff != "" {
+				t.Errorf("DecodeText(%q) got unexpected diff (-want, +got):\n%s", tt.text, diff)
+			}
+		})
+	}
+
+	if c := DefaultRegistry().GetCoder(reflect.TypeOf([]struct{}{})); c != nil {
+		t.Errorf("GetCoder returned %v for a slice of a type without a coder", c)
+	}
+	if c := DefaultRegistry().GetCoder(reflect.TypeOf(tree{})); c != nil {
+		t.Errorf("GetCoder returned %v for a recursive map type", c)
+	}
+}
+
 func checkErr(t *testing.T, err error, wantErr *regexp.Regexp, prefix string) {
 	if gotErr, wantErr := err != nil, wantErr != nil; gotErr != wantErr {
 		t.Fatalf("%s: got err %v; wantErr = %v", prefix, err, wantErr)
@@ -23,9 +23,12 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/builder"
 	"github.com/jhump/protoreflect/desc/protoprint"
 	"github.com/stoewer/go-strcase"
+
+	pb "github.com/google/xtoproto/proto/recordtoproto"
 )
 
 // Infer infers a protocol buffer definition from a stream of XML tokens.
@@ -55,11 +58,54 @@ func (ir *InferResult) ProtoFile() (string, error) {
 	p := &protoprint.Printer{
 		SortElements: true,
 	}
+	fDesc, err := ir.fileDescriptor()
+	if err != nil {
+		return "", err
+	}
+	return p.PrintProtoToString(fDesc)
+}
+
+// Mappings returns a mapping for each inferred message. The first mapping is for the
+// message of the first root element, and the others are for the messages of nested
+// elements. Attributes and child elements do not correspond to record columns, so they
+// are described by the extra_field_definitions of each mapping.
+func (ir *InferResult) Mappings() ([]*pb.RecordProtoMapping, error) {
+	fDesc, err := ir.fileDescriptor()
+	if err != nil {
+		return nil, err
+	}
+	if len(fDesc.GetMessageTypes()) == 0 {
+		return nil, fmt.Errorf("no messages inferred; the root elements have no attributes or child elements")
+	}
+	var mappings []*pb.RecordProtoMapping
+	for _, msg := range fDesc.GetMessageTypes() {
+		m := &pb.RecordProtoMapping{MessageName: msg.GetName()}
+		for _, field := range msg.GetFields() {
+			protoType := strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+			if field.GetMessageType() != nil {
+				protoType = field.GetMessageType().GetName()
+			}
+			m.ExtraFieldDefinitions = append(m.ExtraFieldDefinitions, &pb.FieldDefinition{
+				ProtoName: field.GetName(),
+				ProtoType: protoType,
+				ProtoTag:  field.GetNumber(),
+				Comment:   strings.TrimSpace(field.GetSourceInfo().GetLeadingComments()),
+				Repeated:  field.IsRepeated(),
+			})
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// fileDescriptor returns a file with the messages inferred from each root element, in the
+// order the root elements first appeared.
+func (ir *InferResult) fileDescriptor() (*desc.FileDescriptor, error) {
 	b := builder.NewFile("output.proto").SetProto3(true)
 	for _, r := range ir.roots {
 		msgs, err := r.inferredMessages()
 		if err != nil {
-			return "", fmt.Errorf("could not infer messages of root element %s: %w", r, err)
+			return nil, fmt.Errorf("could not infer messages of root element %s: %w", r, err)
 		}
 		for _, msg := range msgs {
 			for i := 1; b.GetMessage(msg.GetName()) != nil; i++ {
@@ -68,11 +114,7 @@ func (ir *InferResult) ProtoFile() (string, error) {
 			b.AddMessage(msg)
 		}
 	}
-	fDesc, err := b.Build()
-	if err != nil {
-		return "", err
-	}
-	return p.PrintProtoToString(fDesc)
+	return b.Build()
 }
 
 type inferenceOptions struct {